@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// How long to wait for the user to complete the authentication in the browser
+const loopbackTimeout = time.Minute * 5
+
+// Authenticates by redirecting the browser to a server listening on the loopback interface.
+// The redirect is only accepted if the state matches, and the code is exchanged with a PKCE
+// verifier so that an intercepted code is useless to anyone else. A port of 0 picks a free port,
+// a fixed port allows the redirect to be forwarded from another machine, i.e. with ssh -L
+func LoopbackAuth(out io.Writer, port int) AuthFn {
+	return func(conf *oauth2.Config) (*oauth2.Token, error) {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to start local auth server: %s", err)
+		}
+		defer listener.Close()
+
+		// Copy config so that the redirect url is only used for this exchange
+		loopbackConf := *conf
+		loopbackConf.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/", listener.Addr().(*net.TCPAddr).Port)
+
+		state, err := randomString(24)
+		if err != nil {
+			return nil, err
+		}
+
+		verifier, err := randomString(48)
+		if err != nil {
+			return nil, err
+		}
+
+		authUrl := loopbackConf.AuthCodeURL(
+			state,
+			oauth2.AccessTypeOffline,
+			oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)
+
+		fmt.Fprintf(out, "Authentication needed\nGo to the following url in your browser:\n%s\n\nWaiting for authentication...\n", authUrl)
+
+		codes := make(chan string, 1)
+		errs := make(chan error, 1)
+
+		server := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+
+				// Ignore requests that are not the redirect we are waiting for
+				if r.URL.Path != "/" || query.Get("state") != state {
+					http.Error(w, "Invalid request", http.StatusBadRequest)
+					return
+				}
+
+				if reason := query.Get("error"); reason != "" {
+					fmt.Fprintln(w, "Authentication failed, you can close this window")
+					select {
+					case errs <- fmt.Errorf("Authentication failed: %s", reason):
+					default:
+					}
+					return
+				}
+
+				fmt.Fprintln(w, "Authentication succeeded, you can close this window")
+				select {
+				case codes <- query.Get("code"):
+				default:
+				}
+			}),
+		}
+
+		go server.Serve(listener)
+		defer server.Close()
+
+		select {
+		case code := <-codes:
+			token, err := loopbackConf.Exchange(oauth2.NoContext, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to exchange auth code for token: %s", err)
+			}
+			return token, nil
+		case err := <-errs:
+			return nil, err
+		case <-time.After(loopbackTimeout):
+			return nil, fmt.Errorf("Timed out waiting for authentication after %s", loopbackTimeout)
+		}
+	}
+}
+
+// Returns a random url safe string made from n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate random string: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -5,12 +5,16 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"net/http"
+	"net/url"
 	"time"
 )
 
-type authCodeFn func(string) func() string
+const revokeUrl = "https://oauth2.googleapis.com/revoke"
 
-func NewFileSourceClient(clientId, clientSecret, tokenFile string, authFn authCodeFn) (*http.Client, error) {
+// Obtains a new token by letting the user authenticate
+type AuthFn func(*oauth2.Config) (*oauth2.Token, error)
+
+func NewFileSourceClient(clientId, clientSecret, tokenFile string, authFn AuthFn) (*http.Client, error) {
 	conf := getConfig(clientId, clientSecret)
 
 	// Read cached token
@@ -19,14 +23,12 @@ func NewFileSourceClient(clientId, clientSecret, tokenFile string, authFn authCo
 		return nil, fmt.Errorf("Failed to read token: %s", err)
 	}
 
-	// Require auth code if token file does not exist
+	// Require authentication if token file does not exist
 	// or refresh token is missing
 	if !exists || token.RefreshToken == "" {
-		authUrl := conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-		authCode := authFn(authUrl)()
-		token, err = conf.Exchange(oauth2.NoContext, authCode)
+		token, err = Login(clientId, clientSecret, tokenFile, authFn)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to exchange auth code for token: %s", err)
+			return nil, err
 		}
 	}
 
@@ -36,6 +38,41 @@ func NewFileSourceClient(clientId, clientSecret, tokenFile string, authFn authCo
 	), nil
 }
 
+// Authenticates and saves the new token to the token file
+func Login(clientId, clientSecret, tokenFile string, authFn AuthFn) (*oauth2.Token, error) {
+	token, err := authFn(getConfig(clientId, clientSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = SaveToken(tokenFile, token); err != nil {
+		return nil, fmt.Errorf("Failed to save token: %s", err)
+	}
+
+	return token, nil
+}
+
+// Revokes the token so that it can't be used again, revoking
+// the refresh token also revokes the access tokens issued from it
+func RevokeToken(token *oauth2.Token) error {
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	res, err := http.PostForm(revokeUrl, url.Values{"token": {value}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %s", res.Status)
+	}
+
+	return nil
+}
+
 func NewRefreshTokenClient(clientId, clientSecret, refreshToken string) *http.Client {
 	conf := getConfig(clientId, clientSecret)
 
@@ -87,7 +124,6 @@ func getConfig(clientId, clientSecret string) *oauth2.Config {
 		ClientID:     clientId,
 		ClientSecret: clientSecret,
 		Scopes:       []string{"https://www.googleapis.com/auth/drive"},
-		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob",
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
 			TokenURL: "https://accounts.google.com/o/oauth2/token",
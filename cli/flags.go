@@ -7,14 +7,14 @@ type Flag interface {
 	GetParser() Parser
 }
 
-func getFlagParser(flags []Flag) Parser {
+func getFlagParser(flags []Flag, defaults map[string]interface{}) Parser {
 	var parsers []Parser
 
 	for _, flag := range flags {
 		parsers = append(parsers, flag.GetParser())
 	}
 
-	return FlagParser{parsers}
+	return FlagParser{parsers, flags, defaults}
 }
 
 type BoolFlag struct {
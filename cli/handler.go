@@ -31,6 +31,12 @@ func (groups FlagGroups) getFlags(name string) []Flag {
 
 var handlers []*Handler
 
+// Returns default values, keyed by flag name, for the flags of the matched handler.
+// The defaults replace the built-in default values of flags not given on the command line
+type DefaultsFunc func(args Arguments, handler *Handler) map[string]interface{}
+
+var defaultsFn DefaultsFunc
+
 type Handler struct {
 	Pattern     string
 	FlagGroups  FlagGroups
@@ -38,14 +44,14 @@ type Handler struct {
 	Description string
 }
 
-func (self *Handler) getParser() Parser {
+func (self *Handler) getParser(defaults map[string]interface{}) Parser {
 	var parsers []Parser
 
 	for _, pattern := range self.SplitPattern() {
 		if isFlagGroup(pattern) {
 			groupName := flagGroupName(pattern)
 			flags := self.FlagGroups.getFlags(groupName)
-			parsers = append(parsers, getFlagParser(flags))
+			parsers = append(parsers, getFlagParser(flags, defaults))
 		} else if isCaptureGroup(pattern) {
 			parsers = append(parsers, CaptureGroupParser{pattern})
 		} else {
@@ -68,10 +74,34 @@ func (self *Handler) SplitPattern() []string {
 	return matches
 }
 
+// Returns all flags of the handler
+func (self *Handler) Flags() []Flag {
+	var flags []Flag
+	for _, group := range self.FlagGroups {
+		flags = append(flags, group.Flags...)
+	}
+	return flags
+}
+
+// Returns the command words of the pattern, i.e. "sync upload"
+func (self *Handler) Command() string {
+	var words []string
+	for _, pattern := range self.SplitPattern() {
+		if !isFlagGroup(pattern) && !isCaptureGroup(pattern) {
+			words = append(words, pattern)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
 func SetHandlers(h []*Handler) {
 	handlers = h
 }
 
+func SetDefaults(fn DefaultsFunc) {
+	defaultsFn = fn
+}
+
 func AddHandler(pattern string, groups FlagGroups, callback func(Context), desc string) {
 	handlers = append(handlers, &Handler{
 		Pattern:     pattern,
@@ -83,7 +113,7 @@ func AddHandler(pattern string, groups FlagGroups, callback func(Context), desc
 
 func findHandler(args []string) *Handler {
 	for _, h := range handlers {
-		if _, ok := h.getParser().Match(args); ok {
+		if _, ok := h.getParser(nil).Match(args); ok {
 			return h
 		}
 	}
@@ -96,7 +126,14 @@ func Handle(args []string) bool {
 		return false
 	}
 
-	_, data := h.getParser().Capture(args)
+	_, data := h.getParser(nil).Capture(args)
+
+	// Capture again with the defaults, which may depend on the captured arguments
+	if defaultsFn != nil {
+		if defaults := defaultsFn(data, h); len(defaults) > 0 {
+			_, data = h.getParser(defaults).Capture(args)
+		}
+	}
 	ctx := Context{
 		args:     data,
 		handlers: handlers,
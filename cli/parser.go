@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Parser interface {
@@ -71,11 +72,7 @@ type BoolFlagParser struct {
 }
 
 func (self BoolFlagParser) Match(values []string) ([]string, bool) {
-	if self.omitValue {
-		return flagKeyMatch(self.pattern, values, 0)
-	}
-
-	remaining, value, ok := flagKeyValueMatch(self.pattern, values, 0)
+	remaining, value, ok := self.match(values)
 	if !ok {
 		return remaining, false
 	}
@@ -89,12 +86,11 @@ func (self BoolFlagParser) Match(values []string) ([]string, bool) {
 }
 
 func (self BoolFlagParser) Capture(values []string) ([]string, map[string]interface{}) {
-	if self.omitValue {
-		remaining, ok := flagKeyMatch(self.pattern, values, 0)
-		return remaining, map[string]interface{}{self.key: ok}
+	remaining, value, ok := self.match(values)
+	if !ok && self.omitValue {
+		return remaining, map[string]interface{}{self.key: false}
 	}
 
-	remaining, value, ok := flagKeyValueMatch(self.pattern, values, 0)
 	if !ok {
 		return remaining, map[string]interface{}{self.key: self.defaultValue}
 	}
@@ -103,6 +99,20 @@ func (self BoolFlagParser) Capture(values []string) ([]string, map[string]interf
 	return remaining, map[string]interface{}{self.key: b}
 }
 
+// Flags that omit the value are true when given, they can also be given
+// a value with i.e. --no-progress=false to turn off a configured default
+func (self BoolFlagParser) match(values []string) ([]string, string, bool) {
+	if !self.omitValue {
+		return flagKeyValueMatch(self.pattern, values, 0)
+	}
+
+	if remaining, ok := flagKeyMatch(self.pattern, values, 0); ok {
+		return remaining, "true", true
+	}
+
+	return flagAssignMatch(self.pattern, values, 0)
+}
+
 func (self BoolFlagParser) String() string {
 	return fmt.Sprintf("BoolFlagParser '%s'", self.pattern)
 }
@@ -211,7 +221,9 @@ func (self StringSliceFlagParser) String() string {
 }
 
 type FlagParser struct {
-	parsers []Parser
+	parsers  []Parser
+	flags    []Flag
+	defaults map[string]interface{}
 }
 
 func (self FlagParser) Match(values []string) ([]string, bool) {
@@ -227,9 +239,16 @@ func (self FlagParser) Capture(values []string) ([]string, map[string]interface{
 	captured := map[string]interface{}{}
 	remainingValues := values
 
-	for _, parser := range self.parsers {
+	for i, parser := range self.parsers {
 		var data map[string]interface{}
+		count := len(remainingValues)
 		remainingValues, data = parser.Capture(remainingValues)
+
+		// Use the given default if the flag was not found
+		if value, ok := self.defaults[self.flags[i].GetName()]; ok && len(remainingValues) == count {
+			data = map[string]interface{}{self.flags[i].GetName(): value}
+		}
+
 		for key, value := range data {
 			captured[key] = value
 		}
@@ -331,6 +350,20 @@ func flagKeyValueMatch(key string, values []string, index int) ([]string, string
 	return flagKeyValueMatch(key, values, index+1)
 }
 
+func flagAssignMatch(key string, values []string, index int) ([]string, string, bool) {
+	if index > len(values)-1 {
+		return values, "", false
+	}
+
+	if strings.HasPrefix(values[index], key+"=") {
+		value := strings.TrimPrefix(values[index], key+"=")
+		remaining := append(copySlice(values[:index]), values[index+1:]...)
+		return remaining, value, true
+	}
+
+	return flagAssignMatch(key, values, index+1)
+}
+
 func flagKeyMatch(key string, values []string, index int) ([]string, bool) {
 	if index > len(values)-1 {
 		return values, false
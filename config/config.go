@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+)
+
+// Default values of flags, keyed by the long flag name without dashes, i.e. "timeout".
+// Keys prefixed with a command, i.e. "sync.upload.timeout", only apply to that command
+type Config struct {
+	path    string
+	Options map[string]string `json:"options"`
+}
+
+// Loads the config in the config dir, an empty config is returned if the file does not exist
+func Load(configDir string) (*Config, error) {
+	config := &Config{
+		path:    util.ConfigFilePath(configDir, constants.ConfigFileName),
+		Options: map[string]string{},
+	}
+
+	f, err := os.Open(config.path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config: %s", err)
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(config); err != nil {
+		return nil, fmt.Errorf("Failed to read config: %s", err)
+	}
+
+	if config.Options == nil {
+		config.Options = map[string]string{}
+	}
+
+	return config, nil
+}
+
+func (self *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(self.path), 0700); err != nil {
+		return fmt.Errorf("Failed to create config dir: %s", err)
+	}
+
+	if err := util.WriteJson(self.path, self); err != nil {
+		return fmt.Errorf("Failed to save config: %s", err)
+	}
+
+	return nil
+}
+
+func (self *Config) Get(key string) (string, bool) {
+	value, ok := self.Options[key]
+	return value, ok
+}
+
+// Sets the option, an empty value removes it
+func (self *Config) Set(key, value string) {
+	if value == "" {
+		delete(self.Options, key)
+		return
+	}
+	self.Options[key] = value
+}
+
+// Returns the option keys in alphabetical order
+func (self *Config) Keys() []string {
+	var keys []string
+	for key := range self.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
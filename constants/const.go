@@ -11,13 +11,25 @@ const DefaultNameWidth = 40
 const DefaultPathWidth = 60
 const DefaultUploadChunkSize = 8 * 1024 * 1024
 const DefaultTimeout = 5 * 60
+const DefaultParallel = 1
+const DefaultWatchInterval = 30
 const DefaultQuery = "trashed = false and 'me' in owners"
+const DefaultSharedDriveQuery = "trashed = false"
+const TrashQuery = "trashed = true and 'me' in owners"
+const SharedDriveTrashQuery = "trashed = true"
 const DefaultShareRole = "reader"
 const DefaultShareType = "anyone"
 
 const MinCacheFileSize = 5 * 1024 * 1024
 
 const MaxErrorRetries = 5
+const DefaultMaxBackoff = 60
+
+// Max number of calls in a batch request
+const MaxBatchSize = 100
+
+// Max number of ids returned by one generate ids request
+const MaxGeneratedIds = 1000
 
 const DirectoryMimeType = "application/vnd.google-apps.folder"
 
@@ -26,6 +38,12 @@ const MaxRateInterval = time.Second * 3
 
 const DefaultIgnoreFile = ".gdriveignore"
 
+const (
+	OutputJson  = "json"
+	OutputJsonl = "jsonl"
+	OutputCsv   = "csv"
+)
+
 type ModTime int
 
 const (
@@ -55,6 +73,12 @@ const TimeoutTimerInterval = time.Second * 10
 
 const TokenFilename = "token_v2.json"
 const DefaultCacheFileName = "file_cache.json"
-const AuthFileName = "gdrive_auth_value.txt"
+const UploadStateFileName = "upload_state.json"
+const WatchStateFileName = "watch_state.json"
+const SyncStateDirName = "sync_state"
+const ProfilesFileName = "profiles.json"
+const ConfigFileName = "config.json"
+const SaltFileName = "passphrase_salt"
+const ProfilesDirName = "profiles"
 
 const HomeDir = "/home"
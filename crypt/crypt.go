@@ -0,0 +1,315 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Encrypted files start with the magic string followed by the salt of the master
+// key and a random file salt. The content is split into chunks which are sealed
+// with AES-256-GCM using a key derived from the file salt, the nonce holds the
+// chunk counter and a flag marking the last chunk so that reordered or truncated
+// files are detected
+const (
+	magic       = "GDRIVEC1"
+	kdfSaltSize = 16
+	saltSize    = 32
+	chunkSize   = 64 * 1024
+	nonceSize   = 12
+	overhead    = 16
+	headerSize  = len(magic) + kdfSaltSize + saltSize
+)
+
+// Argon2id parameters used for passphrases, the second recommended option of RFC 9106
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+// Each cipher encrypts with a master key derived from its salt. The salt is stored with
+// the encrypted content and names, and the keys of the salts met while decrypting are
+// derived when needed. Ciphers with the same key and salt give the same encrypted names
+type Cipher struct {
+	derive func(salt []byte) []byte
+	salt   []byte
+	mutex  *sync.Mutex
+	keys   map[string]*cipherKeys
+}
+
+// Content and names are encrypted with separate keys derived from the master key
+type cipherKeys struct {
+	content []byte
+	name    []byte
+}
+
+// Creates a cipher with a key derived from the content of the given file
+func NewKeyFileCipher(path string) (*Cipher, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key file: %s", err)
+	}
+
+	if len(content) == 0 {
+		return nil, fmt.Errorf("Key file '%s' is empty", path)
+	}
+
+	// The key file is random enough on its own, so the salt is derived from the key
+	key := sha256.Sum256(content)
+	salt := hmacSum(key[:], []byte("salt"))[:kdfSaltSize]
+
+	return newCipher(salt, func(salt []byte) []byte {
+		return hmacSum(key[:], salt)
+	}), nil
+}
+
+// Creates a cipher with a key derived from the given passphrase and salt, see LoadSalt
+func NewPassphraseCipher(passphrase string, salt []byte) (*Cipher, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("Passphrase can't be empty")
+	}
+
+	if len(salt) != kdfSaltSize {
+		return nil, fmt.Errorf("Salt must be %d bytes", kdfSaltSize)
+	}
+
+	return newCipher(salt, func(salt []byte) []byte {
+		return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, 32)
+	}), nil
+}
+
+// Reads the salt used for passphrases from the given file. A random salt
+// is generated and saved if the file does not exist
+func LoadSalt(path string) ([]byte, error) {
+	salt, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(salt) != kdfSaltSize {
+			return nil, fmt.Errorf("Salt file '%s' is corrupt", path)
+		}
+		return salt, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to read salt file: %s", err)
+	}
+
+	salt = make([]byte, kdfSaltSize)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("Failed to generate salt: %s", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create config dir: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path, salt, 0600); err != nil {
+		return nil, fmt.Errorf("Failed to save salt file: %s", err)
+	}
+
+	return salt, nil
+}
+
+func newCipher(salt []byte, derive func(salt []byte) []byte) *Cipher {
+	return &Cipher{
+		derive: derive,
+		salt:   salt,
+		mutex:  &sync.Mutex{},
+		keys:   map[string]*cipherKeys{},
+	}
+}
+
+// Returns the keys of the given salt, the master key is only derived once per salt
+func (self *Cipher) keysOf(salt []byte) *cipherKeys {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if keys, ok := self.keys[string(salt)]; ok {
+		return keys
+	}
+
+	masterKey := self.derive(salt)
+	keys := &cipherKeys{
+		content: hmacSum(masterKey, []byte("content")),
+		name:    hmacSum(masterKey, []byte("name")),
+	}
+	self.keys[string(salt)] = keys
+	return keys
+}
+
+// Returns a reader that encrypts the content read from r
+func (self *Cipher) EncryptReader(r io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("Failed to generate salt: %s", err)
+	}
+
+	aead, err := newAEAD(hmacSum(self.keysOf(self.salt).content, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte(magic), self.salt...), salt...)
+
+	return &chunkReader{
+		src:  bufio.NewReaderSize(r, chunkSize),
+		buf:  bytes.NewBuffer(header),
+		size: chunkSize,
+		process: func(nonce, chunk []byte) ([]byte, error) {
+			return aead.Seal(nil, nonce, chunk, nil), nil
+		},
+	}, nil
+}
+
+// Returns a reader that decrypts the content read from r,
+// an error is returned if r does not hold an encrypted file
+func (self *Cipher) DecryptReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("Not an encrypted file")
+	}
+
+	kdfSalt := header[len(magic) : len(magic)+kdfSaltSize]
+	aead, err := newAEAD(hmacSum(self.keysOf(kdfSalt).content, header[len(magic)+kdfSaltSize:]))
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkReader{
+		src:  bufio.NewReaderSize(r, chunkSize+overhead),
+		buf:  &bytes.Buffer{},
+		size: chunkSize + overhead,
+		process: func(nonce, chunk []byte) ([]byte, error) {
+			plain, err := aead.Open(nil, nonce, chunk, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to decrypt file: file is corrupt or the key is wrong")
+			}
+			return plain, nil
+		},
+		decrypt: true,
+	}, nil
+}
+
+// Encrypts a file name, the salt of the master key is stored in front of the
+// encrypted name. The same cipher always gives the same encrypted name
+func (self *Cipher) EncryptName(name string) string {
+	nameKey := self.keysOf(self.salt).name
+	aead, _ := newAEAD(nameKey)
+	nonce := hmacSum(nameKey, []byte(name))[:nonceSize]
+	sealed := aead.Seal(append(append([]byte(nil), self.salt...), nonce...), nonce, []byte(name), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (self *Cipher) DecryptName(name string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil || len(sealed) < kdfSaltSize+nonceSize+overhead {
+		return "", fmt.Errorf("'%s' is not an encrypted name", name)
+	}
+
+	aead, _ := newAEAD(self.keysOf(sealed[:kdfSaltSize]).name)
+	sealed = sealed[kdfSaltSize:]
+	plain, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decrypt name '%s', wrong key?", name)
+	}
+
+	return string(plain), nil
+}
+
+// Reads chunks from src and passes them through process, one byte is
+// read ahead to know if the current chunk is the last one
+type chunkReader struct {
+	src     *bufio.Reader
+	buf     *bytes.Buffer
+	size    int
+	counter uint64
+	done    bool
+	decrypt bool
+	process func(nonce, chunk []byte) ([]byte, error)
+	err     error
+}
+
+func (self *chunkReader) Read(p []byte) (int, error) {
+	for self.buf.Len() == 0 && !self.done && self.err == nil {
+		self.err = self.nextChunk()
+	}
+
+	if self.buf.Len() > 0 {
+		return self.buf.Read(p)
+	}
+
+	if self.err != nil {
+		return 0, self.err
+	}
+
+	return 0, io.EOF
+}
+
+func (self *chunkReader) nextChunk() error {
+	chunk := make([]byte, self.size)
+	n, err := io.ReadFull(self.src, chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// This is the last chunk if there is nothing more to read
+	last := false
+	if n < self.size {
+		last = true
+	} else if _, err := self.src.Peek(1); err == io.EOF {
+		last = true
+	} else if err != nil {
+		return err
+	}
+
+	if self.decrypt && n == 0 {
+		return fmt.Errorf("Failed to decrypt file: file is truncated")
+	}
+
+	out, err := self.process(chunkNonce(self.counter, last), chunk[:n])
+	if err != nil {
+		return err
+	}
+
+	self.buf.Write(out)
+	self.counter++
+	self.done = last
+	return nil
+}
+
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create cipher: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,177 @@
+package crypt_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/grandeto/gdrive/crypt"
+)
+
+func newKeyFileCipher(t *testing.T, key string) *crypt.Cipher {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(path, []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cipher, err := crypt.NewKeyFileCipher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func newPassphraseCipher(t *testing.T, passphrase string, salt []byte) *crypt.Cipher {
+	cipher, err := crypt.NewPassphraseCipher(passphrase, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func encrypt(t *testing.T, cipher *crypt.Cipher, plain []byte) []byte {
+	reader, err := cipher.EncryptReader(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+func decrypt(cipher *crypt.Cipher, encrypted []byte) ([]byte, error) {
+	reader, err := cipher.DecryptReader(bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	return content
+}
+
+func TestContentRoundTrip(t *testing.T) {
+	cipher := newKeyFileCipher(t, "key")
+
+	for _, size := range []int{0, 1, crypt.ChunkSize - 1, crypt.ChunkSize, crypt.ChunkSize + 1, 3 * crypt.ChunkSize} {
+		plain := randomContent(size)
+
+		decrypted, err := decrypt(cipher, encrypt(t, cipher, plain))
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %s", size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("Decrypted content of %d bytes does not match the plaintext", size)
+		}
+	}
+}
+
+func TestNameRoundTrip(t *testing.T) {
+	cipher := newKeyFileCipher(t, "key")
+
+	for _, name := range []string{"a", "file.txt", "a name with spaces and ünicode.tar.gz"} {
+		decrypted, err := cipher.DecryptName(cipher.EncryptName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != name {
+			t.Errorf("Expected %q, got %q", name, decrypted)
+		}
+	}
+}
+
+func TestDecryptRejectsTruncatedContent(t *testing.T) {
+	cipher := newKeyFileCipher(t, "key")
+	encrypted := encrypt(t, cipher, randomContent(3*crypt.ChunkSize))
+
+	// Cut after the first and second chunk, and in the middle of the last chunk
+	for _, size := range []int{
+		crypt.HeaderSize,
+		crypt.HeaderSize + crypt.SealedChunkSize,
+		crypt.HeaderSize + 2*crypt.SealedChunkSize,
+		len(encrypted) - 1,
+	} {
+		if _, err := decrypt(cipher, encrypted[:size]); err == nil {
+			t.Errorf("Expected content truncated to %d bytes to be rejected", size)
+		}
+	}
+}
+
+func TestDecryptRejectsReorderedChunks(t *testing.T) {
+	cipher := newKeyFileCipher(t, "key")
+	encrypted := encrypt(t, cipher, randomContent(3*crypt.ChunkSize))
+
+	first := encrypted[crypt.HeaderSize : crypt.HeaderSize+crypt.SealedChunkSize]
+	second := encrypted[crypt.HeaderSize+crypt.SealedChunkSize : crypt.HeaderSize+2*crypt.SealedChunkSize]
+
+	var reordered []byte
+	reordered = append(reordered, encrypted[:crypt.HeaderSize]...)
+	reordered = append(reordered, second...)
+	reordered = append(reordered, first...)
+	reordered = append(reordered, encrypted[crypt.HeaderSize+2*crypt.SealedChunkSize:]...)
+
+	if _, err := decrypt(cipher, reordered); err == nil {
+		t.Errorf("Expected reordered chunks to be rejected")
+	}
+}
+
+func TestDecryptRejectsWrongKey(t *testing.T) {
+	salt := make([]byte, crypt.SaltSize)
+	cipher := newPassphraseCipher(t, "secret", salt)
+	wrong := newPassphraseCipher(t, "wrong", salt)
+
+	if _, err := decrypt(wrong, encrypt(t, cipher, randomContent(100))); err == nil {
+		t.Errorf("Expected content encrypted with another passphrase to be rejected")
+	}
+
+	if _, err := wrong.DecryptName(cipher.EncryptName("file.txt")); err == nil {
+		t.Errorf("Expected name encrypted with another passphrase to be rejected")
+	}
+
+	if _, err := decrypt(newKeyFileCipher(t, "other"), encrypt(t, newKeyFileCipher(t, "key"), randomContent(100))); err == nil {
+		t.Errorf("Expected content encrypted with another key file to be rejected")
+	}
+}
+
+func TestEncryptedNamesAreStable(t *testing.T) {
+	salt, err := crypt.LoadSalt(filepath.Join(t.TempDir(), "salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := newPassphraseCipher(t, "secret", salt)
+	second := newPassphraseCipher(t, "secret", salt)
+	if first.EncryptName("file.txt") != second.EncryptName("file.txt") {
+		t.Errorf("Expected ciphers with the same passphrase and salt to encrypt names the same way")
+	}
+
+	if newKeyFileCipher(t, "key").EncryptName("file.txt") != newKeyFileCipher(t, "key").EncryptName("file.txt") {
+		t.Errorf("Expected ciphers with the same key file to encrypt names the same way")
+	}
+}
+
+func TestLoadSaltReturnsSavedSalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "salt")
+
+	saved, err := crypt.LoadSalt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := crypt.LoadSalt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(saved, loaded) {
+		t.Errorf("Expected the saved salt to be loaded")
+	}
+}
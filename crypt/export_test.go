@@ -0,0 +1,9 @@
+package crypt
+
+// Sizes of the parts of an encrypted file
+const (
+	HeaderSize      = headerSize
+	ChunkSize       = chunkSize
+	SealedChunkSize = chunkSize + overhead
+	SaltSize        = kdfSaltSize
+)
@@ -2,67 +2,33 @@ package drive
 
 import (
 	"fmt"
-	"io"
-	"text/tabwriter"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
 )
 
-type AboutArgs struct {
-	Out         io.Writer
-	SizeInBytes bool
-}
-
-func (self *Drive) About(args AboutArgs) (err error) {
-	about, err := self.service.About.Get().Fields("maxImportSizes", "maxUploadSize", "storageQuota", "user").Do()
+// Returns the user, storage quota and max upload size
+func (self *Drive) About(ctx context.Context) (*drive.About, error) {
+	about, err := self.service.About.Get().Fields("maxImportSizes", "maxUploadSize", "storageQuota", "user").Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get about: %s", err)
+		return nil, fmt.Errorf("Failed to get about: %s", err)
 	}
-
-	user := about.User
-	quota := about.StorageQuota
-
-	fmt.Fprintf(args.Out, "User: %s, %s\n", user.DisplayName, user.EmailAddress)
-	fmt.Fprintf(args.Out, "Used: %s\n", formatSize(quota.Usage, args.SizeInBytes))
-	fmt.Fprintf(args.Out, "Free: %s\n", formatSize(quota.Limit-quota.Usage, args.SizeInBytes))
-	fmt.Fprintf(args.Out, "Total: %s\n", formatSize(quota.Limit, args.SizeInBytes))
-	fmt.Fprintf(args.Out, "Max upload size: %s\n", formatSize(about.MaxUploadSize, args.SizeInBytes))
-	return
+	return about, nil
 }
 
-type AboutImportArgs struct {
-	Out io.Writer
-}
-
-func (self *Drive) AboutImport(args AboutImportArgs) (err error) {
-	about, err := self.service.About.Get().Fields("importFormats").Do()
+// Returns the mime types that can be imported, keyed by the source mime type
+func (self *Drive) AboutImport(ctx context.Context) (map[string][]string, error) {
+	about, err := self.service.About.Get().Fields("importFormats").Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get about: %s", err)
+		return nil, fmt.Errorf("Failed to get about: %s", err)
 	}
-	printAboutFormats(args.Out, about.ImportFormats)
-	return
-}
-
-type AboutExportArgs struct {
-	Out io.Writer
+	return about.ImportFormats, nil
 }
 
-func (self *Drive) AboutExport(args AboutExportArgs) (err error) {
-	about, err := self.service.About.Get().Fields("exportFormats").Do()
+// Returns the mime types that can be exported to, keyed by the source mime type
+func (self *Drive) AboutExport(ctx context.Context) (map[string][]string, error) {
+	about, err := self.service.About.Get().Fields("exportFormats").Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get about: %s", err)
+		return nil, fmt.Errorf("Failed to get about: %s", err)
 	}
-	printAboutFormats(args.Out, about.ExportFormats)
-	return
-}
-
-func printAboutFormats(out io.Writer, formats map[string][]string) {
-	w := new(tabwriter.Writer)
-	w.Init(out, 0, 0, 3, ' ', 0)
-
-	fmt.Fprintln(w, "From\tTo")
-
-	for from, toFormats := range formats {
-		fmt.Fprintf(w, "%s\t%s\n", from, formatList(toFormats))
-	}
-
-	w.Flush()
+	return about.ExportFormats, nil
 }
@@ -0,0 +1,376 @@
+package drive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/grandeto/gdrive/constants"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// A metadata call that is sent as a part of a batch request
+type batchCall struct {
+	method string
+	path   string       // Relative to the api base path, i.e. files/<id>
+	params url.Values   // Query parameters, supportsAllDrives is always set
+	body   interface{}  // Sent as json if not nil
+	result interface{}  // The response is decoded into result if not nil
+	do     func() error // Makes the same call without batching, used with other stores than the api
+
+	// True if the call creates a file with a pre-allocated id, sending it again can't create a duplicate
+	preallocated bool
+
+	// Called with the error of a call that was sent again, returns nil if
+	// the error means that an earlier attempt of the call succeeded
+	replayed func(err error) error
+}
+
+// Calls that create something may have been processed even though they failed, they are only
+// sent again if drive refused them or if the created file has a pre-allocated id
+func (self *batchCall) retryable(err error) bool {
+	return self.method != "POST" || self.preallocated || isRejectedError(err)
+}
+
+// Sends the calls in batch requests of up to MaxBatchSize calls. Calls that fail with
+// a retryable error are sent again in a new batch according to the retry policy.
+// Returns the error of each call, the error is nil for the calls that succeeded
+func (self *Drive) runBatch(calls []*batchCall) []error {
+	errs := make([]error, len(calls))
+
+	// Other stores are called directly
+	if !self.usesApiStore() {
+		for i, call := range calls {
+			errs[i] = call.do()
+		}
+		return errs
+	}
+
+	for start := 0; start < len(calls); start += constants.MaxBatchSize {
+		end := start + constants.MaxBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		self.runBatchCalls(calls[start:end], errs[start:end])
+	}
+
+	return errs
+}
+
+func (self *Drive) runBatchCalls(calls []*batchCall, errs []error) {
+	pending := make([]int, len(calls))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for try := 0; ; try++ {
+		pendingCalls := make([]*batchCall, len(pending))
+		for j, i := range pending {
+			pendingCalls[j] = calls[i]
+		}
+
+		// The batch request itself is retried by the client
+		results, err := self.sendBatch(pendingCalls)
+		if err != nil {
+			for _, i := range pending {
+				errs[i] = err
+			}
+			return
+		}
+
+		var retry []int
+		var retryErr error
+
+		for j, i := range pending {
+			if results[j] != nil && try > 0 && calls[i].replayed != nil {
+				results[j] = calls[i].replayed(results[j])
+			}
+
+			errs[i] = results[j]
+			if results[j] != nil && self.retry.shouldRetry(results[j], try) && calls[i].retryable(results[j]) {
+				retry = append(retry, i)
+				retryErr = results[j]
+			}
+		}
+
+		if len(retry) == 0 {
+			return
+		}
+
+		if err := self.retry.wait(self.ctx, retryErr, try); err != nil {
+			for _, i := range retry {
+				errs[i] = err
+			}
+			return
+		}
+		pending = retry
+	}
+}
+
+// Sends the calls as one multipart/mixed request and returns the error of each call
+func (self *Drive) sendBatch(calls []*batchCall) ([]error, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for i, call := range calls {
+		if err := self.writeBatchPart(writer, i, call); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("Failed to prepare batch request: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(self.ctx, "POST", self.batchUrl(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to prepare batch request: %s", err)
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+
+	res, err := self.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to send batch request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if err = googleapi.CheckResponse(res); err != nil {
+		return nil, fmt.Errorf("Batch request failed: %s", err)
+	}
+
+	return readBatchResponse(res, calls)
+}
+
+func (self *Drive) writeBatchPart(writer *multipart.Writer, i int, call *batchCall) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "application/http")
+	header.Set("Content-ID", batchContentId(i))
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("Failed to prepare batch request: %s", err)
+	}
+
+	params := url.Values{}
+	for key, values := range call.params {
+		params[key] = values
+	}
+	params.Set("supportsAllDrives", "true")
+
+	fmt.Fprintf(part, "%s %s?%s HTTP/1.1\r\n", call.method, self.batchCallPath(call.path), params.Encode())
+
+	if call.body == nil {
+		fmt.Fprintf(part, "\r\n")
+		return nil
+	}
+
+	content, err := json.Marshal(call.body)
+	if err != nil {
+		return fmt.Errorf("Failed to encode batch request: %s", err)
+	}
+
+	fmt.Fprintf(part, "Content-Type: application/json; charset=UTF-8\r\nContent-Length: %d\r\n\r\n", len(content))
+	_, err = part.Write(content)
+	return err
+}
+
+// The responses are matched to the calls by the content id
+func readBatchResponse(res *http.Response, calls []*batchCall) ([]error, error) {
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, fmt.Errorf("Invalid batch response content type '%s'", res.Header.Get("Content-Type"))
+	}
+
+	errs := make([]error, len(calls))
+	for i := range errs {
+		errs[i] = fmt.Errorf("Batch response is missing")
+	}
+
+	reader := multipart.NewReader(res.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return errs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read batch response: %s", err)
+		}
+
+		i, ok := batchResponseIndex(part.Header.Get("Content-ID"))
+		if !ok || i >= len(calls) {
+			continue
+		}
+
+		errs[i] = readBatchPart(part, calls[i])
+	}
+}
+
+func readBatchPart(part io.Reader, call *batchCall) error {
+	res, err := http.ReadResponse(bufio.NewReader(part), nil)
+	if err != nil {
+		return fmt.Errorf("Failed to read batch response: %s", err)
+	}
+	defer res.Body.Close()
+
+	if err = googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+
+	if call.result == nil {
+		return nil
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(call.result); err != nil {
+		return fmt.Errorf("Failed to decode batch response: %s", err)
+	}
+	return nil
+}
+
+// Returns a call that creates the file, the created file is stored in result.
+// The file should have an id from generateIds if the call is sent in a batch
+func (self *Drive) createFileCall(f *drive.File, result *drive.File) *batchCall {
+	return &batchCall{
+		method: "POST",
+		path:   "files",
+		body:   f,
+		result: result,
+		do: func() error {
+			created, err := self.store.CreateFile(self.ctx, WriteFileArgs{File: f})
+			if err == nil {
+				*result = *created
+			}
+			return err
+		},
+		preallocated: f.Id != "",
+		replayed: func(err error) error {
+			// The file was created by an earlier attempt
+			if !isConflictError(err) || f.Id == "" {
+				return err
+			}
+
+			created, getErr := self.store.GetFile(self.ctx, f.Id, "id", "name", "mimeType")
+			if getErr != nil {
+				return err
+			}
+			*result = *created
+			return nil
+		},
+	}
+}
+
+// Returns new ids for files that are about to be created, the ids are only
+// needed for batch requests and nothing is returned when using other stores
+func (self *Drive) generateIds(count int) ([]string, error) {
+	if !self.usesApiStore() {
+		return make([]string, count), nil
+	}
+
+	var ids []string
+	for len(ids) < count {
+		n := min(count-len(ids), constants.MaxGeneratedIds)
+
+		res, err := self.service.Files.GenerateIds().Count(int64(n)).Context(self.ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate file ids: %s", err)
+		}
+		ids = append(ids, res.Ids...)
+	}
+
+	return ids[:count], nil
+}
+
+// Returns a call that updates the metadata of the file with the fields set on f
+func (self *Drive) updateFileCall(id string, f *drive.File) *batchCall {
+	return &batchCall{
+		method: "PATCH",
+		path:   "files/" + url.PathEscape(id),
+		params: url.Values{"fields": {"id"}},
+		body:   f,
+		do: func() error {
+			_, err := self.store.UpdateFile(self.ctx, id, WriteFileArgs{File: f, Fields: []googleapi.Field{"id"}})
+			return err
+		},
+	}
+}
+
+// Returns a call that deletes the file, or trashes it if trash is true
+func (self *Drive) deleteFileCall(id string, trash bool) *batchCall {
+	if trash {
+		return self.updateFileCall(id, &drive.File{Trashed: true})
+	}
+
+	return &batchCall{
+		method: "DELETE",
+		path:   "files/" + url.PathEscape(id),
+		do: func() error {
+			return self.store.DeleteFile(self.ctx, id)
+		},
+		replayed: func(err error) error {
+			// The file was deleted by an earlier attempt
+			if isNotFoundError(err) {
+				return nil
+			}
+			return err
+		},
+	}
+}
+
+func batchContentId(i int) string {
+	return fmt.Sprintf("<item%d>", i)
+}
+
+// Responses have the content id of the call prefixed with 'response-'
+func batchResponseIndex(contentId string) (int, bool) {
+	id := strings.TrimPrefix(strings.Trim(contentId, "<>"), "response-")
+	if !strings.HasPrefix(id, "item") {
+		return 0, false
+	}
+
+	i, err := strconv.Atoi(strings.TrimPrefix(id, "item"))
+	return i, err == nil && i >= 0
+}
+
+func (self *Drive) batchUrl() string {
+	return strings.TrimSuffix(strings.Replace(self.service.BasePath, "/drive/v3/", "/batch/drive/v3/", 1), "/")
+}
+
+// Returns the absolute path of the call, i.e. /drive/v3/files/<id>
+func (self *Drive) batchCallPath(path string) string {
+	basePath := "/drive/v3/"
+	if u, err := url.Parse(self.service.BasePath); err == nil {
+		basePath = u.Path
+	}
+	return basePath + path
+}
+
+// Returns an error describing the failed calls, or nil if all calls succeeded
+func batchError(action string, names []string, errs []error) error {
+	failedCount := 0
+	firstFailed := -1
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstFailed < 0 {
+			firstFailed = i
+		}
+		failedCount++
+	}
+
+	if failedCount == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Failed to %s %d of %d files, '%s': %s", action, failedCount, len(errs), names[firstFailed], errs[firstFailed])
+}
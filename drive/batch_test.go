@@ -0,0 +1,297 @@
+package drive_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gdrive "github.com/grandeto/gdrive/drive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// A part of a multipart batch request or response
+type batchPart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// Answers batch requests of file deletes and records the size of each batch.
+// A delete of a file in failures is refused the given number of times. The
+// responses are passed through edit before they are returned
+type batchServer struct {
+	mutex    *sync.Mutex
+	files    map[string]bool
+	failures map[string]int
+	batches  []int
+	edit     func(parts []batchPart) []batchPart
+}
+
+func newBatchServer(ids []string) *batchServer {
+	server := &batchServer{mutex: &sync.Mutex{}, files: map[string]bool{}, failures: map[string]int{}}
+	for _, id := range ids {
+		server.files[id] = true
+	}
+	return server
+}
+
+func (self *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/batch/drive/v3" {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts, err := readBatchParts(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	self.mutex.Lock()
+	self.batches = append(self.batches, len(parts))
+
+	var responses []batchPart
+	for _, part := range parts {
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(part.body)))
+		if err != nil {
+			self.mutex.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", "<response-"+strings.Trim(part.header.Get("Content-ID"), "<>")+">")
+		responses = append(responses, batchPart{header: header, body: self.respond(req)})
+	}
+
+	edit := self.edit
+	self.mutex.Unlock()
+
+	if edit != nil {
+		responses = edit(responses)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range responses {
+		out, err := writer.CreatePart(part.header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out.Write(part.body)
+	}
+	writer.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	w.Write(body.Bytes())
+}
+
+// Returns the http response to a call of a batch
+func (self *batchServer) respond(req *http.Request) []byte {
+	id := strings.TrimPrefix(req.URL.Path, "/drive/v3/files/")
+
+	switch {
+	case req.Method != "DELETE":
+		return batchResponse(400, "badRequest")
+	case self.failures[id] > 0:
+		self.failures[id]--
+		return batchResponse(503, "backendError")
+	case !self.files[id]:
+		return batchResponse(404, "notFound")
+	}
+
+	delete(self.files, id)
+	return []byte("HTTP/1.1 204 No Content\r\n\r\n")
+}
+
+func batchResponse(code int, reason string) []byte {
+	body := fmt.Sprintf(`{"error": {"code": %d, "message": "%s", "errors": [{"reason": "%s"}]}}`, code, reason, reason)
+	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: application/json; charset=UTF-8\r\nContent-Length: %d\r\n\r\n%s", code, http.StatusText(code), len(body), body))
+}
+
+func (self *batchServer) setEdit(edit func(parts []batchPart) []batchPart) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.edit = edit
+}
+
+// Returns the number of calls in each batch request received so far
+func (self *batchServer) batchSizes() []int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]int(nil), self.batches...)
+}
+
+func (self *batchServer) exists(id string) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.files[id]
+}
+
+func (self *batchServer) fileCount() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.files)
+}
+
+func readBatchParts(contentType string, body io.Reader) ([]batchPart, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []batchPart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, batchPart{header: part.Header, body: content})
+	}
+}
+
+func newBatchTest(t *testing.T, retries int, ids []string) (*gdrive.Drive, *batchServer) {
+	server := newBatchServer(ids)
+	client := newHandlerClient(t, server)
+	client.SetRetryPolicy(gdrive.RetryPolicy{Retries: retries, MaxBackoff: time.Millisecond})
+	return client, server
+}
+
+func fileIds(count int) []string {
+	var ids []string
+	for i := 0; i < count; i++ {
+		ids = append(ids, fmt.Sprintf("file%d", i))
+	}
+	return ids
+}
+
+func expectErrorCode(t *testing.T, i int, err error, code int) {
+	t.Helper()
+	if code == 0 {
+		if err != nil {
+			t.Errorf("Expected call %d to succeed, got %s", i, err)
+		}
+		return
+	}
+
+	ae, ok := err.(*googleapi.Error)
+	if !ok || ae.Code != code {
+		t.Errorf("Expected call %d to fail with %d, got %v", i, code, err)
+	}
+}
+
+func TestBatchSplitsLargeBatches(t *testing.T) {
+	ids := fileIds(250)
+	client, server := newBatchTest(t, 0, ids)
+
+	errs := client.DeleteFilesInBatch(context.Background(), ids)
+
+	for i, err := range errs {
+		expectErrorCode(t, i, err, 0)
+	}
+
+	if sizes := server.batchSizes(); fmt.Sprint(sizes) != "[100 100 50]" {
+		t.Errorf("Expected batches of 100, 100 and 50 calls, got %v", sizes)
+	}
+
+	if count := server.fileCount(); count != 0 {
+		t.Errorf("Expected all files to be deleted, found %d files", count)
+	}
+}
+
+func TestBatchMapsResponsesByContentId(t *testing.T) {
+	ids := fileIds(2)
+	client, server := newBatchTest(t, 0, ids)
+
+	// The responses are returned in reverse order
+	server.setEdit(func(parts []batchPart) []batchPart {
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+		return parts
+	})
+
+	// The first call succeeds, the second is of a missing file and the third is refused
+	server.failures[ids[1]] = 1
+
+	errs := client.DeleteFilesInBatch(context.Background(), []string{ids[0], "missing", ids[1]})
+
+	expectErrorCode(t, 0, errs[0], 0)
+	expectErrorCode(t, 1, errs[1], 404)
+	expectErrorCode(t, 2, errs[2], 503)
+
+	if !server.exists(ids[1]) {
+		t.Errorf("Expected the refused delete to leave the file")
+	}
+}
+
+func TestBatchRetriesFailedCalls(t *testing.T) {
+	ids := fileIds(2)
+	client, server := newBatchTest(t, 2, ids)
+
+	server.failures[ids[1]] = 1
+
+	errs := client.DeleteFilesInBatch(context.Background(), []string{ids[0], "missing", ids[1]})
+
+	// Only the refused call is sent again, the missing file is not retried
+	expectErrorCode(t, 0, errs[0], 0)
+	expectErrorCode(t, 1, errs[1], 404)
+	expectErrorCode(t, 2, errs[2], 0)
+
+	if sizes := server.batchSizes(); fmt.Sprint(sizes) != "[3 1]" {
+		t.Errorf("Expected batches of 3 and 1 calls, got %v", sizes)
+	}
+
+	if server.exists(ids[1]) {
+		t.Errorf("Expected the retried delete to remove the file")
+	}
+}
+
+func TestBatchMissingResponsePart(t *testing.T) {
+	ids := fileIds(3)
+	client, server := newBatchTest(t, 2, ids)
+
+	// The response of the second call is left out
+	server.setEdit(func(parts []batchPart) []batchPart {
+		var kept []batchPart
+		for _, part := range parts {
+			if part.header.Get("Content-ID") != "<response-item1>" {
+				kept = append(kept, part)
+			}
+		}
+		return kept
+	})
+
+	errs := client.DeleteFilesInBatch(context.Background(), ids)
+
+	expectErrorCode(t, 0, errs[0], 0)
+	expectErrorCode(t, 2, errs[2], 0)
+	if errs[1] == nil || errs[1].Error() != "Batch response is missing" {
+		t.Errorf("Expected call 1 to fail with a missing response, got %v", errs[1])
+	}
+
+	if sizes := server.batchSizes(); len(sizes) != 1 {
+		t.Errorf("Expected calls without a response to not be sent again, got batches %v", sizes)
+	}
+}
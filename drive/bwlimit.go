@@ -0,0 +1,185 @@
+package drive
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Max number of bytes read at a time from a limited reader,
+// keeps the transfer rate smooth when the limit is low
+const maxLimitedRead = 32 * 1024
+
+// Bandwidth limit in bytes per second starting at the given minute of the day
+type bwLimitRule struct {
+	minute int
+	rate   int64
+}
+
+// Bandwidth limit that can change during the day, a rate of 0 means no limit
+type BwLimit []bwLimitRule
+
+// Parses a bandwidth limit, i.e. "10M", or a schedule of limits, i.e. "08:00,2M 19:00,off".
+// Rates are in bytes per second with an optional K, M or G suffix
+func ParseBwLimit(value string) (BwLimit, error) {
+	fields := strings.Fields(value)
+
+	// A single rate applies all day
+	if len(fields) == 1 && !strings.Contains(fields[0], ",") {
+		rate, err := parseRate(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		return BwLimit{{0, rate}}, nil
+	}
+
+	var limit BwLimit
+	for _, field := range fields {
+		parts := strings.SplitN(field, ",", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid bandwidth schedule entry '%s', expected <HH:MM>,<rate>", field)
+		}
+
+		t, err := time.Parse("15:04", parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time '%s' in bandwidth schedule, expected HH:MM", parts[0])
+		}
+
+		rate, err := parseRate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		limit = append(limit, bwLimitRule{t.Hour()*60 + t.Minute(), rate})
+	}
+
+	if len(limit) == 0 {
+		return nil, fmt.Errorf("Bandwidth limit is empty")
+	}
+
+	sort.Sort(limit)
+
+	return limit, nil
+}
+
+func parseRate(value string) (int64, error) {
+	if strings.ToLower(value) == "off" {
+		return 0, nil
+	}
+
+	rate, ok := parseByteSize(value)
+	if !ok {
+		return 0, fmt.Errorf("Invalid bandwidth rate '%s', expected bytes per second, i.e. 500K or 10M", value)
+	}
+
+	return rate, nil
+}
+
+// Returns the rate that applies at the given time, rules
+// before the first rule of the day continue from the previous day
+func (self BwLimit) rate(t time.Time) int64 {
+	minute := t.Hour()*60 + t.Minute()
+
+	rate := self[len(self)-1].rate
+	for _, rule := range self {
+		if rule.minute <= minute {
+			rate = rule.rate
+		}
+	}
+	return rate
+}
+
+func (self BwLimit) Len() int {
+	return len(self)
+}
+
+func (self BwLimit) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+
+func (self BwLimit) Less(i, j int) bool {
+	return self[i].minute < self[j].minute
+}
+
+// Token bucket shared by all transfers, so that parallel transfers together stay below the limit
+type bwLimiter struct {
+	limit  BwLimit
+	mutex  *sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBwLimiter(limit BwLimit) *bwLimiter {
+	return &bwLimiter{
+		limit: limit,
+		mutex: &sync.Mutex{},
+		last:  time.Now(),
+	}
+}
+
+// Takes n bytes from the bucket and waits until the bucket is no longer in debt
+func (self *bwLimiter) wait(n int) {
+	self.mutex.Lock()
+
+	now := time.Now()
+	rate := float64(self.limit.rate(now))
+
+	if rate == 0 {
+		self.tokens = 0
+		self.last = now
+		self.mutex.Unlock()
+		return
+	}
+
+	// Refill the bucket, allowing a burst of at most one second
+	self.tokens += now.Sub(self.last).Seconds() * rate
+	if self.tokens > rate {
+		self.tokens = rate
+	}
+	self.last = now
+	self.tokens -= float64(n)
+
+	var delay time.Duration
+	if self.tokens < 0 {
+		delay = time.Duration(-self.tokens / rate * float64(time.Second))
+	}
+
+	self.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *bwLimiter
+}
+
+func (self *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+
+	n, err := self.reader.Read(p)
+	self.limiter.wait(n)
+	return n, err
+}
+
+// Limits the bandwidth of all transfers made by the drive
+func (self *Drive) SetBwLimit(limit BwLimit) {
+	self.bwLimiter = newBwLimiter(limit)
+}
+
+// Wraps the reader in a bandwidth limited reader if a limit is set
+func (self *Drive) getLimitedReader(r io.Reader) io.Reader {
+	if self.bwLimiter == nil {
+		return r
+	}
+
+	return &limitedReader{
+		reader:  r,
+		limiter: self.bwLimiter,
+	}
+}
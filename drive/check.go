@@ -0,0 +1,225 @@
+package drive
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
+)
+
+// Differences found between a local file and the drive copy
+const (
+	CheckMissing       = "missing"
+	CheckExtra         = "extra"
+	CheckType          = "type"
+	CheckSize          = "size"
+	CheckMd5           = "md5"
+	CheckDuplicate     = "duplicate"
+	CheckNotComparable = "not-comparable"
+)
+
+type CheckArgs struct {
+	Path   string
+	RootId string
+}
+
+// A difference between a local file and the drive copy
+type CheckDiff struct {
+	// One of the Check constants
+	Status string
+	// Path relative to the compared directories
+	Path string
+	// Absolute path of the local file, empty if the file only exists in drive
+	AbsPath string
+	// Id and type of the remote file, empty if the file only exists locally
+	Id   string
+	Type string
+	// Sizes are only set for files and not for directories
+	LocalSize  int64
+	RemoteSize int64
+	Md5        string
+}
+
+type checkDiff struct {
+	status string
+	path   string
+	local  *LocalFile
+	remote *RemoteFile
+}
+
+// Compares a local directory with a drive directory and returns the differences sorted by path
+func (self *Drive) Check(ctx context.Context, args CheckArgs) ([]*CheckDiff, error) {
+	self = self.withContext(ctx)
+
+	rootDir, err := self.store.GetFile(self.ctx, args.RootId, "id", "name", "mimeType", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	if !isDir(rootDir) {
+		return nil, fmt.Errorf("'%s' is not a directory", rootDir.Name)
+	}
+
+	// Files ignored by the ignore file are left out on both sides
+	exclude, err := self.prepareSyncExcluder(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	localFiles, err := prepareLocalFiles(args.Path, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	descendants, err := self.listDescendants(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Duplicate paths are reported as differences instead of failing the check
+	if err = self.decryptNames(descendants); err != nil {
+		return nil, err
+	}
+
+	remoteFiles, err := relativeRemoteFiles(rootDir, descendants)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteFiles, err = filterRemoteFiles(remoteFiles, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*CheckDiff
+	for _, d := range compareFiles(localFiles, remoteFiles) {
+		diffs = append(diffs, d.export())
+	}
+
+	return diffs, nil
+}
+
+// Returns the differences between the local and remote files sorted by path
+func compareFiles(localFiles []*LocalFile, remoteFiles []*RemoteFile) []*checkDiff {
+	remoteLookup := map[string][]*RemoteFile{}
+	for _, rf := range remoteFiles {
+		remoteLookup[rf.relPath] = append(remoteLookup[rf.relPath], rf)
+	}
+
+	var diffs []*checkDiff
+
+	for _, lf := range localFiles {
+		matches := remoteLookup[lf.relPath]
+		delete(remoteLookup, lf.relPath)
+
+		// Drive allows several files with the same name in a directory,
+		// there is no telling which of them is the copy of the local file
+		if len(matches) > 1 {
+			diffs = append(diffs, duplicateDiffs(lf, matches)...)
+			continue
+		}
+
+		var rf *RemoteFile
+		if len(matches) == 1 {
+			rf = matches[0]
+		}
+
+		if status := compareFile(lf, rf); status != "" {
+			diffs = append(diffs, &checkDiff{status: status, path: lf.relPath, local: lf, remote: rf})
+		}
+	}
+
+	// The remaining remote files does not exist locally
+	for _, matches := range remoteLookup {
+		if len(matches) > 1 {
+			diffs = append(diffs, duplicateDiffs(nil, matches)...)
+			continue
+		}
+		diffs = append(diffs, &checkDiff{status: CheckExtra, path: matches[0].relPath, remote: matches[0]})
+	}
+
+	sort.Sort(byDiffPath(diffs))
+	return diffs
+}
+
+// Returns one difference for each of the remote files with the same path
+func duplicateDiffs(lf *LocalFile, duplicates []*RemoteFile) []*checkDiff {
+	var diffs []*checkDiff
+	for _, rf := range duplicates {
+		diffs = append(diffs, &checkDiff{status: CheckDuplicate, path: rf.relPath, local: lf, remote: rf})
+	}
+	return diffs
+}
+
+// Returns how the local file differs from the remote file, or an empty string if they are equal
+func compareFile(lf *LocalFile, rf *RemoteFile) string {
+	if rf == nil {
+		return CheckMissing
+	}
+
+	if lf.info.IsDir() != isDir(rf.file) {
+		return CheckType
+	}
+
+	if lf.info.IsDir() {
+		return ""
+	}
+
+	// Documents have no checksum, and their size is not the size of any local file
+	if rf.Md5() == "" {
+		return CheckNotComparable
+	}
+
+	if lf.Size() != rf.Size() {
+		return CheckSize
+	}
+
+	if util.Md5sum(lf.absPath) != rf.Md5() {
+		return CheckMd5
+	}
+
+	return ""
+}
+
+func (self *checkDiff) export() *CheckDiff {
+	d := &CheckDiff{Status: self.status, Path: self.path}
+
+	if self.local != nil {
+		d.AbsPath = self.local.absPath
+		if !self.local.info.IsDir() {
+			d.LocalSize = self.local.Size()
+		}
+	}
+
+	if self.remote != nil {
+		d.Id = self.remote.file.Id
+		d.Type = FileType(self.remote.file)
+		d.Md5 = self.remote.Md5()
+		if !isDir(self.remote.file) {
+			d.RemoteSize = self.remote.Size()
+		}
+	}
+
+	return d
+}
+
+type byDiffPath []*checkDiff
+
+func (self byDiffPath) Len() int {
+	return len(self)
+}
+
+func (self byDiffPath) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+
+// Duplicates have the same path and are sorted by id
+func (self byDiffPath) Less(i, j int) bool {
+	a, b := filepath.ToSlash(self[i].path), filepath.ToSlash(self[j].path)
+	if a != b {
+		return a < b
+	}
+	return self[i].remote != nil && self[j].remote != nil && self[i].remote.file.Id < self[j].remote.file.Id
+}
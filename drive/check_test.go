@@ -0,0 +1,157 @@
+package drive_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grandeto/gdrive/constants"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Serves a fixed tree of drive files. Files are listed by
+// the parent in the query and can be fetched by id
+type fileServer struct {
+	files []*drive.File
+}
+
+var parentQuery = regexp.MustCompile(`'([^']+)' in parents`)
+
+func (self *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/drive/v3/files"), "/")
+
+	if id == "" {
+		match := parentQuery.FindStringSubmatch(r.URL.Query().Get("q"))
+		list := &drive.FileList{Files: []*drive.File{}}
+		for _, f := range self.files {
+			if match != nil && len(f.Parents) > 0 && f.Parents[0] == match[1] {
+				list.Files = append(list.Files, f)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	for _, f := range self.files {
+		if f.Id == id {
+			json.NewEncoder(w).Encode(f)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error": {"code": 404, "message": "File not found", "errors": [{"reason": "notFound"}]}}`))
+}
+
+// Sends all requests to the handler instead of drive
+type redirectTransport struct {
+	url *url.URL
+}
+
+func (self *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = self.url.Scheme
+	req.URL.Host = self.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Returns a client that sends its requests to the handler and doesn't retry failed requests
+func newHandlerClient(t *testing.T, handler http.Handler) *gdrive.Drive {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := gdrive.New(&http.Client{Transport: &redirectTransport{url: serverUrl}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(gdrive.RetryPolicy{Retries: 0, MaxBackoff: time.Millisecond})
+	return client
+}
+
+func newRemoteFile(id, name, parentId, mimeType, content string) *drive.File {
+	f := &drive.File{Id: id, Name: name, MimeType: mimeType, Parents: []string{parentId}}
+	if mimeType == "" {
+		sum := md5.Sum([]byte(content))
+		f.Md5Checksum = hex.EncodeToString(sum[:])
+		f.Size = int64(len(content))
+	}
+	return f
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "equal.txt"), "content")
+	writeFile(t, filepath.Join(dir, "md5.txt"), "content")
+	writeFile(t, filepath.Join(dir, "size.txt"), "content")
+	writeFile(t, filepath.Join(dir, "missing.txt"), "content")
+	writeFile(t, filepath.Join(dir, "type", "file.txt"), "content")
+	writeFile(t, filepath.Join(dir, "dir", "file.txt"), "content")
+	writeFile(t, filepath.Join(dir, "document"), "content")
+	writeFile(t, filepath.Join(dir, "duplicate.txt"), "content")
+
+	server := &fileServer{files: []*drive.File{
+		newRemoteFile("root", "check", "", constants.DirectoryMimeType, ""),
+		newRemoteFile("equal", "equal.txt", "root", "", "content"),
+		newRemoteFile("md5", "md5.txt", "root", "", "CONTENT"),
+		newRemoteFile("size", "size.txt", "root", "", "other content"),
+		newRemoteFile("extra", "extra.txt", "root", "", "content"),
+		newRemoteFile("type", "type", "root", "", "content"),
+		newRemoteFile("dir", "dir", "root", constants.DirectoryMimeType, ""),
+		newRemoteFile("file", "file.txt", "dir", "", "content"),
+		newRemoteFile("document", "document", "root", "application/vnd.google-apps.document", ""),
+		newRemoteFile("duplicate2", "duplicate.txt", "root", "", "content"),
+		newRemoteFile("duplicate1", "duplicate.txt", "root", "", "content"),
+	}}
+
+	diffs, err := newHandlerClient(t, server).Check(context.Background(), gdrive.CheckArgs{Path: dir, RootId: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []string
+	for _, d := range diffs {
+		statuses = append(statuses, d.Path+" "+d.Status+" "+d.Id)
+	}
+
+	expected := []string{
+		"document not-comparable document",
+		"duplicate.txt duplicate duplicate1",
+		"duplicate.txt duplicate duplicate2",
+		"extra.txt extra extra",
+		"md5.txt md5 md5",
+		"missing.txt missing ",
+		"size.txt size size",
+		"type type type",
+		"type/file.txt missing ",
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected the differences %q, got %q", expected, statuses)
+	}
+}
@@ -0,0 +1,94 @@
+package drive
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Calculates the md5, sha256 and size of the data written to it,
+// used to hash transfers inline while the data is streamed
+type checksumWriter struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	size   int64
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+func (self *checksumWriter) Write(p []byte) (int, error) {
+	self.md5.Write(p)
+	self.sha256.Write(p)
+	self.size += int64(len(p))
+	return len(p), nil
+}
+
+func (self *checksumWriter) Md5() string {
+	return fmt.Sprintf("%x", self.md5.Sum(nil))
+}
+
+func (self *checksumWriter) Sha256() string {
+	return fmt.Sprintf("%x", self.sha256.Sum(nil))
+}
+
+// Compares the hashed data with the given checksums, empty checksums are not compared
+func (self *checksumWriter) verify(md5, sha256 string) error {
+	if md5 != "" && md5 != self.Md5() {
+		return fmt.Errorf("md5 checksum %s does not match %s", self.Md5(), md5)
+	}
+
+	if sha256 != "" && sha256 != self.Sha256() {
+		return fmt.Errorf("sha256 checksum %s does not match %s", self.Sha256(), sha256)
+	}
+
+	return nil
+}
+
+// Compares the hashed data with the checksums drive calculated for the uploaded file
+func (self *checksumWriter) verifyUpload(f *drive.File) error {
+	if err := self.verify(f.Md5Checksum, f.Sha256Checksum); err != nil {
+		return fmt.Errorf("Uploaded file %s is corrupt, %s", f.Id, err)
+	}
+	return nil
+}
+
+// Hashes the first n bytes of the file, used to include data
+// downloaded by an earlier attempt in the checksum
+func hashFilePrefix(w io.Writer, path string, n int64) error {
+	if n == 0 {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open file: %s", err)
+	}
+	defer f.Close()
+
+	if _, err = io.CopyN(w, f, n); err != nil {
+		return fmt.Errorf("Failed to read file: %s", err)
+	}
+
+	return nil
+}
+
+// Writes the md5 checksum of the file to <file>.md5, in the format used by md5sum
+func writeMd5File(fpath, md5 string) error {
+	content := fmt.Sprintf("%s  %s\n", md5, filepath.Base(fpath))
+	if err := ioutil.WriteFile(fpath+".md5", []byte(content), 0666); err != nil {
+		return fmt.Errorf("Failed to write md5 file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package drive
+
+import (
+	"fmt"
+
+	"github.com/grandeto/gdrive/constants"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+type CopyArgs struct {
+	Id        string
+	Parent    string
+	Name      string
+	Recursive bool
+}
+
+type CopyResult struct {
+	// The copied file
+	Source *drive.File
+	// The directory the copy was placed in
+	Parent *drive.File
+	// The copy
+	File *drive.File
+}
+
+func (self *Drive) Copy(ctx context.Context, args CopyArgs) (*CopyResult, error) {
+	self = self.withContext(ctx)
+
+	src, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "mimeType", "parents", "appProperties", "description", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	if isDir(src) && !args.Recursive {
+		return nil, fmt.Errorf("'%s' is a directory, use the 'recursive' flag to copy directories", src.Name)
+	}
+
+	parent, err := self.getParentDir(args.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	name := args.Name
+	if name == "" {
+		name = src.Name
+	}
+
+	// Copies placed in a sync directory are tagged with the sync root of the directory
+	rootId := syncRootIdOf(parent)
+	if rootId != "" {
+		if err = self.ensureCanPlaceInSyncRoot(src, parent, name); err != nil {
+			return nil, err
+		}
+	}
+
+	var f *drive.File
+	if isDir(src) {
+		f, err = self.copyDir(src, parent.Id, name, rootId)
+	} else {
+		f, err = self.copyFile(src, parent.Id, name, rootId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &CopyResult{Source: src, Parent: parent, File: f}, nil
+}
+
+func (self *Drive) copyFile(src *drive.File, parentId, name, rootId string) (*drive.File, error) {
+	dstFile := &drive.File{
+		Name:    name,
+		Parents: []string{parentId},
+	}
+
+	// The copy gets the app properties of the source, which must match the new location
+	setSyncProperties(dstFile, rootId)
+
+	f, err := self.service.Files.Copy(src.Id, dstFile).SupportsAllDrives(true).Fields("id", "name").Context(self.ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy '%s': %s", src.Name, err)
+	}
+
+	return f, nil
+}
+
+// Drive can't copy directories, so the directory is created and the content is copied one by one
+func (self *Drive) copyDir(src *drive.File, parentId, name, rootId string) (*drive.File, error) {
+	dstFile := &drive.File{
+		Name:        name,
+		Description: src.Description,
+		MimeType:    constants.DirectoryMimeType,
+		Parents:     []string{parentId},
+	}
+
+	// A copy of a sync root is a new sync root
+	if isSyncRoot(src) {
+		dstFile.AppProperties = map[string]string{"sync": "true", "syncRoot": "true"}
+	} else if rootId != "" {
+		dstFile.AppProperties = map[string]string{"sync": "true", "syncRootId": rootId}
+	}
+
+	dir, err := self.store.CreateFile(self.ctx, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id", "name"}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create directory: %s", err)
+	}
+
+	if isSyncRoot(src) {
+		rootId = dir.Id
+	}
+
+	listArgs := listAllFilesArgs{
+		query:   fmt.Sprintf("'%s' in parents and trashed = false", src.Id),
+		fields:  []googleapi.Field{"nextPageToken", "files(id,name,mimeType,appProperties,description,driveId)"},
+		driveId: src.DriveId,
+	}
+	children, err := self.listAllFiles(listArgs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing files: %s", err)
+	}
+
+	for _, child := range children {
+		if isDir(child) {
+			_, err = self.copyDir(child, dir.Id, child.Name, rootId)
+		} else {
+			_, err = self.copyFile(child, dir.Id, child.Name, rootId)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dir, nil
+}
+
+func (self *Drive) getParentDir(id string) (*drive.File, error) {
+	parent, err := self.store.GetFile(self.ctx, id, "id", "name", "mimeType", "appProperties", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get parent directory: %s", err)
+	}
+
+	if !isDir(parent) {
+		return nil, fmt.Errorf("Parent '%s' is not a directory", parent.Name)
+	}
+
+	return parent, nil
+}
+
+// Ensures that a file can be placed in the sync directory parent without breaking the sync root
+func (self *Drive) ensureCanPlaceInSyncRoot(f, parent *drive.File, name string) error {
+	if err := ensureNoSyncRoots([]*drive.File{f}); err != nil {
+		return err
+	}
+
+	if isDir(f) {
+		descendants, err := self.listDescendants(f)
+		if err != nil {
+			return err
+		}
+
+		if err = ensureNoSyncRoots(descendants); err != nil {
+			return err
+		}
+	}
+
+	return self.ensureUniqueSyncName(parent, name)
+}
@@ -0,0 +1,202 @@
+package drive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/grandeto/gdrive/crypt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// App properties used to tag encrypted files. The md5 and size of the
+// plaintext is stored as the checksum of the remote file is of the ciphertext
+const (
+	encryptedProperty     = "encrypted"
+	encryptedNameProperty = "encryptedName"
+	plainMd5Property      = "plainMd5"
+	plainSizeProperty     = "plainSize"
+)
+
+var cryptPropertyKeys = []string{encryptedProperty, encryptedNameProperty, plainMd5Property, plainSizeProperty}
+
+// Mime type of encrypted files
+const encryptedMimeType = "application/octet-stream"
+
+// Suffix of encrypted files that are downloaded but not yet decrypted
+const encryptedSuffix = ".encrypted"
+
+// Encrypts uploaded files and decrypts downloaded files with the given cipher,
+// file names are only encrypted if encryptNames is true
+func (self *Drive) SetCipher(cipher *crypt.Cipher, encryptNames bool) {
+	self.cipher = cipher
+	self.encryptNames = encryptNames
+}
+
+func isEncrypted(f *drive.File) bool {
+	return f.AppProperties[encryptedProperty] == "true"
+}
+
+func hasEncryptedName(f *drive.File) bool {
+	return f.AppProperties[encryptedNameProperty] == "true"
+}
+
+// Ensures that a key is given if the file is encrypted
+func (self *Drive) checkCipher(f *drive.File) error {
+	if self.cipher == nil && (isEncrypted(f) || hasEncryptedName(f)) {
+		return fmt.Errorf("'%s' is encrypted, use --key-file or --passphrase to decrypt it", f.Name)
+	}
+	return nil
+}
+
+// Returns the name of the file with any encrypted name decrypted
+func (self *Drive) localName(f *drive.File) (string, error) {
+	if !hasEncryptedName(f) {
+		return f.Name, nil
+	}
+
+	if err := self.checkCipher(f); err != nil {
+		return "", err
+	}
+
+	return self.cipher.DecryptName(f.Name)
+}
+
+// Marks the file as encrypted, the md5 and size of the plaintext is stored if known
+func (self *Drive) setEncrypted(f *drive.File, md5 string, size int64) {
+	setAppProperty(f, encryptedProperty, "true")
+	f.MimeType = encryptedMimeType
+
+	if md5 != "" {
+		setAppProperty(f, plainMd5Property, md5)
+		setAppProperty(f, plainSizeProperty, strconv.FormatInt(size, 10))
+	}
+
+	self.setEncryptedName(f)
+}
+
+// Encrypts the name of the file if name encryption is enabled
+func (self *Drive) setEncryptedName(f *drive.File) {
+	if self.cipher == nil || !self.encryptNames || f.Name == "" {
+		return
+	}
+
+	f.Name = self.cipher.EncryptName(f.Name)
+	setAppProperty(f, encryptedNameProperty, "true")
+}
+
+// Removes the encryption properties that are not set on f,
+// used when the content or name of an existing file is replaced
+func clearEncrypted(f *drive.File) {
+	if f.AppProperties == nil {
+		// The empty map must be sent for the null keys to be included
+		f.AppProperties = map[string]string{}
+		f.ForceSendFields = append(f.ForceSendFields, "AppProperties")
+	}
+
+	for _, key := range cryptPropertyKeys {
+		if _, ok := f.AppProperties[key]; !ok {
+			f.NullFields = append(f.NullFields, "AppProperties."+key)
+		}
+	}
+}
+
+func setAppProperty(f *drive.File, key, value string) {
+	if f.AppProperties == nil {
+		f.AppProperties = map[string]string{}
+	}
+	f.AppProperties[key] = value
+}
+
+// Wraps the reader in an encrypting reader if a key is given
+func (self *Drive) encryptReader(r io.Reader) (io.Reader, error) {
+	if self.cipher == nil {
+		return r, nil
+	}
+
+	reader, err := self.cipher.EncryptReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encrypt file: %s", err)
+	}
+	return reader, nil
+}
+
+// Decrypts the file at src to dst and removes src. The
+// plaintext is checked against the given md5 if it is known
+func (self *Drive) decryptFile(src, dst, md5 string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Failed to open file: %s", err)
+	}
+
+	// Close file on function exit
+	defer srcFile.Close()
+
+	reader, err := self.cipher.DecryptReader(srcFile)
+	if err != nil {
+		return fmt.Errorf("Failed to decrypt '%s': %s", dst, err)
+	}
+
+	// Decrypt to tmp file
+	tmpPath := dst + incompleteSuffix
+
+	outFile, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("Unable to create new file: %s", err)
+	}
+
+	hasher := newChecksumWriter()
+	_, err = io.Copy(io.MultiWriter(outFile, hasher), reader)
+	outFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to decrypt '%s': %s", dst, err)
+	}
+
+	if err = hasher.verify(md5, ""); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Decrypted file '%s' is corrupt, %s", dst, err)
+	}
+
+	if err = os.Rename(tmpPath, dst); err != nil {
+		return fmt.Errorf("Failed saving file: %s", err)
+	}
+
+	return os.Remove(src)
+}
+
+// Decrypts the names of the files. Sync requires a key if
+// any file is encrypted, as the files can't be compared without it
+func (self *Drive) decryptNames(files []*drive.File) error {
+	for _, f := range files {
+		if err := self.checkCipher(f); err != nil {
+			return err
+		}
+
+		name, err := self.localName(f)
+		if err != nil {
+			return err
+		}
+		f.Name = name
+	}
+
+	return nil
+}
+
+// Stores the md5 and size of the plaintext of a file uploaded from a stream
+func (self *Drive) setPlainChecksum(id string, hasher *checksumWriter) error {
+	dstFile := &drive.File{
+		AppProperties: map[string]string{
+			plainMd5Property:  hasher.Md5(),
+			plainSizeProperty: strconv.FormatInt(hasher.size, 10),
+		},
+	}
+
+	_, err := self.store.UpdateFile(self.ctx, id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id"}})
+	if err != nil {
+		return fmt.Errorf("Failed to update file checksum: %s", err)
+	}
+	return nil
+}
@@ -2,36 +2,45 @@ package drive
 
 import (
 	"fmt"
-	"io"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
 )
 
 type DeleteArgs struct {
-	Out       io.Writer
 	Id        string
 	Recursive bool
+	Permanent bool
 }
 
-func (self *Drive) Delete(args DeleteArgs) error {
-	f, err := self.service.Files.Get(args.Id).Fields("name", "mimeType").Do()
+// Moves the file to trash, or deletes it permanently, and returns the file as it was before
+func (self *Drive) Delete(ctx context.Context, args DeleteArgs) (*drive.File, error) {
+	self = self.withContext(ctx)
+
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "mimeType")
 	if err != nil {
-		return fmt.Errorf("Failed to get file: %s", err)
+		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
 
 	if isDir(f) && !args.Recursive {
-		return fmt.Errorf("'%s' is a directory, use the 'recursive' flag to delete directories", f.Name)
+		return nil, fmt.Errorf("'%s' is a directory, use the 'recursive' flag to delete directories", f.Name)
 	}
 
-	err = self.service.Files.Delete(args.Id).Do()
-	if err != nil {
-		return fmt.Errorf("Failed to delete file: %s", err)
+	if !args.Permanent {
+		if err = self.trashFile(args.Id); err != nil {
+			return nil, err
+		}
+		return f, nil
 	}
 
-	fmt.Fprintf(args.Out, "Deleted '%s'\n", f.Name)
-	return nil
+	if err = self.deleteFile(args.Id); err != nil {
+		return nil, err
+	}
+
+	return f, nil
 }
 
 func (self *Drive) deleteFile(fileId string) error {
-	err := self.service.Files.Delete(fileId).Do()
+	err := self.store.DeleteFile(self.ctx, fileId)
 	if err != nil {
 		return fmt.Errorf("Failed to delete file: %s", err)
 	}
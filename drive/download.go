@@ -3,16 +3,20 @@ package drive
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 )
 
 type DownloadArgs struct {
+	// Receives progress messages, or the file content when downloading to stdout, may be nil
 	Out       io.Writer
 	Progress  io.Writer
 	Id        string
@@ -22,50 +26,48 @@ type DownloadArgs struct {
 	Recursive bool
 	Delete    bool
 	Stdout    bool
+	Md5File   bool
 	Timeout   time.Duration
 }
 
-func (self *Drive) Download(args DownloadArgs) error {
+// Downloads the file, or the files in the directory when downloading recursively
+func (self *Drive) Download(ctx context.Context, args DownloadArgs) ([]*TransferResult, error) {
+	self = self.withContext(ctx)
+	args.Out = discardIfNil(args.Out)
+
 	if args.Recursive {
-		return self.downloadRecursive(args)
+		return self.downloadRecursive(args, "")
 	}
 
-	f, err := self.service.Files.Get(args.Id).Fields("id", "name", "size", "mimeType", "md5Checksum").Do()
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "size", "mimeType", "md5Checksum", "sha256Checksum", "appProperties")
 	if err != nil {
-		return fmt.Errorf("Failed to get file: %s", err)
+		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
 
 	if isDir(f) {
-		return fmt.Errorf("'%s' is a directory, use --recursive to download directories", f.Name)
+		return nil, fmt.Errorf("'%s' is a directory, use --recursive to download directories", f.Name)
 	}
 
 	if !isBinary(f) {
-		return fmt.Errorf("'%s' is a google document and must be exported, see the export command", f.Name)
+		return nil, fmt.Errorf("'%s' is a google document and must be exported, see the export command", f.Name)
 	}
 
-	bytes, rate, err := self.downloadBinary(f, args)
+	result, err := self.downloadBinary(f, args)
 	if err != nil {
-		return err
-	}
-
-	if !args.Stdout {
-		fmt.Fprintf(args.Out, "Downloaded %s at %s/s, total %s\n", f.Id, formatSize(rate, false), formatSize(bytes, false))
+		return nil, err
 	}
 
 	if args.Delete {
 		err = self.deleteFile(args.Id)
 		if err != nil {
-			return fmt.Errorf("Failed to delete file: %s", err)
-		}
-
-		if !args.Stdout {
-			fmt.Fprintf(args.Out, "Removed %s\n", args.Id)
+			return nil, fmt.Errorf("Failed to delete file: %s", err)
 		}
 	}
-	return err
+	return []*TransferResult{result}, nil
 }
 
 type DownloadQueryArgs struct {
+	// Receives progress messages, may be nil
 	Out       io.Writer
 	Progress  io.Writer
 	Query     string
@@ -73,183 +75,437 @@ type DownloadQueryArgs struct {
 	Force     bool
 	Skip      bool
 	Recursive bool
+	Md5File   bool
 }
 
-func (self *Drive) DownloadQuery(args DownloadQueryArgs) error {
+// Downloads the files matching the query
+func (self *Drive) DownloadQuery(ctx context.Context, args DownloadQueryArgs) ([]*TransferResult, error) {
+	self = self.withContext(ctx)
+
 	listArgs := listAllFilesArgs{
 		query:  args.Query,
-		fields: []googleapi.Field{"nextPageToken", "files(id,name,mimeType,size,md5Checksum)"},
+		fields: []googleapi.Field{"nextPageToken", "files(id,name,mimeType,size,md5Checksum,sha256Checksum,appProperties)"},
 	}
 	files, err := self.listAllFiles(listArgs)
 	if err != nil {
-		return fmt.Errorf("Failed to list files: %s", err)
+		return nil, fmt.Errorf("Failed to list files: %s", err)
 	}
 
 	downloadArgs := DownloadArgs{
-		Out:      args.Out,
+		Out:      discardIfNil(args.Out),
 		Progress: args.Progress,
 		Path:     args.Path,
 		Force:    args.Force,
 		Skip:     args.Skip,
+		Md5File:  args.Md5File,
 	}
 
+	var results []*TransferResult
+
 	for _, f := range files {
-		if isDir(f) && args.Recursive {
-			err = self.downloadDirectory(f, downloadArgs)
-		} else if isBinary(f) {
-			_, _, err = self.downloadBinary(f, downloadArgs)
+		name, err := self.localName(f)
+		if err != nil {
+			return nil, err
 		}
 
-		if err != nil {
-			return err
+		// Matching files are filtered by their name
+		if self.isExcluded(remoteFilterItem(name, f)) {
+			continue
+		}
+
+		if isDir(f) && args.Recursive {
+			downloaded, err := self.downloadDirectory(f, downloadArgs, name)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, downloaded...)
+		} else if isBinary(f) {
+			result, err := self.downloadBinary(f, downloadArgs)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
 		}
 	}
 
-	return nil
+	return results, nil
 }
 
-func (self *Drive) downloadRecursive(args DownloadArgs) error {
-	f, err := self.service.Files.Get(args.Id).Fields("id", "name", "size", "mimeType", "md5Checksum").Do()
+// Downloads a file or directory, relPath is the path of the file
+// relative to the downloaded directory and is used to filter files
+func (self *Drive) downloadRecursive(args DownloadArgs, relPath string) ([]*TransferResult, error) {
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "size", "mimeType", "md5Checksum", "sha256Checksum", "appProperties")
 	if err != nil {
-		return fmt.Errorf("Failed to get file: %s", err)
+		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
 
 	if isDir(f) {
-		return self.downloadDirectory(f, args)
+		return self.downloadDirectory(f, args, relPath)
 	} else if isBinary(f) {
-		_, _, err = self.downloadBinary(f, args)
-		return err
+		result, err := self.downloadBinary(f, args)
+		if err != nil {
+			return nil, err
+		}
+		return []*TransferResult{result}, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (self *Drive) downloadBinary(f *drive.File, args DownloadArgs) (int64, int64, error) {
-	// Get timeout reader wrapper and context
-	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(args.Timeout)
+func (self *Drive) downloadBinary(f *drive.File, args DownloadArgs) (*TransferResult, error) {
+	if err := self.checkCipher(f); err != nil {
+		return nil, err
+	}
 
-	res, err := self.service.Files.Get(f.Id).Context(ctx).Download()
+	name, err := self.localName(f)
 	if err != nil {
-		if isTimeoutError(err) {
-			return 0, 0, fmt.Errorf("Failed to download file: timeout, no data was transferred for %v", args.Timeout)
-		}
-		return 0, 0, fmt.Errorf("Failed to download file: %s", err)
+		return nil, err
 	}
 
-	// Close body on function exit
-	defer res.Body.Close()
-
 	// Path to file
-	fpath := filepath.Join(args.Path, f.Name)
+	fpath := filepath.Join(args.Path, name)
 
 	if !args.Stdout {
-		fmt.Fprintf(args.Out, "Downloading %s -> %s\n", f.Name, fpath)
-	}
-
-	return self.saveFile(saveFileArgs{
-		out:           args.Out,
-		body:          timeoutReaderWrapper(res.Body),
-		contentLength: res.ContentLength,
-		fpath:         fpath,
-		force:         args.Force,
-		skip:          args.Skip,
-		stdout:        args.Stdout,
-		progress:      args.Progress,
+		fmt.Fprintf(args.Out, "Downloading %s -> %s\n", name, fpath)
+	}
+
+	result, err := self.saveFile(saveFileArgs{
+		out: args.Out,
+		download: func(ctx context.Context, offset int64) (*http.Response, error) {
+			return self.store.DownloadFile(ctx, f.Id, offset)
+		},
+		md5:      f.Md5Checksum,
+		sha256:   f.Sha256Checksum,
+		plainMd5: f.AppProperties[plainMd5Property],
+		fpath:    fpath,
+		decrypt:  isEncrypted(f),
+		force:    args.Force,
+		skip:     args.Skip,
+		stdout:   args.Stdout,
+		md5File:  args.Md5File,
+		progress: args.Progress,
+		timeout:  args.Timeout,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.File = f
+	return result, nil
 }
 
+// Suffix of files that are being downloaded
+const incompleteSuffix = ".incomplete"
+
+// Performs a download request starting at the given byte offset
+type downloadFunc func(ctx context.Context, offset int64) (*http.Response, error)
+
 type saveFileArgs struct {
-	out           io.Writer
-	body          io.Reader
-	contentLength int64
-	fpath         string
-	force         bool
-	skip          bool
-	stdout        bool
-	progress      io.Writer
+	out      io.Writer
+	download downloadFunc
+	md5      string
+	sha256   string
+	plainMd5 string
+	fpath    string
+	decrypt  bool
+	force    bool
+	skip     bool
+	stdout   bool
+	md5File  bool
+	progress io.Writer
+	timeout  time.Duration
 }
 
-func (self *Drive) saveFile(args saveFileArgs) (int64, int64, error) {
-	// Wrap response body in progress reader
-	srcReader := getProgressReader(args.body, args.progress, args.contentLength)
-
+// Saves the file to fpath, or writes it to out when writing to stdout
+func (self *Drive) saveFile(args saveFileArgs) (*TransferResult, error) {
 	if args.stdout {
-		// Write file content to stdout
-		_, err := io.Copy(args.out, srcReader)
-		return 0, 0, err
+		return self.writeStdout(args)
 	}
 
 	// Check if file exists to force
 	if !args.skip && !args.force && fileExists(args.fpath) {
-		return 0, 0, fmt.Errorf("File '%s' already exists, use --force to overwrite or --skip to skip", args.fpath)
+		return nil, fmt.Errorf("File '%s' already exists, use --force to overwrite or --skip to skip", args.fpath)
 	}
 
 	//Check if file exists to skip
 	if args.skip && fileExists(args.fpath) {
-		fmt.Printf("File '%s' already exists, skipping\n", args.fpath)
-		return 0, 0, nil
+		fmt.Fprintf(args.out, "File '%s' already exists, skipping\n", args.fpath)
+		return &TransferResult{Path: args.fpath, Skipped: true}, nil
 	}
 
+	started := time.Now()
+
+	// Encrypted files are decrypted after the download is complete
+	downloadPath := args.fpath
+	if args.decrypt {
+		downloadPath += encryptedSuffix
+	}
+
+	var bytes int64
+	var err error
+
+	for try := 0; ; try++ {
+		var n int64
+		n, err = self.downloadFile(downloadFileArgs{
+			download: args.download,
+			fpath:    downloadPath,
+			md5:      args.md5,
+			sha256:   args.sha256,
+			progress: args.progress,
+			timeout:  args.timeout,
+		})
+		bytes += n
+
+		// Retry interrupted downloads, they will continue where the last attempt stopped
+		if isDownloadInterruptedError(err) && self.retry.shouldRetry(err, try) {
+			if err = self.retry.wait(self.ctx, err, try); err != nil {
+				break
+			}
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The checksum of encrypted files is of the ciphertext
+	md5 := args.md5
+	if args.decrypt {
+		if err = self.decryptFile(downloadPath, args.fpath, args.plainMd5); err != nil {
+			return nil, err
+		}
+		md5 = args.plainMd5
+	}
+
+	if args.md5File {
+		if md5 == "" {
+			md5 = util.Md5sum(args.fpath)
+		}
+
+		if err = writeMd5File(args.fpath, md5); err != nil {
+			return nil, err
+		}
+	}
+
+	// Calculate average download rate
+	rate := calcRate(bytes, started, time.Now())
+
+	return &TransferResult{Path: args.fpath, Bytes: bytes, Rate: rate}, nil
+}
+
+func (self *Drive) writeStdout(args saveFileArgs) (*TransferResult, error) {
+	// Get timeout reader wrapper and context
+	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(self.ctx, args.timeout)
+
+	started := time.Now()
+
+	res, err := args.download(ctx, 0)
+	if err != nil {
+		return nil, self.downloadRequestError(err, args.timeout)
+	}
+
+	// Close body on function exit
+	defer res.Body.Close()
+
+	// Wrap response body in progress reader
+	srcReader := getProgressReader(timeoutReaderWrapper(self.getLimitedReader(res.Body)), args.progress, res.ContentLength)
+
+	// Hash the data as it is downloaded
+	hasher := newChecksumWriter()
+	srcReader = io.TeeReader(srcReader, hasher)
+
+	// Decrypt while writing
+	if args.decrypt {
+		srcReader, err = self.cipher.DecryptReader(srcReader)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decrypt file: %s", err)
+		}
+	}
+
+	// Write file content to stdout
+	bytes, err := io.Copy(args.out, srcReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content is already written, so a mismatch can only be reported
+	if err = hasher.verify(args.md5, args.sha256); err != nil {
+		return nil, fmt.Errorf("Downloaded file is corrupt, %s", err)
+	}
+
+	return &TransferResult{Bytes: bytes, Rate: calcRate(bytes, started, time.Now())}, nil
+}
+
+type downloadFileArgs struct {
+	download downloadFunc
+	fpath    string
+	md5      string
+	sha256   string
+	progress io.Writer
+	timeout  time.Duration
+}
+
+// Downloads file to fpath + ".incomplete" and renames it to fpath when done.
+// Data left in the incomplete file by an earlier attempt is kept and only
+// the remaining bytes are requested. The file is hashed while it is written and
+// checked against the checksums of the remote file before it is renamed.
+// Returns the number of bytes downloaded by this attempt
+func (self *Drive) downloadFile(args downloadFileArgs) (int64, error) {
 	// Ensure any parent directories exists
 	if err := mkdir(args.fpath); err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
 	// Download to tmp file
-	tmpPath := args.fpath + ".incomplete"
+	tmpPath := args.fpath + incompleteSuffix
 
-	// Create new file
-	outFile, err := os.Create(tmpPath)
+	// Open tmp file, keeping any previously downloaded data
+	outFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
-		return 0, 0, fmt.Errorf("Unable to create new file: %s", err)
+		return 0, fmt.Errorf("Unable to create new file: %s", err)
 	}
 
-	started := time.Now()
+	// Close file on function exit, errors are checked on the explicit close below
+	defer outFile.Close()
 
-	// Save file to disk
-	bytes, err := io.Copy(outFile, srcReader)
+	// Continue from the end of the previously downloaded data
+	offset, err := outFile.Seek(0, io.SeekEnd)
 	if err != nil {
-		outFile.Close()
-		os.Remove(tmpPath)
-		return 0, 0, fmt.Errorf("Failed saving file: %s", err)
+		return 0, fmt.Errorf("Failed to seek in file: %s", err)
 	}
 
-	// Calculate average download rate
-	rate := calcRate(bytes, started, time.Now())
+	// Get timeout reader wrapper and context
+	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(self.ctx, args.timeout)
+
+	// Failed requests are retried by the caller together with interrupted downloads
+	res, err := args.download(withCallerRetries(ctx), offset)
+	if err != nil && offset > 0 && isRangeNotSatisfiableError(err) {
+		// The previously downloaded data does not match the remote file, start over
+		offset = 0
+		res, err = args.download(withCallerRetries(ctx), offset)
+	}
+	if err != nil && isRetryableError(err) {
+		return 0, downloadInterruptedError{err}
+	}
+	if err != nil {
+		return 0, self.downloadRequestError(err, args.timeout)
+	}
+
+	// Close body on function exit
+	defer res.Body.Close()
+
+	// Start over if the whole file was returned instead of the requested range
+	if res.StatusCode != http.StatusPartialContent {
+		offset = 0
+	}
+
+	if err = outFile.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("Failed to truncate file: %s", err)
+	}
+
+	if _, err = outFile.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("Failed to seek in file: %s", err)
+	}
+
+	// Include the previously downloaded data in the checksum
+	hasher := newChecksumWriter()
+	if err = hashFilePrefix(hasher, tmpPath, offset); err != nil {
+		return 0, err
+	}
+
+	// Wrap response body in progress reader
+	progressReader := getProgressReader(res.Body, args.progress, res.ContentLength)
+
+	// Wrap reader in bandwidth limited reader
+	limitReader := self.getLimitedReader(progressReader)
 
-	// Close File
-	outFile.Close()
+	// Wrap reader in timeout reader
+	reader := timeoutReaderWrapper(limitReader)
+
+	// Save file to disk, hashing the data as it is written
+	bytes, err := io.Copy(io.MultiWriter(outFile, hasher), reader)
+	if err != nil {
+		if self.isTimeoutError(ctx.Err()) {
+			return bytes, fmt.Errorf("Failed to download file: timeout, no data was transferred for %v", args.timeout)
+		}
+		return bytes, downloadInterruptedError{err}
+	}
+
+	// Close file
+	if err = outFile.Close(); err != nil {
+		return bytes, fmt.Errorf("Failed saving file: %s", err)
+	}
+
+	// Ensure the downloaded file is identical to the remote file, a corrupt file is downloaded again
+	if err = hasher.verify(args.md5, args.sha256); err != nil {
+		os.Remove(tmpPath)
+		return bytes, downloadInterruptedError{fmt.Errorf("downloaded file is corrupt, %s", err)}
+	}
 
 	// Rename tmp file to proper filename
-	return bytes, rate, os.Rename(tmpPath, args.fpath)
+	return bytes, os.Rename(tmpPath, args.fpath)
+}
+
+// Requests the part of the file starting at the given offset
+func setRangeHeader(header http.Header, offset int64) {
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 }
 
-func (self *Drive) downloadDirectory(parent *drive.File, args DownloadArgs) error {
+func (self *Drive) downloadRequestError(err error, timeout time.Duration) error {
+	if self.isTimeoutError(err) {
+		return fmt.Errorf("Failed to download file: timeout, no data was transferred for %v", timeout)
+	}
+	return fmt.Errorf("Failed to download file: %s", err)
+}
+
+func (self *Drive) downloadDirectory(parent *drive.File, args DownloadArgs, relPath string) ([]*TransferResult, error) {
 	listArgs := listAllFilesArgs{
 		query:  fmt.Sprintf("'%s' in parents", parent.Id),
-		fields: []googleapi.Field{"nextPageToken", "files(id,name)"},
+		fields: []googleapi.Field{"nextPageToken", "files(id,name,mimeType,size,modifiedTime,appProperties)"},
 	}
 	files, err := self.listAllFiles(listArgs)
 	if err != nil {
-		return fmt.Errorf("Failed listing files: %s", err)
+		return nil, fmt.Errorf("Failed listing files: %s", err)
+	}
+
+	name, err := self.localName(parent)
+	if err != nil {
+		return nil, err
 	}
 
-	newPath := filepath.Join(args.Path, parent.Name)
+	newPath := filepath.Join(args.Path, name)
+
+	var results []*TransferResult
 
 	for _, f := range files {
+		fileName, err := self.localName(f)
+		if err != nil {
+			return nil, err
+		}
+
+		fileRelPath := filepath.Join(relPath, fileName)
+		if self.isExcluded(remoteFilterItem(fileRelPath, f)) {
+			continue
+		}
+
 		// Copy args and update changed fields
 		newArgs := args
 		newArgs.Path = newPath
 		newArgs.Id = f.Id
 		newArgs.Stdout = false
 
-		err = self.downloadRecursive(newArgs)
+		downloaded, err := self.downloadRecursive(newArgs, fileRelPath)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		results = append(results, downloaded...)
 	}
 
-	return nil
+	return results, nil
 }
 
 func isDir(f *drive.File) bool {
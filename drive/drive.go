@@ -1,19 +1,57 @@
 package drive
 
 import (
+	"github.com/grandeto/gdrive/crypt"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"net/http"
 )
 
 type Drive struct {
-	service *drive.Service
+	service      *drive.Service
+	store        RemoteStore
+	client       *http.Client
+	driveId      string
+	pathfinder   *remotePathfinder
+	cipher       *crypt.Cipher
+	encryptNames bool
+	bwLimiter    *bwLimiter
+	retry        *RetryPolicy
+	filter       *Filter
+	ctx          context.Context
 }
 
 func New(client *http.Client) (*Drive, error) {
+	// All requests are retried according to the same policy
+	retry := DefaultRetryPolicy()
+	client = newRetryClient(client, &retry)
+
 	service, err := drive.New(client)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Drive{service}, nil
+	return &Drive{service: service, store: &apiStore{service}, client: client, retry: &retry, ctx: context.Background()}, nil
+}
+
+// Returns a copy of the drive that makes its requests with the given context. Operations
+// start by calling this, so that the caller can cancel them through the context
+func (self *Drive) withContext(ctx context.Context) *Drive {
+	d := *self
+	d.ctx = ctx
+
+	// The copy shares the lookups cached by the pathfinder
+	if self.pathfinder != nil {
+		pathfinder := *self.pathfinder
+		pathfinder.ctx = ctx
+		d.pathfinder = &pathfinder
+	}
+
+	return &d
+}
+
+// Restricts listings and changes to the given shared drive,
+// an empty id means that the users own drive is used
+func (self *Drive) SetDriveId(driveId string) {
+	self.driveId = driveId
 }
@@ -0,0 +1,22 @@
+package drive
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Returns the shared drives the user has access to
+func (self *Drive) ListDrives(ctx context.Context) ([]*drive.Drive, error) {
+	var drives []*drive.Drive
+
+	err := self.service.Drives.List().Fields("nextPageToken", "drives(id,name,createdTime)").PageSize(100).Pages(ctx, func(dl *drive.DriveList) error {
+		drives = append(drives, dl.Drives...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list shared drives: %s", err)
+	}
+
+	return drives, nil
+}
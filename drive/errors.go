@@ -1,14 +1,22 @@
 package drive
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/googleapi"
 )
 
-func isBackendOrRateLimitError(err error) bool {
-	return isBackendError(err) || isRateLimitError(err)
+// Returns true if the request that failed with the given error can be retried
+func isRetryableError(err error) bool {
+	return isBackendError(err) || isRateLimitError(err) || isTransportError(err) || isDownloadInterruptedError(err)
 }
 
 func isBackendError(err error) bool {
@@ -20,20 +28,121 @@ func isBackendError(err error) bool {
 	return ok && ae.Code >= 500 && ae.Code <= 599
 }
 
+// Drive responds with 429, or 403 with a rate limit reason, when requests are sent too fast.
+// Other 403 errors, like insufficient permissions, will fail again if retried
 func isRateLimitError(err error) bool {
 	if err == nil {
 		return false
 	}
 
 	ae, ok := err.(*googleapi.Error)
-	return ok && ae.Code == 403
+	if !ok {
+		return false
+	}
+
+	if ae.Code == 429 {
+		return true
+	}
+
+	if ae.Code == 403 {
+		for _, item := range ae.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Drive responds with 429 or 503, or 403 with a rate limit reason, when it refuses to
+// process a request. Requests that are not idempotent can then be sent again without
+// creating duplicates
+func isRejectedError(err error) bool {
+	ae, ok := err.(*googleapi.Error)
+	return isRateLimitError(err) || (ok && ae.Code == 503)
+}
+
+// Connection resets, unexpected EOFs, DNS failures and network timeouts
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Returns the delay requested by the Retry-After header of the error response, if any
+func retryAfter(err error) (time.Duration, bool) {
+	var ae *googleapi.Error
+	if !errors.As(err, &ae) || ae.Header == nil {
+		return 0, false
+	}
+
+	value := ae.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	// The header is either a number of seconds or a date
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+
+	return 0, false
+}
+
+func isNotFoundError(err error) bool {
+	ae, ok := err.(*googleapi.Error)
+	return ok && ae.Code == 404
+}
+
+// Returned when creating a file with an id that is already taken
+func isConflictError(err error) bool {
+	ae, ok := err.(*googleapi.Error)
+	return ok && ae.Code == 409
+}
+
+func isRangeNotSatisfiableError(err error) bool {
+	ae, ok := err.(*googleapi.Error)
+	return ok && ae.Code == 416
+}
+
+// Returned when a download stops before all data is received or the received
+// data is corrupt, the download can be retried and will continue from where it stopped
+type downloadInterruptedError struct {
+	err error
+}
+
+func (self downloadInterruptedError) Error() string {
+	return fmt.Sprintf("Download was interrupted: %s", self.err)
+}
+
+func (self downloadInterruptedError) Unwrap() error {
+	return self.err
 }
 
-func isTimeoutError(err error) bool {
-	return err == context.Canceled
+func isDownloadInterruptedError(err error) bool {
+	_, ok := err.(downloadInterruptedError)
+	return ok
 }
 
-func exponentialBackoffSleep(try int) {
-	seconds := pow(2, try)
-	time.Sleep(time.Duration(seconds) * time.Second)
+// Transfers are cancelled when no data is transferred for the timeout,
+// the cancellation is only a timeout if the operation itself was not cancelled
+func (self *Drive) isTimeoutError(err error) bool {
+	return err == context.Canceled && self.ctx.Err() == nil
 }
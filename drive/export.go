@@ -2,6 +2,7 @@ package drive
 
 import (
 	"fmt"
+	"golang.org/x/net/context"
 	"io"
 	"mime"
 	"os"
@@ -17,33 +18,37 @@ var DefaultExportMime = map[string]string{
 }
 
 type ExportArgs struct {
-	Out        io.Writer
-	Id         string
-	PrintMimes bool
-	Mime       string
-	Force      bool
+	Id    string
+	Mime  string
+	Force bool
 }
 
-func (self *Drive) Export(args ExportArgs) error {
-	f, err := self.service.Files.Get(args.Id).Fields("name", "mimeType").Do()
-	if err != nil {
-		return fmt.Errorf("Failed to get file: %s", err)
-	}
+type ExportResult struct {
+	// The local file the export was saved to
+	Path string
+	// The mime type the file was exported as
+	Mime string
+}
+
+// Exports a google docs file to a local file in the current directory
+func (self *Drive) Export(ctx context.Context, args ExportArgs) (*ExportResult, error) {
+	self = self.withContext(ctx)
 
-	if args.PrintMimes {
-		return self.printMimes(args.Out, f.MimeType)
+	f, err := self.store.GetFile(self.ctx, args.Id, "name", "mimeType")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
 
 	exportMime, err := getExportMime(args.Mime, f.MimeType)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	filename := getExportFilename(f.Name, exportMime)
 
-	res, err := self.service.Files.Export(args.Id, exportMime).Download()
+	res, err := self.service.Files.Export(args.Id, exportMime).Context(self.ctx).Download()
 	if err != nil {
-		return fmt.Errorf("Failed to download file: %s", err)
+		return nil, fmt.Errorf("Failed to download file: %s", err)
 	}
 
 	// Close body on function exit
@@ -51,41 +56,45 @@ func (self *Drive) Export(args ExportArgs) error {
 
 	// Check if file exists
 	if !args.Force && fileExists(filename) {
-		return fmt.Errorf("File '%s' already exists, use --force to overwrite", filename)
+		return nil, fmt.Errorf("File '%s' already exists, use --force to overwrite", filename)
 	}
 
 	// Create new file
 	outFile, err := os.Create(filename)
 	if err != nil {
-		return fmt.Errorf("Unable to create new file '%s': %s", filename, err)
+		return nil, fmt.Errorf("Unable to create new file '%s': %s", filename, err)
 	}
 
 	// Close file on function exit
 	defer outFile.Close()
 
 	// Save file to disk
-	_, err = io.Copy(outFile, res.Body)
+	_, err = io.Copy(outFile, self.getLimitedReader(res.Body))
 	if err != nil {
-		return fmt.Errorf("Failed saving file: %s", err)
+		return nil, fmt.Errorf("Failed saving file: %s", err)
 	}
 
-	fmt.Fprintf(args.Out, "Exported '%s' with mime type: '%s'\n", filename, exportMime)
-	return nil
+	return &ExportResult{Path: filename, Mime: exportMime}, nil
 }
 
-func (self *Drive) printMimes(out io.Writer, mimeType string) error {
-	about, err := self.service.About.Get().Fields("exportFormats").Do()
+// Returns the mime types the file can be exported as
+func (self *Drive) ExportFormats(ctx context.Context, id string) ([]string, error) {
+	f, err := self.store.GetFile(ctx, id, "name", "mimeType")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	about, err := self.service.About.Get().Fields("exportFormats").Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get about: %s", err)
+		return nil, fmt.Errorf("Failed to get about: %s", err)
 	}
 
-	mimes, ok := about.ExportFormats[mimeType]
+	mimes, ok := about.ExportFormats[f.MimeType]
 	if !ok {
-		return fmt.Errorf("File with type '%s' cannot be exported", mimeType)
+		return nil, fmt.Errorf("File with type '%s' cannot be exported", f.MimeType)
 	}
 
-	fmt.Fprintf(out, "Available mime types: %s\n", formatList(mimes))
-	return nil
+	return mimes, nil
 }
 
 func getExportMime(userMime, fileMime string) (string, error) {
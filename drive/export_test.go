@@ -0,0 +1,62 @@
+package drive
+
+import (
+	"os"
+
+	"github.com/grandeto/gdrive/constants"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Returns the changed local files of the sync root by relative path, the
+// value is true if uploading the file would overwrite a remote change
+func (self *Drive) ChangedLocalFiles(ctx context.Context, localPath, rootId, stateDir string, cmp FileComparer) (map[string]bool, error) {
+	self = self.withContext(ctx)
+
+	root, err := self.getSyncRoot(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadSyncState(stateDir, root.Id, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := self.prepareSyncFiles(localPath, root, cmp, state)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, cf := range files.filterChangedLocalFiles() {
+		changed[cf.local.relPath] = cf.conflict
+	}
+	return changed, nil
+}
+
+// Resolves a conflict between the local file at absPath and the remote file
+func ResolveConflict(absPath string, remote *drive.File, resolution constants.ConflictResolution) (constants.ModTime, string, error) {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return constants.EqualModifiedTime, "", err
+	}
+
+	keep, reason := resolveConflict(&changedFile{
+		local:    &LocalFile{absPath: absPath, relPath: info.Name(), info: info},
+		remote:   &RemoteFile{relPath: info.Name(), file: remote},
+		conflict: true,
+	}, resolution)
+	return keep, reason, nil
+}
+
+// Deletes the files with batch requests and returns the error of each delete
+func (self *Drive) DeleteFilesInBatch(ctx context.Context, ids []string) []error {
+	self = self.withContext(ctx)
+
+	var calls []*batchCall
+	for _, id := range ids {
+		calls = append(calls, self.deleteFileCall(id, false))
+	}
+	return self.runBatch(calls)
+}
@@ -0,0 +1,286 @@
+package drive
+
+import (
+	"bufio"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ignore "github.com/sabhiram/go-gitignore"
+	"google.golang.org/api/drive/v3"
+)
+
+type FilterArgs struct {
+	Include    []string
+	Exclude    []string
+	FilterFrom string
+	MinSize    string
+	MaxSize    string
+	MaxAge     string
+	MimeTypes  []string
+}
+
+// Decides which files are transferred by recursive uploads, downloads and sync.
+// Files are matched against the rules in order and the first matching rule decides
+// if the file is included. Files that match no rule are excluded if there are any
+// include rules. The size, age and mime type limits only apply to files
+type Filter struct {
+	rules       []filterRule
+	hasIncludes bool
+	minSize     int64
+	maxSize     int64
+	maxAge      time.Duration
+	mimeTypes   []string
+}
+
+type filterRule struct {
+	include bool
+	matcher *ignore.GitIgnore
+}
+
+// A local or remote file that is matched against the filter
+type filterItem struct {
+	path     string
+	dir      bool
+	size     int64
+	modTime  time.Time
+	mimeType string
+}
+
+// Returns true if the file should be left out
+type excludeFunc func(filterItem) (bool, error)
+
+// Creates a filter from the given rules. The exclude rules are checked
+// first, then the include rules and then the rules of the filter file
+func NewFilter(args FilterArgs) (*Filter, error) {
+	filter := &Filter{minSize: -1, maxSize: -1}
+
+	for _, pattern := range args.Exclude {
+		filter.addRule(false, pattern)
+	}
+
+	for _, pattern := range args.Include {
+		filter.addRule(true, pattern)
+	}
+
+	if args.FilterFrom != "" {
+		if err := filter.addRulesFromFile(args.FilterFrom); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+
+	if args.MinSize != "" {
+		if filter.minSize, err = parseFilterSize(args.MinSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.MaxSize != "" {
+		if filter.maxSize, err = parseFilterSize(args.MaxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.MaxAge != "" {
+		if filter.maxAge, err = parseAge(args.MaxAge); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mimeType := range args.MimeTypes {
+		if _, err := path.Match(mimeType, ""); err != nil {
+			return nil, fmt.Errorf("Invalid mime type pattern '%s'", mimeType)
+		}
+		filter.mimeTypes = append(filter.mimeTypes, mimeType)
+	}
+
+	return filter, nil
+}
+
+func (self *Filter) addRule(include bool, pattern string) {
+	self.rules = append(self.rules, filterRule{
+		include: include,
+		matcher: ignore.CompileIgnoreLines(pattern),
+	})
+
+	if include {
+		self.hasIncludes = true
+	}
+}
+
+// Reads rules from a file with one rule per line, '+ <pattern>' includes
+// and '- <pattern>' excludes. Empty lines and lines starting with # are skipped
+func (self *Filter) addRulesFromFile(fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("Failed to open filter file: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if len(line) < 3 || (line[0] != '+' && line[0] != '-') || line[1] != ' ' {
+			return fmt.Errorf("Invalid rule '%s' on line %d of filter file, expected '+ <pattern>' or '- <pattern>'", line, n)
+		}
+
+		self.addRule(line[0] == '+', strings.TrimSpace(line[2:]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read filter file: %s", err)
+	}
+
+	return nil
+}
+
+func (self *Filter) excludes(item filterItem) bool {
+	include, matched := self.matchRules(item)
+	if matched && !include {
+		return true
+	}
+
+	// Directories are kept as they may hold included files
+	if item.dir {
+		return false
+	}
+
+	if !matched && self.hasIncludes {
+		return true
+	}
+
+	return !self.withinLimits(item)
+}
+
+// Returns if the first rule that matches the path is an include rule, and if any rule matched
+func (self *Filter) matchRules(item filterItem) (bool, bool) {
+	for _, rule := range self.rules {
+		if matchesPath(rule.matcher, item) {
+			return rule.include, true
+		}
+	}
+	return false, false
+}
+
+func (self *Filter) withinLimits(item filterItem) bool {
+	if self.minSize >= 0 && item.size < self.minSize {
+		return false
+	}
+
+	if self.maxSize >= 0 && item.size > self.maxSize {
+		return false
+	}
+
+	if self.maxAge > 0 && time.Since(item.modTime) > self.maxAge {
+		return false
+	}
+
+	return len(self.mimeTypes) == 0 || matchesMimeType(self.mimeTypes, item.mimeType)
+}
+
+// Directory patterns like 'build/' only match the content of the
+// directory, so directories are also matched with a trailing slash
+func matchesPath(matcher *ignore.GitIgnore, item filterItem) bool {
+	if matcher.MatchesPath(item.path) {
+		return true
+	}
+	return item.dir && matcher.MatchesPath(item.path+"/")
+}
+
+func matchesMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits transfers to the files that are included by the filter
+func (self *Drive) SetFilter(filter *Filter) {
+	self.filter = filter
+}
+
+// Returns true if the file is excluded by the filter
+func (self *Drive) isExcluded(item filterItem) bool {
+	return self.filter != nil && self.filter.excludes(item)
+}
+
+func localFilterItem(relPath string, info os.FileInfo) filterItem {
+	return filterItem{
+		path:     filepath.ToSlash(relPath),
+		dir:      info.IsDir(),
+		size:     info.Size(),
+		modTime:  info.ModTime(),
+		mimeType: mimeTypeByName(info.Name()),
+	}
+}
+
+// The size and mime type of encrypted files are of the plaintext
+func remoteFilterItem(relPath string, f *drive.File) filterItem {
+	rf := RemoteFile{relPath: relPath, file: f}
+
+	mimeType := f.MimeType
+	if isEncrypted(f) {
+		mimeType = mimeTypeByName(relPath)
+	}
+
+	return filterItem{
+		path:     filepath.ToSlash(relPath),
+		dir:      isDir(f),
+		size:     rf.Size(),
+		modTime:  rf.Modified(),
+		mimeType: mimeType,
+	}
+}
+
+func mimeTypeByName(name string) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+
+	// Remove parameters, i.e. the charset of text files
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	return mimeType
+}
+
+func parseFilterSize(value string) (int64, error) {
+	size, ok := parseByteSize(value)
+	if !ok {
+		return 0, fmt.Errorf("Invalid size '%s', expected bytes, i.e. 500K or 10M", value)
+	}
+	return size, nil
+}
+
+// Parses an age with a s, m, h, d or w suffix, i.e. 7d
+func parseAge(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+
+	if len(value) > 1 {
+		if unit, ok := units[value[len(value)-1]]; ok {
+			n, err := strconv.ParseFloat(value[:len(value)-1], 64)
+			if err == nil && n > 0 {
+				return time.Duration(n * float64(unit)), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid age '%s', expected a number with a s, m, h, d or w suffix, i.e. 7d", value)
+}
@@ -0,0 +1,134 @@
+package drive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/grandeto/gdrive/constants"
+	ignore "github.com/sabhiram/go-gitignore"
+)
+
+// Matches paths against the ignore files of a local directory tree. Like with
+// .gitignore, an ignore file applies to the content of the directory it is
+// placed in and its rules take precedence over the rules of parent directories.
+// Ignore files are read the first time a path in their directory is matched
+type ignorer struct {
+	root     string
+	mutex    *sync.Mutex
+	lines    map[string][]string
+	matchers map[string]*ignore.GitIgnore
+}
+
+func newIgnorer(absRootPath string) *ignorer {
+	return &ignorer{
+		root:     absRootPath,
+		mutex:    &sync.Mutex{},
+		lines:    map[string][]string{},
+		matchers: map[string]*ignore.GitIgnore{},
+	}
+}
+
+// Returns true if the file with the given path relative to the root is ignored
+func (self *ignorer) ignores(relPath string, dir bool) (bool, error) {
+	relPath = filepath.ToSlash(relPath)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	matcher, err := self.matcher(path.Dir(relPath))
+	if err != nil {
+		return false, err
+	}
+
+	// Directory patterns like 'build/' only match the content of the directory
+	return matcher.MatchesPath(relPath) || (dir && matcher.MatchesPath(relPath+"/")), nil
+}
+
+// Returns a matcher with the rules of the ignore files in dir and all its parents
+func (self *ignorer) matcher(dir string) (*ignore.GitIgnore, error) {
+	if matcher, ok := self.matchers[dir]; ok {
+		return matcher, nil
+	}
+
+	lines, err := self.ruleLines(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher := ignore.CompileIgnoreLines(lines...)
+	self.matchers[dir] = matcher
+	return matcher, nil
+}
+
+// Returns the rules that apply in dir, the rules of parent directories come first
+// so that the rules of dir take precedence
+func (self *ignorer) ruleLines(dir string) ([]string, error) {
+	if lines, ok := self.lines[dir]; ok {
+		return lines, nil
+	}
+
+	var lines []string
+	if dir != "." {
+		parentLines, err := self.ruleLines(path.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, parentLines...)
+	}
+
+	ownLines, err := readIgnoreFile(filepath.Join(self.root, filepath.FromSlash(dir), constants.DefaultIgnoreFile))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range ownLines {
+		if rule := rootIgnoreRule(dir, line); rule != "" {
+			lines = append(lines, rule)
+		}
+	}
+
+	self.lines[dir] = lines
+	return lines, nil
+}
+
+func readIgnoreFile(fpath string) ([]string, error) {
+	content, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read ignore file: %s", err)
+	}
+
+	return strings.Split(string(content), "\n"), nil
+}
+
+// Rewrites a rule of the ignore file in dir so that it matches paths relative to the root.
+// Patterns with a slash are relative to dir, other patterns match at any depth below dir
+func rootIgnoreRule(dir, line string) string {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	if dir == "." {
+		return line
+	}
+
+	negate := ""
+	if strings.HasPrefix(line, "!") {
+		negate = "!"
+		line = line[1:]
+	}
+
+	if strings.Contains(strings.TrimSuffix(line, "/"), "/") {
+		return negate + dir + "/" + strings.TrimPrefix(line, "/")
+	}
+
+	return negate + dir + "/**/" + line
+}
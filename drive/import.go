@@ -2,6 +2,7 @@ package drive
 
 import (
 	"fmt"
+	"golang.org/x/net/context"
 	"io"
 	"io/ioutil"
 	"mime"
@@ -10,45 +11,41 @@ import (
 )
 
 type ImportArgs struct {
-	Out      io.Writer
 	Mime     string
 	Progress io.Writer
 	Path     string
 	Parents  []string
 }
 
-func (self *Drive) Import(args ImportArgs) error {
+// Uploads the file and converts it to the first google docs type the mime type can be imported as
+func (self *Drive) Import(ctx context.Context, args ImportArgs) (*TransferResult, error) {
+	self = self.withContext(ctx)
+
 	fromMime := args.Mime
 	if fromMime == "" {
 		fromMime = getMimeType(args.Path)
 	}
 	if fromMime == "" {
-		return fmt.Errorf("Could not determine mime type of file, use --mime")
+		return nil, fmt.Errorf("Could not determine mime type of file, use --mime")
 	}
 
-	about, err := self.service.About.Get().Fields("importFormats").Do()
+	about, err := self.service.About.Get().Fields("importFormats").Context(self.ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get about: %s", err)
+		return nil, fmt.Errorf("Failed to get about: %s", err)
 	}
 
 	toMimes, ok := about.ImportFormats[fromMime]
 	if !ok || len(toMimes) == 0 {
-		return fmt.Errorf("Mime type '%s' is not supported for import", fromMime)
+		return nil, fmt.Errorf("Mime type '%s' is not supported for import", fromMime)
 	}
 
-	f, _, err := self.uploadFile(UploadArgs{
+	return self.uploadFile(UploadArgs{
 		Out:      ioutil.Discard,
 		Progress: args.Progress,
 		Path:     args.Path,
 		Parents:  args.Parents,
 		Mime:     toMimes[0],
 	})
-	if err != nil {
-		return err
-	}
-
-	fmt.Fprintf(args.Out, "Imported %s with mime type: '%s'\n", f.Id, toMimes[0])
-	return nil
 }
 
 func getMimeType(path string) string {
@@ -5,54 +5,55 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
-	"io"
-	"text/tabwriter"
+	"strings"
 )
 
 type ListFilesArgs struct {
-	Out         io.Writer
-	MaxFiles    int64
-	NameWidth   int64
-	Query       string
-	SortOrder   string
-	SkipHeader  bool
-	SizeInBytes bool
-	AbsPath     bool
+	MaxFiles  int64
+	Query     string
+	SortOrder string
+	AbsPath   bool
 }
 
-func (self *Drive) List(args ListFilesArgs) (err error) {
+// A file together with its absolute path in drive
+type File struct {
+	*drive.File
+	// Absolute path with a leading slash, only set when requested
+	Path string
+}
+
+func (self *Drive) List(ctx context.Context, args ListFilesArgs) ([]*File, error) {
+	self = self.withContext(ctx)
+
 	listArgs := listAllFilesArgs{
 		query:     args.Query,
-		fields:    []googleapi.Field{"nextPageToken", "files(id,name,md5Checksum,mimeType,size,createdTime,parents)"},
+		fields:    []googleapi.Field{"nextPageToken", "files(id,name,md5Checksum,mimeType,size,createdTime,modifiedTime,parents)"},
 		sortOrder: args.SortOrder,
 		maxFiles:  args.MaxFiles,
 	}
 	files, err := self.listAllFiles(listArgs)
 	if err != nil {
-		return fmt.Errorf("Failed to list files: %s", err)
+		return nil, fmt.Errorf("Failed to list files: %s", err)
 	}
 
 	pathfinder := self.newPathfinder()
 
-	if args.AbsPath {
-		// Replace name with absolute path
-		for _, f := range files {
-			f.Name, err = pathfinder.absPath(f)
+	var result []*File
+	for _, f := range files {
+		file := &File{File: f}
+
+		if args.AbsPath {
+			absPath, err := pathfinder.absPath(f)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			file.Path = formatAbsPath(absPath)
 		}
-	}
 
-	PrintFileList(PrintFileListArgs{
-		Out:         args.Out,
-		Files:       files,
-		NameWidth:   int(args.NameWidth),
-		SkipHeader:  args.SkipHeader,
-		SizeInBytes: args.SizeInBytes,
-	})
+		result = append(result, file)
+	}
 
-	return
+	return result, nil
 }
 
 type listAllFilesArgs struct {
@@ -60,6 +61,7 @@ type listAllFilesArgs struct {
 	fields    []googleapi.Field
 	sortOrder string
 	maxFiles  int64
+	driveId   string
 }
 
 func (self *Drive) listAllFiles(args listAllFilesArgs) ([]*drive.File, error) {
@@ -72,21 +74,36 @@ func (self *Drive) listAllFiles(args listAllFilesArgs) ([]*drive.File, error) {
 		pageSize = 1000
 	}
 
-	controlledStop := fmt.Errorf("Controlled stop")
+	driveId := args.driveId
+	if driveId == "" {
+		driveId = self.driveId
+	}
+
+	pageArgs := ListPageArgs{
+		Query:    args.query,
+		Fields:   args.fields,
+		OrderBy:  args.sortOrder,
+		PageSize: pageSize,
+		DriveId:  driveId,
+	}
+
+	for {
+		fl, err := self.store.ListFiles(self.ctx, pageArgs)
+		if err != nil {
+			return nil, err
+		}
 
-	err := self.service.Files.List().Q(args.query).Fields(args.fields...).OrderBy(args.sortOrder).PageSize(pageSize).Pages(context.TODO(), func(fl *drive.FileList) error {
 		files = append(files, fl.Files...)
 
 		// Stop when we have all the files we need
 		if args.maxFiles > 0 && len(files) >= int(args.maxFiles) {
-			return controlledStop
+			break
 		}
 
-		return nil
-	})
-
-	if err != nil && err != controlledStop {
-		return nil, err
+		if fl.NextPageToken == "" {
+			break
+		}
+		pageArgs.PageToken = fl.NextPageToken
 	}
 
 	if args.maxFiles > 0 {
@@ -97,36 +114,8 @@ func (self *Drive) listAllFiles(args listAllFilesArgs) ([]*drive.File, error) {
 	return files, nil
 }
 
-type PrintFileListArgs struct {
-	Out         io.Writer
-	Files       []*drive.File
-	NameWidth   int
-	SkipHeader  bool
-	SizeInBytes bool
-}
-
-func PrintFileList(args PrintFileListArgs) {
-	w := new(tabwriter.Writer)
-	w.Init(args.Out, 0, 0, 3, ' ', 0)
-
-	if !args.SkipHeader {
-		fmt.Fprintln(w, "Id\tName\tType\tSize\tCreated")
-	}
-
-	for _, f := range args.Files {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			f.Id,
-			truncateString(f.Name, args.NameWidth),
-			filetype(f),
-			formatSize(f.Size, args.SizeInBytes),
-			formatDatetime(f.CreatedTime),
-		)
-	}
-
-	w.Flush()
-}
-
-func filetype(f *drive.File) string {
+// Returns the type of the file as shown in listings: dir, bin or doc
+func FileType(f *drive.File) string {
 	if isDir(f) {
 		return "dir"
 	} else if isBinary(f) {
@@ -134,3 +123,8 @@ func filetype(f *drive.File) string {
 	}
 	return "doc"
 }
+
+// Absolute path of a file, as returned by the pathfinder, with a leading slash
+func formatAbsPath(path string) string {
+	return "/" + strings.TrimPrefix(path, "/")
+}
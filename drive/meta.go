@@ -0,0 +1,116 @@
+package drive
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// App properties used to keep track of sync directories
+var syncPropertyKeys = []string{"sync", "syncRoot", "syncRootId"}
+
+type SetMetaArgs struct {
+	Id               string
+	Description      string
+	ClearDescription bool
+	Starred          *bool
+	ReadOnly         *bool
+	ReadOnlyReason   string
+	AppProperties    map[string]string
+	Properties       map[string]string
+	Modified         time.Time
+}
+
+// Updates the given metadata and returns the file
+func (self *Drive) SetMeta(ctx context.Context, args SetMetaArgs) (*drive.File, error) {
+	self = self.withContext(ctx)
+
+	for _, key := range syncPropertyKeys {
+		if _, ok := args.AppProperties[key]; ok {
+			return nil, fmt.Errorf("App property '%s' is used by sync and can't be changed", key)
+		}
+	}
+
+	for _, key := range cryptPropertyKeys {
+		if _, ok := args.AppProperties[key]; ok {
+			return nil, fmt.Errorf("App property '%s' is used by encryption and can't be changed", key)
+		}
+	}
+
+	if args.ReadOnlyReason != "" && (args.ReadOnly == nil || !*args.ReadOnly) {
+		return nil, fmt.Errorf("A read-only reason can only be given when setting the file read-only")
+	}
+
+	dstFile := &drive.File{}
+	changed := false
+
+	if args.Description != "" {
+		dstFile.Description = args.Description
+		changed = true
+	} else if args.ClearDescription {
+		dstFile.NullFields = append(dstFile.NullFields, "Description")
+		changed = true
+	}
+
+	if args.Starred != nil {
+		dstFile.Starred = *args.Starred
+		dstFile.ForceSendFields = append(dstFile.ForceSendFields, "Starred")
+		changed = true
+	}
+
+	if args.ReadOnly != nil {
+		dstFile.ContentRestrictions = []*drive.ContentRestriction{{
+			ReadOnly:        *args.ReadOnly,
+			Reason:          args.ReadOnlyReason,
+			ForceSendFields: []string{"ReadOnly"},
+		}}
+		changed = true
+	}
+
+	if len(args.AppProperties) > 0 {
+		dstFile.AppProperties = setProperties(dstFile, "AppProperties", args.AppProperties)
+		changed = true
+	}
+
+	if len(args.Properties) > 0 {
+		dstFile.Properties = setProperties(dstFile, "Properties", args.Properties)
+		changed = true
+	}
+
+	if !args.Modified.IsZero() {
+		dstFile.ModifiedTime = args.Modified.UTC().Format(time.RFC3339Nano)
+		changed = true
+	}
+
+	if !changed {
+		return nil, fmt.Errorf("Nothing to update")
+	}
+
+	f, err := self.store.UpdateFile(self.ctx, args.Id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id", "name"}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update file metadata: %s", err)
+	}
+
+	return f, nil
+}
+
+// Returns the properties to send for the given property field,
+// properties with an empty value are removed from the file
+func setProperties(f *drive.File, field string, properties map[string]string) map[string]string {
+	values := map[string]string{}
+
+	for key, value := range properties {
+		if value == "" {
+			f.NullFields = append(f.NullFields, field+"."+key)
+			continue
+		}
+		values[key] = value
+	}
+
+	// The map must be sent for the null keys to be included
+	f.ForceSendFields = append(f.ForceSendFields, field)
+	return values
+}
@@ -2,26 +2,21 @@ package drive
 
 import (
 	"fmt"
-	"io"
 
 	"github.com/grandeto/gdrive/constants"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 )
 
 type MkdirArgs struct {
-	Out         io.Writer
 	Name        string
 	Description string
 	Parents     []string
 }
 
-func (self *Drive) Mkdir(args MkdirArgs) error {
-	f, err := self.mkdir(args)
-	if err != nil {
-		return err
-	}
-	fmt.Fprintf(args.Out, "Directory %s created\n", f.Id)
-	return nil
+// Creates the directory and returns it
+func (self *Drive) Mkdir(ctx context.Context, args MkdirArgs) (*drive.File, error) {
+	return self.withContext(ctx).mkdir(args)
 }
 
 func (self *Drive) mkdir(args MkdirArgs) (*drive.File, error) {
@@ -34,8 +29,11 @@ func (self *Drive) mkdir(args MkdirArgs) (*drive.File, error) {
 	// Set parent folders
 	dstFile.Parents = args.Parents
 
+	// Encrypt name if name encryption is enabled
+	self.setEncryptedName(dstFile)
+
 	// Create directory
-	f, err := self.service.Files.Create(dstFile).Do()
+	f, err := self.store.CreateFile(self.ctx, WriteFileArgs{File: dstFile})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create directory: %s", err)
 	}
@@ -0,0 +1,95 @@
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+type MoveArgs struct {
+	Id     string
+	Parent string
+}
+
+type MoveResult struct {
+	// The moved file, as it was before the move
+	File *drive.File
+	// The directory the file was moved to
+	Parent *drive.File
+}
+
+func (self *Drive) Move(ctx context.Context, args MoveArgs) (*MoveResult, error) {
+	self = self.withContext(ctx)
+
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "mimeType", "parents", "appProperties", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	parent, err := self.getParentDir(args.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	srcRootId := syncRootIdOf(f)
+	dstRootId := syncRootIdOf(parent)
+
+	// A sync root keeps its properties, it just can't be moved into another sync root
+	if isSyncRoot(f) {
+		srcRootId = dstRootId
+	}
+
+	if dstRootId != "" {
+		if err = self.ensureCanPlaceInSyncRoot(f, parent, f.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sync properties must be updated when the file is moved into, out of or between sync roots
+	fixSyncProperties := srcRootId != dstRootId
+
+	dstFile := &drive.File{}
+	if fixSyncProperties {
+		setSyncProperties(dstFile, dstRootId)
+	}
+
+	_, err = self.store.UpdateFile(self.ctx, f.Id, WriteFileArgs{
+		File:          dstFile,
+		Fields:        []googleapi.Field{"id"},
+		AddParents:    parent.Id,
+		RemoveParents: strings.Join(f.Parents, ","),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to move file: %s", err)
+	}
+
+	if fixSyncProperties && isDir(f) {
+		if err = self.setSyncPropertiesRecursive(f, dstRootId); err != nil {
+			return nil, err
+		}
+	}
+
+	return &MoveResult{File: f, Parent: parent}, nil
+}
+
+func (self *Drive) setSyncPropertiesRecursive(dir *drive.File, rootId string) error {
+	descendants, err := self.listDescendants(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range descendants {
+		dstFile := &drive.File{}
+		setSyncProperties(dstFile, rootId)
+
+		_, err = self.store.UpdateFile(self.ctx, f.Id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id"}})
+		if err != nil {
+			return fmt.Errorf("Failed to update sync properties of '%s': %s", f.Name, err)
+		}
+	}
+
+	return nil
+}
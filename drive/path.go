@@ -1,21 +1,38 @@
 package drive
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/grandeto/gdrive/crypt"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 )
 
 func (self *Drive) newPathfinder() *remotePathfinder {
 	return &remotePathfinder{
-		service: self.service.Files,
-		files:   make(map[string]*drive.File),
+		store:    self.store,
+		ctx:      self.ctx,
+		files:    make(map[string]*drive.File),
+		children: make(map[string][]*drive.File),
+		driveId:  self.driveId,
+		cipher:   self.cipher,
 	}
 }
 
 type remotePathfinder struct {
-	service *drive.FilesService
-	files   map[string]*drive.File
+	store RemoteStore
+	ctx   context.Context
+	files map[string]*drive.File
+	// Files with a given name in a directory, keyed by parent id and name
+	children map[string][]*drive.File
+	driveId  string
+	// Names are also looked up encrypted when a key is given
+	cipher *crypt.Cipher
 }
 
 func (self *remotePathfinder) absPath(f *drive.File) (string, error) {
@@ -53,7 +70,7 @@ func (self *remotePathfinder) getParent(id string) (*drive.File, error) {
 	}
 
 	// Fetch file from drive
-	f, err := self.service.Get(id).Fields("id", "name", "parents").Do()
+	f, err := self.store.GetFile(self.ctx, id, "id", "name", "parents")
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
@@ -63,3 +80,137 @@ func (self *remotePathfinder) getParent(id string) (*drive.File, error) {
 
 	return f, nil
 }
+
+// Finds the file at the given absolute path by walking down from the root directory,
+// the root is the shared drive if one is given and the users own drive otherwise
+func (self *remotePathfinder) resolve(path string) (string, error) {
+	id := "root"
+	if self.driveId != "" {
+		id = self.driveId
+	}
+
+	names := splitRemotePath(path)
+
+	for i, name := range names {
+		current := "/" + strings.Join(names[:i+1], "/")
+
+		files, err := self.getChildren(id, name)
+		if err != nil {
+			return "", err
+		}
+
+		// Only directories can be walked into
+		if i < len(names)-1 {
+			var dirs []*drive.File
+			for _, f := range files {
+				if isDir(f) {
+					dirs = append(dirs, f)
+				}
+			}
+
+			if len(files) > 0 && len(dirs) == 0 {
+				return "", fmt.Errorf("'%s' is not a directory", current)
+			}
+			files = dirs
+		}
+
+		if len(files) == 0 {
+			return "", fmt.Errorf("'%s' not found", current)
+		}
+
+		if len(files) > 1 {
+			return "", ambiguousPathError(current, files)
+		}
+
+		id = files[0].Id
+	}
+
+	return id, nil
+}
+
+func (self *remotePathfinder) getChildren(parentId, name string) ([]*drive.File, error) {
+	key := parentId + "/" + name
+
+	// Check cache
+	if files, ok := self.children[key]; ok {
+		return files, nil
+	}
+
+	query := fmt.Sprintf("name = '%s'", escapeQuery(name))
+	if self.cipher != nil {
+		query = fmt.Sprintf("(%s or name = '%s')", query, escapeQuery(self.cipher.EncryptName(name)))
+	}
+
+	pageArgs := ListPageArgs{
+		Query:   fmt.Sprintf("'%s' in parents and %s and trashed = false", parentId, query),
+		Fields:  []googleapi.Field{"nextPageToken", "files(id,name,mimeType,parents,modifiedTime)"},
+		DriveId: self.driveId,
+	}
+
+	var files []*drive.File
+	for {
+		fileList, err := self.store.ListFiles(self.ctx, pageArgs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find '%s': %s", name, err)
+		}
+
+		files = append(files, fileList.Files...)
+
+		if fileList.NextPageToken == "" {
+			break
+		}
+		pageArgs.PageToken = fileList.NextPageToken
+	}
+
+	// Save in cache
+	self.children[key] = files
+	for _, f := range files {
+		self.files[f.Id] = f
+	}
+
+	return files, nil
+}
+
+func ambiguousPathError(path string, files []*drive.File) error {
+	buffer := bytes.NewBufferString("")
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "Id\tType\tModified")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Id, FileType(f), util.FormatDatetime(f.ModifiedTime))
+	}
+	w.Flush()
+
+	return fmt.Errorf("'%s' matches %d files, use the id of one of them instead:\n\n%s", path, len(files), strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+// Paths start with a slash, anything else is a file id
+func isRemotePath(idOrPath string) bool {
+	return strings.HasPrefix(idOrPath, "/")
+}
+
+func splitRemotePath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the id of the file at the given drive path, i.e. /Backups/2026/db.
+// Values that are not paths are returned as is, as they are assumed to be ids
+func (self *Drive) ResolveId(ctx context.Context, idOrPath string) (string, error) {
+	if !isRemotePath(idOrPath) {
+		return idOrPath, nil
+	}
+
+	// Keep the pathfinder so that lookups are cached between calls
+	if self.pathfinder == nil {
+		self.pathfinder = self.newPathfinder()
+	}
+
+	return self.withContext(ctx).pathfinder.resolve(idOrPath)
+}
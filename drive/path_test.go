@@ -0,0 +1,63 @@
+package drive_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/crypt"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"github.com/grandeto/gdrive/fakedrive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+func newPathTest(t *testing.T) (*gdrive.Drive, *fakedrive.Store) {
+	store := fakedrive.NewStore()
+	client := newTestClient(t)
+	client.SetStore(store)
+	return client, store
+}
+
+func createFile(t *testing.T, store *fakedrive.Store, f *drive.File) *drive.File {
+	created, err := store.CreateFile(context.Background(), gdrive.WriteFileArgs{File: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestResolveIdListsAllPages(t *testing.T) {
+	client, store := newPathTest(t)
+
+	dir := createFile(t, store, &drive.File{Name: "dir", MimeType: constants.DirectoryMimeType, Parents: []string{fakedrive.RootId}})
+	for i := 0; i < 150; i++ {
+		createFile(t, store, &drive.File{Name: "file.txt", Parents: []string{dir.Id}})
+	}
+
+	_, err := client.ResolveId(context.Background(), "/dir/file.txt")
+	if err == nil || !strings.Contains(err.Error(), "matches 150 files") {
+		t.Fatalf("Expected all 150 files to be found, got %v", err)
+	}
+}
+
+func TestResolveIdFindsEncryptedNames(t *testing.T) {
+	client, store := newPathTest(t)
+
+	cipher, err := crypt.NewPassphraseCipher("secret", make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetCipher(cipher, true)
+
+	dir := createFile(t, store, &drive.File{Name: "dir", MimeType: constants.DirectoryMimeType, Parents: []string{fakedrive.RootId}})
+	f := createFile(t, store, &drive.File{Name: cipher.EncryptName("file.txt"), Parents: []string{dir.Id}})
+
+	id, err := client.ResolveId(context.Background(), "/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != f.Id {
+		t.Errorf("Expected %s, got %s", f.Id, id)
+	}
+}
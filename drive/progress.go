@@ -1,17 +1,19 @@
 package drive
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"time"
 
 	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
 )
 
 func getProgressReader(r io.Reader, w io.Writer, size int64) io.Reader {
 	// Don't wrap reader if output is discarded or size is too small
-	if w == ioutil.Discard || (size > 0 && size < 1024*1024) {
+	if w == nil || w == ioutil.Discard || (size > 0 && size < 1024*1024) {
 		return r
 	}
 
@@ -22,6 +24,14 @@ func getProgressReader(r io.Reader, w io.Writer, size int64) io.Reader {
 	}
 }
 
+// Output and progress writers are optional, messages written to a nil writer are discarded
+func discardIfNil(w io.Writer) io.Writer {
+	if w == nil {
+		return ioutil.Discard
+	}
+	return w
+}
+
 type Progress struct {
 	Writer       io.Writer
 	Reader       io.Reader
@@ -75,26 +85,28 @@ func (self *Progress) draw(isLast bool) {
 		return
 	}
 
-	self.clear()
+	// Build the whole line before writing it, so that the
+	// progress is drawn with a single write to the writer
+	buffer := bytes.NewBufferString(clearLine)
 
 	// Print progress
-	fmt.Fprintf(self.Writer, "%s", formatSize(self.progress, false))
+	fmt.Fprintf(buffer, "%s", util.FormatSize(self.progress, false))
 
 	// Print total size
 	if self.Size > 0 {
-		fmt.Fprintf(self.Writer, "/%s", formatSize(self.Size, false))
+		fmt.Fprintf(buffer, "/%s", util.FormatSize(self.Size, false))
 	}
 
 	// Print rate
 	if self.rate > 0 {
-		fmt.Fprintf(self.Writer, ", Rate: %s/s", formatSize(self.rate, false))
+		fmt.Fprintf(buffer, ", Rate: %s/s", util.FormatSize(self.rate, false))
 	}
 
 	if isLast {
-		self.clear()
+		buffer.WriteString(clearLine)
 	}
-}
 
-func (self *Progress) clear() {
-	fmt.Fprintf(self.Writer, "\r%50s\r", "")
+	self.Writer.Write(buffer.Bytes())
 }
+
+var clearLine = fmt.Sprintf("\r%50s\r", "")
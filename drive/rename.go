@@ -0,0 +1,58 @@
+package drive
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+type RenameArgs struct {
+	Id   string
+	Name string
+}
+
+type RenameResult struct {
+	// The renamed file
+	File *drive.File
+	// The name of the file before it was renamed
+	OldName string
+}
+
+func (self *Drive) Rename(ctx context.Context, args RenameArgs) (*RenameResult, error) {
+	self = self.withContext(ctx)
+
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "parents", "appProperties", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	// Names must stay unique within synced directories
+	if syncRootIdOf(f) != "" && !isSyncRoot(f) && len(f.Parents) > 0 && f.Name != args.Name {
+		parent, err := self.getParentDir(f.Parents[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if err = self.ensureUniqueSyncName(parent, args.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	dstFile := &drive.File{Name: args.Name}
+
+	// The new name is not encrypted
+	if hasEncryptedName(f) {
+		dstFile.AppProperties = map[string]string{}
+		dstFile.ForceSendFields = []string{"AppProperties"}
+		dstFile.NullFields = []string{"AppProperties." + encryptedNameProperty}
+	}
+
+	renamed, err := self.store.UpdateFile(self.ctx, f.Id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id", "name"}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to rename file: %s", err)
+	}
+
+	return &RenameResult{File: renamed, OldName: f.Name}, nil
+}
@@ -0,0 +1,471 @@
+package drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Http status returned by drive when a chunk is committed but the upload is not finished
+const statusResumeIncomplete = 308
+
+type resumableUploadArgs struct {
+	statePath string
+	file      *os.File
+	info      os.FileInfo
+	method    string
+	fileId    string
+	metadata  *drive.File
+	fields    []googleapi.Field
+	chunkSize int64
+	progress  io.Writer
+	timeout   time.Duration
+	// Receives the content of the file as it is committed by drive
+	hasher io.Writer
+}
+
+// Upload session persisted in the upload state file, keyed by the absolute path
+// of the local file. The size and modification time of the local file is
+// stored so that we don't resume an upload of a file that has changed since
+type uploadSession struct {
+	Uri      string `json:"uri"`
+	Target   string `json:"target"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+	Offset   int64  `json:"offset"`
+}
+
+// Uploads a local file using the resumable upload protocol. The session uri and
+// the last committed offset is saved to the state file after each chunk, which
+// allows a later run to continue the upload where the previous one stopped.
+// Each byte of the file is written to the hasher once, in order
+func (self *Drive) resumableUpload(args resumableUploadArgs) (*drive.File, error) {
+	absPath, err := filepath.Abs(args.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine absolute path: %s", err)
+	}
+
+	state := &uploadState{path: args.statePath, key: absPath}
+	size := args.info.Size()
+
+	// Get timeout reader wrapper and context
+	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(self.ctx, args.timeout)
+
+	session, offset, f, err := self.resumeUploadSession(ctx, state, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// The upload was already completed by a previous run
+	if f != nil {
+		state.remove()
+		return f, hashFilePrefix(args.hasher, args.file.Name(), size)
+	}
+
+	// Include the data sent by a previous run in the checksum
+	if err = hashFilePrefix(args.hasher, args.file.Name(), offset); err != nil {
+		return nil, err
+	}
+
+	// Read file from last committed offset
+	if _, err = args.file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Failed to seek in file: %s", err)
+	}
+
+	// Wrap file in progress reader
+	progressReader := getProgressReader(args.file, args.progress, size-offset)
+
+	// Wrap reader in timeout reader
+	reader := timeoutReaderWrapper(self.getLimitedReader(progressReader))
+
+	chunkSize := uploadChunkSize(args.chunkSize)
+
+	// Number of chunks in a row that drive did not commit any bytes of
+	stalled := 0
+
+	// Number of chunks in a row that failed to be sent
+	failed := 0
+
+	// Offset of the first byte not yet hashed
+	hashed := offset
+
+	for {
+		n := chunkSize
+		if size-offset < n {
+			n = size - offset
+		}
+
+		// Keep the data of the chunk so that the part committed by drive can be hashed
+		chunk := &bytes.Buffer{}
+		body := io.TeeReader(io.LimitReader(reader, n), chunk)
+
+		res, err := self.putUploadChunk(ctx, session.Uri, body, offset, n, size)
+		sent := err == nil
+		if sent {
+			failed = 0
+		} else {
+			// Drive may have received part of the chunk before the request failed,
+			// ask drive for the committed offset and continue from there
+			res, err = self.queryUploadOffset(ctx, session.Uri, size, err, failed)
+			if err != nil {
+				return nil, err
+			}
+			failed++
+		}
+
+		if res.StatusCode != statusResumeIncomplete {
+			f, err := decodeUploadResponse(res)
+			if err != nil {
+				return nil, err
+			}
+
+			hashChunk(args.hasher, chunk, offset, hashed, size)
+			state.remove()
+			return f, nil
+		}
+
+		res.Body.Close()
+
+		// Drive may commit fewer bytes than was sent, continue from the committed offset.
+		// How much of the file was read is unknown when the chunk failed to be sent
+		committed := committedOffset(res)
+		hashed = hashChunk(args.hasher, chunk, offset, hashed, committed)
+		if committed != offset+n || !sent {
+			if _, err = args.file.Seek(committed, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("Failed to seek in file: %s", err)
+			}
+		}
+
+		// Give up instead of sending the same chunk forever
+		if committed > offset {
+			stalled = 0
+		} else {
+			stalled++
+			if stalled > self.retry.Retries {
+				return nil, fmt.Errorf("Upload stalled, drive did not commit any bytes past offset %d in %d tries", offset, stalled)
+			}
+		}
+
+		offset = committed
+		session.Offset = offset
+		if err = state.save(session); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns a previously stored upload session, or creates a new one if there is none.
+// The offset of the first byte not yet received by drive is returned along with the session,
+// if drive already received the whole file the uploaded file is returned instead
+func (self *Drive) resumeUploadSession(ctx context.Context, state *uploadState, args resumableUploadArgs) (*uploadSession, int64, *drive.File, error) {
+	target := uploadTarget(args)
+	size := args.info.Size()
+	modified := args.info.ModTime().UnixNano()
+
+	session, err := state.load()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Only resume if the file and target is the same as for the stored session
+	if session != nil && session.Target == target && session.Size == size && session.Modified == modified {
+		res, err := self.putUploadChunk(ctx, session.Uri, nil, 0, 0, size)
+		if err == nil && res.StatusCode == statusResumeIncomplete {
+			res.Body.Close()
+			return session, committedOffset(res), nil, nil
+		}
+
+		if err == nil && res.StatusCode < 300 {
+			f, err := decodeUploadResponse(res)
+			return session, size, f, err
+		}
+
+		// The session has expired or is otherwise unusable, start a new upload
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+
+	uri, err := self.initiateUploadSession(ctx, args)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	session = &uploadSession{
+		Uri:      uri,
+		Target:   target,
+		Size:     size,
+		Modified: modified,
+	}
+
+	if err = state.save(session); err != nil {
+		return nil, 0, nil, err
+	}
+
+	return session, 0, nil, nil
+}
+
+func (self *Drive) initiateUploadSession(ctx context.Context, args resumableUploadArgs) (string, error) {
+	body, err := json.Marshal(args.metadata)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode file metadata: %s", err)
+	}
+
+	url := self.uploadUrl() + "files"
+	if args.fileId != "" {
+		url += "/" + args.fileId
+	}
+
+	query := []string{
+		"uploadType=resumable",
+		"supportsAllDrives=true",
+		"fields=" + googleapi.CombineFields(args.fields),
+	}
+	url += "?" + strings.Join(query, "&")
+
+	req, err := http.NewRequest(args.method, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create upload session: %s", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(args.info.Size(), 10))
+	if args.metadata.MimeType != "" {
+		req.Header.Set("X-Upload-Content-Type", args.metadata.MimeType)
+	}
+
+	res, err := self.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create upload session: %s", err)
+	}
+	defer res.Body.Close()
+
+	if err = googleapi.CheckResponse(res); err != nil {
+		return "", fmt.Errorf("Failed to create upload session: %s", err)
+	}
+
+	uri := res.Header.Get("Location")
+	if uri == "" {
+		return "", fmt.Errorf("Failed to create upload session: no session uri returned")
+	}
+
+	return uri, nil
+}
+
+// Waits according to the retry policy and asks drive for the number of committed bytes
+// after a chunk failed to be sent. The error is returned if the chunk should not be retried
+func (self *Drive) queryUploadOffset(ctx context.Context, uri string, size int64, err error, try int) (*http.Response, error) {
+	if ctx.Err() != nil || !self.retry.shouldRetry(err, try) {
+		return nil, err
+	}
+
+	if waitErr := self.retry.wait(ctx, err, try); waitErr != nil {
+		return nil, err
+	}
+
+	return self.putUploadChunk(ctx, uri, nil, 0, 0, size)
+}
+
+// Sends a chunk of the file to the upload session, a nil body
+// is used to query drive for the number of committed bytes
+func (self *Drive) putUploadChunk(ctx context.Context, uri string, body io.Reader, offset, length, size int64) (*http.Response, error) {
+	var contentRange string
+	if body == nil || length == 0 {
+		contentRange = fmt.Sprintf("bytes */%d", size)
+		body = bytes.NewReader(nil)
+		length = 0
+	} else {
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)
+	}
+
+	req, err := http.NewRequest("PUT", uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = length
+	req.Header.Set("Content-Range", contentRange)
+
+	res, err := self.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if self.isTimeoutError(ctx.Err()) {
+			return nil, context.Canceled
+		}
+		return nil, err
+	}
+
+	if res.StatusCode == statusResumeIncomplete {
+		return res, nil
+	}
+
+	if err = googleapi.CheckResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (self *Drive) uploadUrl() string {
+	return strings.Replace(self.service.BasePath, "/drive/v3/", "/upload/drive/v3/", 1)
+}
+
+func decodeUploadResponse(res *http.Response) (*drive.File, error) {
+	defer res.Body.Close()
+
+	f := &drive.File{}
+	if err := json.NewDecoder(res.Body).Decode(f); err != nil {
+		return nil, fmt.Errorf("Failed to decode upload response: %s", err)
+	}
+
+	return f, nil
+}
+
+// Parses the range header of a resume incomplete response, i.e. 'bytes=0-42'
+func committedOffset(res *http.Response) int64 {
+	r := res.Header.Get("Range")
+	i := strings.LastIndex(r, "-")
+	if i == -1 {
+		return 0
+	}
+
+	last, err := strconv.ParseInt(r[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return last + 1
+}
+
+// Hashes the data of the chunk starting at offset from the hashed offset up to the committed
+// offset, and returns the new hashed offset. The data after the committed offset is sent again
+func hashChunk(w io.Writer, chunk *bytes.Buffer, offset, hashed, committed int64) int64 {
+	end := committed
+	if end > offset+int64(chunk.Len()) {
+		end = offset + int64(chunk.Len())
+	}
+
+	if hashed < offset || end <= hashed {
+		return hashed
+	}
+
+	w.Write(chunk.Bytes()[hashed-offset : end-offset])
+	return end
+}
+
+// Returns a string identifying what the local file is uploaded to
+func uploadTarget(args resumableUploadArgs) string {
+	if args.fileId != "" {
+		return args.fileId
+	}
+
+	return strings.Join(args.metadata.Parents, ",") + "/" + args.metadata.Name
+}
+
+// Rounds chunk size up to a multiple of the minimum chunk size
+func uploadChunkSize(chunkSize int64) int64 {
+	if chunkSize <= 0 {
+		chunkSize = constants.DefaultUploadChunkSize
+	}
+
+	min := int64(googleapi.MinUploadChunkSize)
+	if chunkSize%min != 0 {
+		chunkSize += min - chunkSize%min
+	}
+
+	return chunkSize
+}
+
+var uploadStateMutex = &sync.Mutex{}
+
+type uploadState struct {
+	path string
+	key  string
+}
+
+func (self *uploadState) load() (*uploadSession, error) {
+	uploadStateMutex.Lock()
+	defer uploadStateMutex.Unlock()
+
+	sessions, err := self.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions[self.key], nil
+}
+
+func (self *uploadState) save(session *uploadSession) error {
+	uploadStateMutex.Lock()
+	defer uploadStateMutex.Unlock()
+
+	sessions, err := self.read()
+	if err != nil {
+		return err
+	}
+
+	sessions[self.key] = session
+	return self.write(sessions)
+}
+
+func (self *uploadState) remove() error {
+	uploadStateMutex.Lock()
+	defer uploadStateMutex.Unlock()
+
+	sessions, err := self.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := sessions[self.key]; !ok {
+		return nil
+	}
+
+	delete(sessions, self.key)
+	return self.write(sessions)
+}
+
+func (self *uploadState) read() (map[string]*uploadSession, error) {
+	sessions := map[string]*uploadSession{}
+
+	f, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read upload state: %s", err)
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("Failed to read upload state: %s", err)
+	}
+
+	return sessions, nil
+}
+
+func (self *uploadState) write(sessions map[string]*uploadSession) error {
+	if err := mkdir(self.path); err != nil {
+		return err
+	}
+
+	if err := util.WriteJson(self.path, sessions); err != nil {
+		return fmt.Errorf("Failed to save upload state: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package drive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grandeto/gdrive/constants"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// Decides how many times failed requests are retried and how long to wait between tries.
+// The policy is shared by all requests, both the api calls and the transfers
+type RetryPolicy struct {
+	Retries    int
+	MaxBackoff time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Retries:    constants.MaxErrorRetries,
+		MaxBackoff: constants.DefaultMaxBackoff * time.Second,
+	}
+}
+
+func (self *Drive) SetRetryPolicy(policy RetryPolicy) {
+	*self.retry = policy
+}
+
+// Returns true if a request that failed with the given error
+// should be retried, try is the number of retries so far
+func (self RetryPolicy) shouldRetry(err error, try int) bool {
+	return try < self.Retries && isRetryableError(err)
+}
+
+// Returns how long to wait before the next try. The delay requested by a Retry-After
+// header is honored up to the max backoff, otherwise the delay doubles for each try up
+// to the max backoff. Jitter is added so that parallel transfers don't retry at the same time
+func (self RetryPolicy) backoff(err error, try int) time.Duration {
+	if delay, ok := retryAfter(err); ok {
+		if delay > self.MaxBackoff {
+			return self.MaxBackoff
+		}
+		return delay
+	}
+
+	delay := self.MaxBackoff
+	if try < 30 && time.Second<<uint(try) < delay {
+		delay = time.Second << uint(try)
+	}
+
+	// Wait between half and all of the delay
+	return delay/2 + randomDuration(delay/2)
+}
+
+// Waits before the next try, returns early with an error if the context is done
+func (self RetryPolicy) wait(ctx context.Context, err error, try int) error {
+	timer := time.NewTimer(self.backoff(err, try))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterMutex = &sync.Mutex{}
+
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}
+
+type callerRetriesKey struct{}
+
+// Returns a context for requests that are retried by the caller. The transport leaves
+// the requests alone, so that a failed request is not retried by both the caller and the transport
+func withCallerRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerRetriesKey{}, true)
+}
+
+// Retries requests that fail with a retryable error. Requests with a body
+// that can't be read again, like streamed uploads, are retried by the caller
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    *RetryPolicy
+}
+
+func newRetryClient(client *http.Client, policy *RetryPolicy) *http.Client {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	retryClient := *client
+	retryClient.Transport = &retryTransport{transport: transport, policy: policy}
+	return &retryClient
+}
+
+func (self *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for try := 0; ; try++ {
+		res, err := self.transport.RoundTrip(req)
+
+		// Error responses are returned to the caller as is if they are not retried
+		resErr := err
+		if err == nil {
+			resErr = responseError(res)
+		}
+
+		if !self.policy.shouldRetry(resErr, try) || req.Context().Err() != nil || !rewindable(req) || !(idempotent(req, resErr) || isLibraryChunk(req)) {
+			return libraryChunkResult(req, res, err, resErr)
+		}
+
+		if res != nil {
+			res.Body.Close()
+		}
+
+		if err := self.policy.wait(req.Context(), resErr, try); err != nil {
+			return nil, err
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Chunks of resumable uploads made by the api library. The library retries chunks on its
+// own for up to 32 seconds, so they are retried by the transport according to the policy
+// instead and the library is kept from retrying them again
+func isLibraryChunk(req *http.Request) bool {
+	return req.Header.Get("X-GUploader-No-308") != "" && req.URL.Query().Get("upload_id") != ""
+}
+
+// Returns a chunk of a library upload that failed with a retryable error as an error the
+// library does not retry. Other requests and results are returned as is
+func libraryChunkResult(req *http.Request, res *http.Response, err, resErr error) (*http.Response, error) {
+	if !isLibraryChunk(req) || !isRetryableError(resErr) || req.Context().Err() != nil {
+		return res, err
+	}
+
+	if res != nil {
+		res.Body.Close()
+	}
+	return nil, uploadChunkError{resErr}
+}
+
+// The cause is hidden from the api library, which retries errors it considers temporary
+type uploadChunkError struct {
+	err error
+}
+
+func (self uploadChunkError) Error() string {
+	return fmt.Sprintf("Failed to upload chunk: %s", self.err)
+}
+
+// Returns the error of a response that may be retried, the body of
+// the response is kept so that the response can still be returned
+func responseError(res *http.Response) error {
+	if res.StatusCode != 403 && res.StatusCode != 429 && res.StatusCode < 500 {
+		return nil
+	}
+
+	err := googleapi.CheckResponse(res)
+	res.Body.Close()
+
+	body := ""
+	if ae, ok := err.(*googleapi.Error); ok {
+		body = ae.Body
+	}
+	res.Body = ioutil.NopCloser(strings.NewReader(body))
+
+	return err
+}
+
+// Requests that are not idempotent, like creating a file or a permission, may have been
+// processed even if the response was lost. They are only sent again if drive refused them
+func idempotent(req *http.Request, err error) bool {
+	if req.Context().Value(callerRetriesKey{}) != nil {
+		return false
+	}
+
+	switch req.Method {
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE":
+		return true
+	}
+
+	return isRejectedError(err)
+}
+
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// Returns a copy of the request with a new body that reads from the start
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	newReq := req.Clone(req.Context())
+	newReq.Body = body
+	return newReq, nil
+}
@@ -2,17 +2,16 @@ package drive
 
 import (
 	"fmt"
-	"io"
+	"golang.org/x/net/context"
 )
 
 type DeleteRevisionArgs struct {
-	Out        io.Writer
 	FileId     string
 	RevisionId string
 }
 
-func (self *Drive) DeleteRevision(args DeleteRevisionArgs) (err error) {
-	rev, err := self.service.Revisions.Get(args.FileId, args.RevisionId).Fields("originalFilename").Do()
+func (self *Drive) DeleteRevision(ctx context.Context, args DeleteRevisionArgs) error {
+	rev, err := self.service.Revisions.Get(args.FileId, args.RevisionId).Fields("originalFilename").Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("Failed to get revision: %s", err)
 	}
@@ -21,11 +20,10 @@ func (self *Drive) DeleteRevision(args DeleteRevisionArgs) (err error) {
 		return fmt.Errorf("Deleting revisions for this file type is not supported")
 	}
 
-	err = self.service.Revisions.Delete(args.FileId, args.RevisionId).Do()
+	err = self.service.Revisions.Delete(args.FileId, args.RevisionId).Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to delete revision", err)
+		return fmt.Errorf("Failed to delete revision: %s", err)
 	}
 
-	fmt.Fprintf(args.Out, "Deleted revision '%s'\n", args.RevisionId)
-	return
+	return nil
 }
@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"path/filepath"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
 type DownloadRevisionArgs struct {
+	// Receives progress messages, or the file content when downloading to stdout, may be nil
 	Out        io.Writer
 	Progress   io.Writer
 	FileId     string
@@ -19,32 +23,21 @@ type DownloadRevisionArgs struct {
 	Timeout    time.Duration
 }
 
-func (self *Drive) DownloadRevision(args DownloadRevisionArgs) (err error) {
+func (self *Drive) DownloadRevision(ctx context.Context, args DownloadRevisionArgs) (*TransferResult, error) {
+	self = self.withContext(ctx)
+	args.Out = discardIfNil(args.Out)
+
 	getRev := self.service.Revisions.Get(args.FileId, args.RevisionId)
 
-	rev, err := getRev.Fields("originalFilename").Do()
+	rev, err := getRev.Fields("originalFilename", "md5Checksum").Context(self.ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to get file: %s", err)
+		return nil, fmt.Errorf("Failed to get file: %s", err)
 	}
 
 	if rev.OriginalFilename == "" {
-		return fmt.Errorf("Download is not supported for this file type")
-	}
-
-	// Get timeout reader wrapper and context
-	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(args.Timeout)
-
-	res, err := getRev.Context(ctx).Download()
-	if err != nil {
-		if isTimeoutError(err) {
-			return fmt.Errorf("Failed to download file: timeout, no data was transferred for %v", args.Timeout)
-		}
-		return fmt.Errorf("Failed to download file: %s", err)
+		return nil, fmt.Errorf("Download is not supported for this file type")
 	}
 
-	// Close body on function exit
-	defer res.Body.Close()
-
 	// Discard other output if file is written to stdout
 	out := args.Out
 	if args.Stdout {
@@ -56,20 +49,18 @@ func (self *Drive) DownloadRevision(args DownloadRevisionArgs) (err error) {
 
 	fmt.Fprintf(out, "Downloading %s -> %s\n", rev.OriginalFilename, fpath)
 
-	bytes, rate, err := self.saveFile(saveFileArgs{
-		out:           args.Out,
-		body:          timeoutReaderWrapper(res.Body),
-		contentLength: res.ContentLength,
-		fpath:         fpath,
-		force:         args.Force,
-		stdout:        args.Stdout,
-		progress:      args.Progress,
+	return self.saveFile(saveFileArgs{
+		out: args.Out,
+		download: func(ctx context.Context, offset int64) (*http.Response, error) {
+			call := self.service.Revisions.Get(args.FileId, args.RevisionId)
+			setRangeHeader(call.Header(), offset)
+			return call.Context(ctx).Download()
+		},
+		md5:      rev.Md5Checksum,
+		fpath:    fpath,
+		force:    args.Force,
+		stdout:   args.Stdout,
+		progress: args.Progress,
+		timeout:  args.Timeout,
 	})
-
-	if err != nil {
-		return err
-	}
-
-	fmt.Fprintf(out, "Download complete, rate: %s/s, total size: %s\n", formatSize(rate, false), formatSize(bytes, false))
-	return nil
 }
@@ -2,13 +2,11 @@ package drive
 
 import (
 	"fmt"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
-	"io"
-	"text/tabwriter"
 )
 
 type ShareArgs struct {
-	Out          io.Writer
 	FileId       string
 	Role         string
 	Type         string
@@ -17,7 +15,14 @@ type ShareArgs struct {
 	Discoverable bool
 }
 
-func (self *Drive) Share(args ShareArgs) error {
+type ShareResult struct {
+	// The permission created on the file
+	Permission *drive.Permission
+}
+
+func (self *Drive) Share(ctx context.Context, args ShareArgs) (*ShareResult, error) {
+	self = self.withContext(ctx)
+
 	permission := &drive.Permission{
 		AllowFileDiscovery: args.Discoverable,
 		Role:               args.Role,
@@ -26,49 +31,38 @@ func (self *Drive) Share(args ShareArgs) error {
 		Domain:             args.Domain,
 	}
 
-	_, err := self.service.Permissions.Create(args.FileId, permission).Do()
+	created, err := self.service.Permissions.Create(args.FileId, permission).SupportsAllDrives(true).Context(self.ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Failed to share file: %s", err)
+		return nil, fmt.Errorf("Failed to share file: %s", err)
 	}
 
-	fmt.Fprintf(args.Out, "Granted %s permission to %s\n", args.Role, args.Type)
-	return nil
+	return &ShareResult{Permission: created}, nil
 }
 
 type RevokePermissionArgs struct {
-	Out          io.Writer
 	FileId       string
 	PermissionId string
 }
 
-func (self *Drive) RevokePermission(args RevokePermissionArgs) error {
-	err := self.service.Permissions.Delete(args.FileId, args.PermissionId).Do()
+func (self *Drive) RevokePermission(ctx context.Context, args RevokePermissionArgs) error {
+	err := self.service.Permissions.Delete(args.FileId, args.PermissionId).SupportsAllDrives(true).Context(ctx).Do()
 	if err != nil {
-		fmt.Errorf("Failed to revoke permission: %s", err)
-		return err
+		return fmt.Errorf("Failed to revoke permission: %s", err)
 	}
-
-	fmt.Fprintf(args.Out, "Permission revoked\n")
 	return nil
 }
 
 type ListPermissionsArgs struct {
-	Out    io.Writer
 	FileId string
 }
 
-func (self *Drive) ListPermissions(args ListPermissionsArgs) error {
-	permList, err := self.service.Permissions.List(args.FileId).Fields("permissions(id,role,type,domain,emailAddress,allowFileDiscovery)").Do()
+func (self *Drive) ListPermissions(ctx context.Context, args ListPermissionsArgs) ([]*drive.Permission, error) {
+	permList, err := self.service.Permissions.List(args.FileId).SupportsAllDrives(true).Fields("permissions(id,role,type,domain,emailAddress,allowFileDiscovery)").Context(ctx).Do()
 	if err != nil {
-		fmt.Errorf("Failed to list permissions: %s", err)
-		return err
+		return nil, fmt.Errorf("Failed to list permissions: %s", err)
 	}
 
-	printPermissions(printPermissionsArgs{
-		out:         args.Out,
-		permissions: permList.Permissions,
-	})
-	return nil
+	return permList.Permissions, nil
 }
 
 func (self *Drive) shareAnyoneReader(fileId string) error {
@@ -77,35 +71,10 @@ func (self *Drive) shareAnyoneReader(fileId string) error {
 		Type: "anyone",
 	}
 
-	_, err := self.service.Permissions.Create(fileId, permission).Do()
+	_, err := self.service.Permissions.Create(fileId, permission).SupportsAllDrives(true).Context(self.ctx).Do()
 	if err != nil {
 		return fmt.Errorf("Failed to share file: %s", err)
 	}
 
 	return nil
 }
-
-type printPermissionsArgs struct {
-	out         io.Writer
-	permissions []*drive.Permission
-}
-
-func printPermissions(args printPermissionsArgs) {
-	w := new(tabwriter.Writer)
-	w.Init(args.out, 0, 0, 3, ' ', 0)
-
-	fmt.Fprintln(w, "Id\tType\tRole\tEmail\tDomain\tDiscoverable")
-
-	for _, p := range args.permissions {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			p.Id,
-			p.Type,
-			p.Role,
-			p.EmailAddress,
-			p.Domain,
-			formatBool(p.AllowFileDiscovery),
-		)
-	}
-
-	w.Flush()
-}
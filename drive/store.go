@@ -0,0 +1,157 @@
+package drive
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// The file operations that listings, transfers and sync are built on. By default
+// the operations are sent to the drive api, a different store can be set to run
+// against a fake. Errors should be returned as *googleapi.Error so that they are
+// handled the same way as errors from drive, i.e. retried or reported as missing files
+type RemoteStore interface {
+	// Returns one page of the files matching the query
+	ListFiles(ctx context.Context, args ListPageArgs) (*drive.FileList, error)
+
+	GetFile(ctx context.Context, id string, fields ...googleapi.Field) (*drive.File, error)
+
+	CreateFile(ctx context.Context, args WriteFileArgs) (*drive.File, error)
+
+	// Changes the given fields of the file, and the content if media is given
+	UpdateFile(ctx context.Context, id string, args WriteFileArgs) (*drive.File, error)
+
+	DeleteFile(ctx context.Context, id string) error
+
+	// Returns the content of the file starting at the given byte offset
+	DownloadFile(ctx context.Context, id string, offset int64) (*http.Response, error)
+}
+
+type ListPageArgs struct {
+	Query     string
+	Fields    []googleapi.Field
+	OrderBy   string
+	PageSize  int64
+	PageToken string
+	DriveId   string
+}
+
+type WriteFileArgs struct {
+	File          *drive.File
+	Fields        []googleapi.Field
+	Media         io.Reader
+	MediaOptions  []googleapi.MediaOption
+	AddParents    string
+	RemoveParents string
+}
+
+// Sends file operations to the given store instead of the drive api. The other
+// calls, like permissions, revisions and changes, still use the api
+func (self *Drive) SetStore(store RemoteStore) {
+	self.store = store
+	self.pathfinder = nil
+}
+
+// Sends all api requests to the given url instead of google, i.e. a fake drive server
+func (self *Drive) SetEndpoint(endpoint string) {
+	self.service.BasePath = strings.TrimSuffix(endpoint, "/") + "/drive/v3/"
+}
+
+// Returns true if the file operations are sent to the drive api,
+// the calls can then be grouped in batch requests
+func (self *Drive) usesApiStore() bool {
+	_, ok := self.store.(*apiStore)
+	return ok
+}
+
+// Stores that know the storage quota can implement this interface,
+// the quota is otherwise requested from the drive api
+type quotaStore interface {
+	StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error)
+}
+
+func (self *Drive) storageQuota() (*drive.AboutStorageQuota, error) {
+	if store, ok := self.store.(quotaStore); ok {
+		return store.StorageQuota(self.ctx)
+	}
+
+	about, err := self.service.About.Get().Fields("storageQuota").Context(self.ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return about.StorageQuota, nil
+}
+
+// The default store, sends the file operations to the drive api
+type apiStore struct {
+	service *drive.Service
+}
+
+func (self *apiStore) ListFiles(ctx context.Context, args ListPageArgs) (*drive.FileList, error) {
+	call := self.service.Files.List().SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+	if args.DriveId != "" {
+		call = call.Corpora("drive").DriveId(args.DriveId)
+	}
+
+	call = call.Q(args.Query).Fields(args.Fields...)
+
+	if args.OrderBy != "" {
+		call = call.OrderBy(args.OrderBy)
+	}
+
+	if args.PageSize > 0 {
+		call = call.PageSize(args.PageSize)
+	}
+
+	if args.PageToken != "" {
+		call = call.PageToken(args.PageToken)
+	}
+
+	return call.Context(ctx).Do()
+}
+
+func (self *apiStore) GetFile(ctx context.Context, id string, fields ...googleapi.Field) (*drive.File, error) {
+	return self.service.Files.Get(id).SupportsAllDrives(true).Fields(fields...).Context(ctx).Do()
+}
+
+func (self *apiStore) CreateFile(ctx context.Context, args WriteFileArgs) (*drive.File, error) {
+	call := self.service.Files.Create(args.File).SupportsAllDrives(true).Fields(args.Fields...).Context(ctx)
+
+	if args.Media != nil {
+		call = call.Media(args.Media, args.MediaOptions...)
+	}
+
+	return call.Do()
+}
+
+func (self *apiStore) UpdateFile(ctx context.Context, id string, args WriteFileArgs) (*drive.File, error) {
+	call := self.service.Files.Update(id, args.File).SupportsAllDrives(true).Fields(args.Fields...).Context(ctx)
+
+	if args.AddParents != "" {
+		call = call.AddParents(args.AddParents)
+	}
+
+	if args.RemoveParents != "" {
+		call = call.RemoveParents(args.RemoveParents)
+	}
+
+	if args.Media != nil {
+		call = call.Media(args.Media, args.MediaOptions...)
+	}
+
+	return call.Do()
+}
+
+func (self *apiStore) DeleteFile(ctx context.Context, id string) error {
+	return self.service.Files.Delete(id).SupportsAllDrives(true).Context(ctx).Do()
+}
+
+func (self *apiStore) DownloadFile(ctx context.Context, id string, offset int64) (*http.Response, error) {
+	call := self.service.Files.Get(id).SupportsAllDrives(true)
+	setRangeHeader(call.Header(), offset)
+	return call.Context(ctx).Download()
+}
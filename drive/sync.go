@@ -2,21 +2,20 @@ package drive
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
 
 	"github.com/grandeto/gdrive/constants"
-	ignore "github.com/sabhiram/go-gitignore"
 	"github.com/soniakeys/graph"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 )
 
-func (self *Drive) prepareSyncFiles(localPath string, root *drive.File, cmp FileComparer) (*syncFiles, error) {
+func (self *Drive) prepareSyncFiles(localPath string, root *drive.File, cmp FileComparer, state *syncState) (*syncFiles, error) {
 	localCh := make(chan struct {
 		files []*LocalFile
 		err   error
@@ -26,8 +25,13 @@ func (self *Drive) prepareSyncFiles(localPath string, root *drive.File, cmp File
 		err   error
 	})
 
+	exclude, err := self.prepareSyncExcluder(localPath)
+	if err != nil {
+		return nil, err
+	}
+
 	go func() {
-		files, err := prepareLocalFiles(localPath)
+		files, err := prepareLocalFiles(localPath, exclude)
 		localCh <- struct {
 			files []*LocalFile
 			err   error
@@ -52,16 +56,23 @@ func (self *Drive) prepareSyncFiles(localPath string, root *drive.File, cmp File
 		return nil, remote.err
 	}
 
+	// Ignored and filtered remote files are left out just like the local files
+	remoteFiles, err := filterRemoteFiles(remote.files, exclude)
+	if err != nil {
+		return nil, err
+	}
+
 	return &syncFiles{
 		root:    &RemoteFile{file: root},
 		local:   local.files,
-		remote:  remote.files,
+		remote:  remoteFiles,
 		compare: cmp,
+		state:   state,
 	}, nil
 }
 
 func (self *Drive) isSyncFile(id string) (bool, error) {
-	f, err := self.service.Files.Get(id).Fields("appProperties").Do()
+	f, err := self.store.GetFile(self.ctx, id, "appProperties")
 	if err != nil {
 		return false, fmt.Errorf("Failed to get file: %s", err)
 	}
@@ -70,17 +81,108 @@ func (self *Drive) isSyncFile(id string) (bool, error) {
 	return ok, nil
 }
 
-func prepareLocalFiles(root string) ([]*LocalFile, error) {
-	var files []*LocalFile
+func isSyncRoot(f *drive.File) bool {
+	_, ok := f.AppProperties["syncRoot"]
+	return ok
+}
 
-	// Get absolute root path
-	absRootPath, err := filepath.Abs(root)
+// Returns the id of the sync root the file is part of, or an empty string if the file is not synced.
+// Directories that are sync roots are part of their own sync root
+func syncRootIdOf(f *drive.File) string {
+	if isSyncRoot(f) {
+		return f.Id
+	}
+	return f.AppProperties["syncRootId"]
+}
+
+// Sets the sync properties of a file that is placed in the given sync root,
+// the properties are removed if the root id is empty
+func setSyncProperties(f *drive.File, rootId string) {
+	if rootId == "" {
+		// The empty map must be sent for the null keys to be included
+		f.AppProperties = map[string]string{}
+		f.ForceSendFields = append(f.ForceSendFields, "AppProperties")
+		f.NullFields = append(f.NullFields, "AppProperties.sync", "AppProperties.syncRootId")
+		return
+	}
+
+	f.AppProperties = map[string]string{"sync": "true", "syncRootId": rootId}
+}
+
+// Returns the sync properties of a file that is created in the given sync root,
+// files are not tagged if the root id is empty
+func syncProperties(rootId string) map[string]string {
+	if rootId == "" {
+		return nil
+	}
+	return map[string]string{"sync": "true", "syncRootId": rootId}
+}
+
+// Returns all files below the given directory
+func (self *Drive) listDescendants(dir *drive.File) ([]*drive.File, error) {
+	var descendants []*drive.File
+	queue := []*drive.File{dir}
+
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		listArgs := listAllFilesArgs{
+			query:   fmt.Sprintf("'%s' in parents and trashed = false", parent.Id),
+			fields:  []googleapi.Field{"nextPageToken", "files(id,name,mimeType,parents,appProperties,description,driveId,md5Checksum,sha256Checksum,size,modifiedTime)"},
+			driveId: dir.DriveId,
+		}
+		files, err := self.listAllFiles(listArgs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed listing files: %s", err)
+		}
+
+		for _, f := range files {
+			descendants = append(descendants, f)
+			if isDir(f) {
+				queue = append(queue, f)
+			}
+		}
+	}
+
+	return descendants, nil
+}
+
+// Sync roots can't be placed inside another sync root
+func ensureNoSyncRoots(files []*drive.File) error {
+	for _, f := range files {
+		if isSyncRoot(f) {
+			return fmt.Errorf("'%s' is a sync root, sync roots can't be placed inside another sync root", f.Name)
+		}
+	}
+	return nil
+}
+
+// Sync requires unique names within a directory, ensure
+// that there is no file with the given name in the sync directory
+func (self *Drive) ensureUniqueSyncName(parent *drive.File, name string) error {
+	listArgs := listAllFilesArgs{
+		query:   fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", parent.Id, escapeQuery(name)),
+		fields:  []googleapi.Field{"nextPageToken", "files(id)"},
+		driveId: parent.DriveId,
+	}
+	files, err := self.listAllFiles(listArgs)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("Failed listing files: %s", err)
+	}
+
+	if len(files) > 0 {
+		return fmt.Errorf("'%s' already exists in sync directory '%s'", name, parent.Name)
 	}
 
-	// Prepare ignorer
-	shouldIgnore, err := prepareIgnorer(filepath.Join(absRootPath, constants.DefaultIgnoreFile))
+	return nil
+}
+
+func prepareLocalFiles(root string, exclude excludeFunc) ([]*LocalFile, error) {
+	var files []*LocalFile
+
+	// Get absolute root path
+	absRootPath, err := filepath.Abs(root)
 	if err != nil {
 		return nil, err
 	}
@@ -100,14 +202,27 @@ func prepareLocalFiles(root string) ([]*LocalFile, error) {
 			return nil
 		}
 
+		// Skip partially downloaded files
+		if strings.HasSuffix(absPath, incompleteSuffix) {
+			return nil
+		}
+
 		// Get relative path from root
 		relPath, err := filepath.Rel(absRootPath, absPath)
 		if err != nil {
 			return err
 		}
 
-		// Skip file if it is ignored by ignore file
-		if shouldIgnore(relPath) {
+		// Skip file if it is ignored or filtered out, the content of skipped directories is skipped as well
+		excluded, err := exclude(localFilterItem(relPath, info))
+		if err != nil {
+			return err
+		}
+
+		if excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -127,22 +242,92 @@ func prepareLocalFiles(root string) ([]*LocalFile, error) {
 	return files, err
 }
 
+// Removes the remote files that are ignored or filtered out, along with the content of removed directories
+func filterRemoteFiles(files []*RemoteFile, exclude excludeFunc) ([]*RemoteFile, error) {
+	// Sort files so that directories are checked before their content
+	sorted := make([]*RemoteFile, len(files))
+	copy(sorted, files)
+	sort.Sort(byRemotePathLength(sorted))
+
+	excludedDirs := map[string]bool{}
+	var included []*RemoteFile
+
+	for _, rf := range sorted {
+		excluded := excludedDirs[filepath.Dir(rf.relPath)]
+		if !excluded {
+			var err error
+			if excluded, err = exclude(remoteFilterItem(rf.relPath, rf.file)); err != nil {
+				return nil, err
+			}
+		}
+
+		if excluded {
+			if isDir(rf.file) {
+				excludedDirs[rf.relPath] = true
+			}
+			continue
+		}
+		included = append(included, rf)
+	}
+
+	return included, nil
+}
+
+// Returns a function that excludes the files ignored by the ignore files
+// of the local directory and the files left out by the filter
+func (self *Drive) prepareSyncExcluder(localRoot string) (excludeFunc, error) {
+	absRootPath, err := filepath.Abs(localRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	ignorer := newIgnorer(absRootPath)
+
+	return func(item filterItem) (bool, error) {
+		if self.isExcluded(item) {
+			return true, nil
+		}
+		return ignorer.ignores(item.path, item.dir)
+	}, nil
+}
+
 func (self *Drive) prepareRemoteFiles(rootDir *drive.File, sortOrder string) ([]*RemoteFile, error) {
+	// Mirrored directories are not tagged, so the files are found by walking the tree
+	if !isSyncRoot(rootDir) {
+		return self.prepareMirrorFiles(rootDir)
+	}
+
 	// Find all files which has rootDir as root
 	listArgs := listAllFilesArgs{
-		query:     fmt.Sprintf("appProperties has {key='syncRootId' and value='%s'}", rootDir.Id),
-		fields:    []googleapi.Field{"nextPageToken", "files(id,name,parents,md5Checksum,mimeType,size,modifiedTime)"},
+		query:     fmt.Sprintf("appProperties has {key='syncRootId' and value='%s'} and trashed = false", rootDir.Id),
+		fields:    []googleapi.Field{"nextPageToken", "files(id,name,parents,md5Checksum,sha256Checksum,mimeType,size,modifiedTime,appProperties)"},
 		sortOrder: sortOrder,
+		driveId:   rootDir.DriveId,
 	}
 	files, err := self.listAllFiles(listArgs)
 	if err != nil {
 		return nil, fmt.Errorf("Failed listing files: %s", err)
 	}
 
+	return self.newRemoteFiles(rootDir, files)
+}
+
+// Returns the files with their path relative to rootDir
+func (self *Drive) newRemoteFiles(rootDir *drive.File, files []*drive.File) ([]*RemoteFile, error) {
+	// Paths are made of the decrypted names
+	if err := self.decryptNames(files); err != nil {
+		return nil, err
+	}
+
 	if err := checkFiles(files); err != nil {
 		return nil, err
 	}
 
+	return relativeRemoteFiles(rootDir, files)
+}
+
+// Returns the files with their path relative to rootDir, the paths are not checked for duplicates
+func relativeRemoteFiles(rootDir *drive.File, files []*drive.File) ([]*RemoteFile, error) {
 	relPaths, err := prepareRemoteRelPaths(rootDir, files)
 	if err != nil {
 		return nil, err
@@ -265,8 +450,9 @@ type RemoteFile struct {
 }
 
 type changedFile struct {
-	local  *LocalFile
-	remote *RemoteFile
+	local    *LocalFile
+	remote   *RemoteFile
+	conflict bool
 }
 
 type syncFiles struct {
@@ -274,6 +460,7 @@ type syncFiles struct {
 	local   []*LocalFile
 	remote  []*RemoteFile
 	compare FileComparer
+	state   *syncState
 }
 
 type FileComparer interface {
@@ -292,11 +479,19 @@ func (self LocalFile) Modified() time.Time {
 	return self.info.ModTime()
 }
 
+// The md5 and size of encrypted files are of the plaintext
 func (self RemoteFile) Md5() string {
+	if isEncrypted(self.file) {
+		return self.file.AppProperties[plainMd5Property]
+	}
 	return self.file.Md5Checksum
 }
 
 func (self RemoteFile) Size() int64 {
+	if isEncrypted(self.file) {
+		size, _ := strconv.ParseInt(self.file.AppProperties[plainSizeProperty], 10, 64)
+		return size
+	}
 	return self.file.Size
 }
 
@@ -400,10 +595,19 @@ func (self *syncFiles) filterChangedLocalFiles() []*changedFile {
 
 		// Check if file has changed
 		if self.compare.Changed(lf, rf) {
-			files = append(files, &changedFile{
+			cf := &changedFile{
 				local:  lf,
 				remote: rf,
-			})
+			}
+
+			// Uploading the file would overwrite remote changes
+			if self.hasState() {
+				cf.conflict = self.remoteChange(rf.relPath, rf) != fileUnchanged
+			} else {
+				cf.conflict = cf.compareModTime() == constants.RemoteLastModified
+			}
+
+			files = append(files, cf)
 		}
 	}
 
@@ -427,35 +631,62 @@ func (self *syncFiles) filterChangedRemoteFiles() []*changedFile {
 
 		// Check if file has changed
 		if self.compare.Changed(lf, rf) {
-			files = append(files, &changedFile{
+			cf := &changedFile{
 				local:  lf,
 				remote: rf,
-			})
+			}
+
+			// Downloading the file would overwrite local changes
+			if self.hasState() {
+				cf.conflict = self.localChange(lf.relPath, lf) != fileUnchanged
+			} else {
+				cf.conflict = cf.compareModTime() == constants.LocalLastModified
+			}
+
+			files = append(files, cf)
 		}
 	}
 
 	return files
 }
 
+// Returns remote files that does not exist locally. When there is a sync state
+// only files that were deleted locally since the last sync are returned, files
+// created or modified on drive since the last sync are kept
 func (self *syncFiles) filterExtraneousRemoteFiles() []*RemoteFile {
 	var files []*RemoteFile
 
 	for _, rf := range self.remote {
-		if !self.existsLocal(rf) {
-			files = append(files, rf)
+		if self.existsLocal(rf) {
+			continue
+		}
+
+		if self.hasState() && (self.localChange(rf.relPath, nil) != fileDeleted || self.remoteChangedBelow(rf.relPath)) {
+			continue
 		}
+
+		files = append(files, rf)
 	}
 
 	return files
 }
 
+// Returns local files that does not exist on drive. When there is a sync state
+// only files that were deleted on drive since the last sync are returned, files
+// created or modified locally since the last sync are kept
 func (self *syncFiles) filterExtraneousLocalFiles() []*LocalFile {
 	var files []*LocalFile
 
 	for _, lf := range self.local {
-		if !self.existsRemote(lf) {
-			files = append(files, lf)
+		if self.existsRemote(lf) {
+			continue
 		}
+
+		if self.hasState() && (self.remoteChange(lf.relPath, nil) != fileDeleted || self.localChangedBelow(lf.relPath)) {
+			continue
+		}
+
+		files = append(files, lf)
 	}
 
 	return files
@@ -495,23 +726,11 @@ func (self *syncFiles) findLocalByPath(relPath string) (*LocalFile, bool) {
 	return nil, false
 }
 
-func findLocalConflicts(files []*changedFile) []*changedFile {
+func findConflicts(files []*changedFile) []*changedFile {
 	var conflicts []*changedFile
 
 	for _, cf := range files {
-		if cf.compareModTime() == constants.LocalLastModified {
-			conflicts = append(conflicts, cf)
-		}
-	}
-
-	return conflicts
-}
-
-func findRemoteConflicts(files []*changedFile) []*changedFile {
-	var conflicts []*changedFile
-
-	for _, cf := range files {
-		if cf.compareModTime() == constants.RemoteLastModified {
+		if cf.conflict {
 			conflicts = append(conflicts, cf)
 		}
 	}
@@ -560,41 +779,3 @@ func (self byRemotePath) Swap(i, j int) {
 func (self byRemotePath) Less(i, j int) bool {
 	return strings.ToLower(self[i].relPath) < strings.ToLower(self[j].relPath)
 }
-
-type ignoreFunc func(string) bool
-
-func prepareIgnorer(path string) (ignoreFunc, error) {
-	acceptAll := func(string) bool {
-		return false
-	}
-
-	if !fileExists(path) {
-		return acceptAll, nil
-	}
-
-	ignorer, err := ignore.CompileIgnoreFile(path)
-	if err != nil {
-		return acceptAll, fmt.Errorf("Failed to prepare ignorer: %s", err)
-	}
-
-	return ignorer.MatchesPath, nil
-}
-
-func formatConflicts(conflicts []*changedFile, out io.Writer) {
-	w := new(tabwriter.Writer)
-	w.Init(out, 0, 0, 3, ' ', 0)
-
-	fmt.Fprintln(w, "Path\tSize Local\tSize Remote\tModified Local\tModified Remote")
-
-	for _, cf := range conflicts {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			truncateString(cf.local.relPath, 60),
-			formatSize(cf.local.Size(), false),
-			formatSize(cf.remote.Size(), false),
-			cf.local.Modified().Local().Format("Jan _2 2006 15:04:05.000"),
-			cf.remote.Modified().Local().Format("Jan _2 2006 15:04:05.000"),
-		)
-	}
-
-	w.Flush()
-}
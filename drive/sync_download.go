@@ -1,93 +1,128 @@
 package drive
 
 import (
-	"bytes"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"time"
 
 	"github.com/grandeto/gdrive/constants"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 )
 
 type DownloadSyncArgs struct {
-	Out              io.Writer
+	// Receives the progress of the sync, may be nil
+	OnEvent          func(SyncEvent)
 	Progress         io.Writer
 	RootId           string
 	Path             string
 	DryRun           bool
 	DeleteExtraneous bool
 	Timeout          time.Duration
+	Parallel         int
+	StateDir         string
 	Resolution       constants.ConflictResolution
 	Comparer         FileComparer
+	Mirror           bool
+
+	// The changed files are recorded in the reporter if set
+	report *syncReporter
 }
 
-func (self *Drive) DownloadSync(args DownloadSyncArgs) error {
-	fmt.Fprintln(args.Out, "Starting sync...")
+// Downloads the sync root to the local directory and returns a report of the changed files
+func (self *Drive) DownloadSync(ctx context.Context, args DownloadSyncArgs) (*SyncReport, error) {
+	self = self.withContext(ctx)
+
+	// Serialize events as files may be downloaded in parallel
+	args.OnEvent, args.Progress = serializeEvents(args.OnEvent, args.Progress, args.Parallel)
+
+	args.OnEvent(SyncEvent{Kind: SyncStarted})
 	started := time.Now()
 
 	// Get remote root dir
-	rootDir, err := self.getSyncRoot(args.RootId)
+	var rootDir *drive.File
+	var err error
+	if args.Mirror {
+		rootDir, err = self.getMirrorRoot(args.RootId)
+	} else {
+		rootDir, err = self.getSyncRoot(args.RootId)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Fprintln(args.Out, "Collecting file information...")
-	files, err := self.prepareSyncFiles(args.Path, rootDir, args.Comparer)
+	state, err := loadSyncState(args.StateDir, rootDir.Id, args.Path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	args.OnEvent(SyncEvent{Kind: SyncCollecting})
+	files, err := self.prepareSyncFiles(args.Path, rootDir, args.Comparer, state)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find changed files
 	changedFiles := files.filterChangedRemoteFiles()
 
-	fmt.Fprintf(args.Out, "Found %d local files and %d remote files\n", len(files.local), len(files.remote))
+	args.OnEvent(SyncEvent{Kind: SyncCollected, LocalFiles: len(files.local), RemoteFiles: len(files.remote)})
+
+	args.report = newSyncReporter(len(files.local), len(files.remote))
 
 	// Ensure that we don't overwrite any local changes
 	if args.Resolution == constants.NoResolution {
-		err = ensureNoLocalModifications(changedFiles)
-		if err != nil {
-			return fmt.Errorf("Conflict detected!\nThe following files have changed and the local file are newer than it's remote counterpart:\n\n%s\nNo conflict resolution was given, aborting...", err)
+		if conflicts := findConflicts(changedFiles); len(conflicts) > 0 {
+			report := args.report.result(time.Since(started))
+			report.Conflicts = syncConflicts(conflicts)
+			return report, fmt.Errorf("Conflict detected! %d files have changed on both sides, no conflict resolution was given, aborting...", len(conflicts))
 		}
 	}
 
 	// Create missing directories
 	err = self.createMissingLocalDirs(files, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Download missing files
 	err = self.downloadMissingFiles(files, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Download files that has changed
 	err = self.downloadChangedFiles(changedFiles, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Delete extraneous local files
 	if args.DeleteExtraneous {
 		err = self.deleteExtraneousLocalFiles(files, args)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	fmt.Fprintf(args.Out, "Sync finished in %s\n", time.Since(started))
 
-	return nil
+	// Save state so that the next sync can tell which side has changed
+	if !args.DryRun {
+		err = self.saveSyncState(state, args.Path, rootDir, args.Comparer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args.report.result(time.Since(started)), nil
 }
 
 func (self *Drive) getSyncRoot(rootId string) (*drive.File, error) {
-	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties"}
-	f, err := self.service.Files.Get(rootId).Fields(fields...).Do()
+	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties", "parents", "driveId"}
+	f, err := self.store.GetFile(self.ctx, rootId, fields...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to find root dir: %s", err)
 	}
@@ -110,7 +145,7 @@ func (self *Drive) createMissingLocalDirs(files *syncFiles, args DownloadSyncArg
 	missingCount := len(missingDirs)
 
 	if missingCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d local directories are missing\n", missingCount)
+		args.OnEvent(SyncEvent{Kind: SyncMissingLocalDirs, Count: missingCount})
 	}
 
 	// Sort directories so that the dirs with the shortest path comes first
@@ -121,7 +156,9 @@ func (self *Drive) createMissingLocalDirs(files *syncFiles, args DownloadSyncArg
 		if err != nil {
 			return fmt.Errorf("Failed to determine local absolute path: %s", err)
 		}
-		fmt.Fprintf(args.Out, "[%04d/%04d] Creating directory %s\n", i+1, missingCount, filepath.Join(filepath.Base(args.Path), rf.relPath))
+		args.OnEvent(SyncEvent{Kind: SyncCreatingDir, Path: filepath.Join(filepath.Base(args.Path), rf.relPath), Index: i + 1, Count: missingCount})
+
+		args.report.addCreatedDir(rf.relPath)
 
 		if args.DryRun {
 			continue
@@ -138,116 +175,96 @@ func (self *Drive) downloadMissingFiles(files *syncFiles, args DownloadSyncArgs)
 	missingCount := len(missingFiles)
 
 	if missingCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d local files are missing\n", missingCount)
+		args.OnEvent(SyncEvent{Kind: SyncMissingLocalFiles, Count: missingCount})
 	}
 
-	for i, rf := range missingFiles {
+	return runParallel(args.Parallel, missingCount, func(i int) error {
+		rf := missingFiles[i]
 		absPath, err := filepath.Abs(filepath.Join(args.Path, rf.relPath))
 		if err != nil {
 			return fmt.Errorf("Failed to determine local absolute path: %s", err)
 		}
-		fmt.Fprintf(args.Out, "[%04d/%04d] Downloading %s -> %s\n", i+1, missingCount, rf.relPath, filepath.Join(filepath.Base(args.Path), rf.relPath))
+		args.OnEvent(SyncEvent{Kind: SyncDownloading, Path: rf.relPath, Target: filepath.Join(filepath.Base(args.Path), rf.relPath), Index: i + 1, Count: missingCount})
 
-		err = self.downloadRemoteFile(rf.file.Id, absPath, args, 0)
-		if err != nil {
+		if err = self.downloadRemoteFile(rf.file, absPath, args, 0); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		args.report.addCreated(rf.relPath)
+		return nil
+	})
 }
 
 func (self *Drive) downloadChangedFiles(changedFiles []*changedFile, args DownloadSyncArgs) error {
 	changedCount := len(changedFiles)
 
 	if changedCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d remote files has changed\n", changedCount)
+		args.OnEvent(SyncEvent{Kind: SyncChangedRemoteFiles, Count: changedCount})
 	}
 
-	for i, cf := range changedFiles {
+	return runParallel(args.Parallel, changedCount, func(i int) error {
+		cf := changedFiles[i]
 		if skip, reason := checkLocalConflict(cf, args.Resolution); skip {
-			fmt.Fprintf(args.Out, "[%04d/%04d] Skipping %s (%s)\n", i+1, changedCount, cf.remote.relPath, reason)
-			continue
+			args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: cf.remote.relPath, Reason: reason, Index: i + 1, Count: changedCount})
+			args.report.addSkipped(cf.remote.relPath)
+			return nil
 		}
 
 		absPath, err := filepath.Abs(filepath.Join(args.Path, cf.remote.relPath))
 		if err != nil {
 			return fmt.Errorf("Failed to determine local absolute path: %s", err)
 		}
-		fmt.Fprintf(args.Out, "[%04d/%04d] Downloading %s -> %s\n", i+1, changedCount, cf.remote.relPath, filepath.Join(filepath.Base(args.Path), cf.remote.relPath))
+		args.OnEvent(SyncEvent{Kind: SyncDownloading, Path: cf.remote.relPath, Target: filepath.Join(filepath.Base(args.Path), cf.remote.relPath), Index: i + 1, Count: changedCount})
 
-		err = self.downloadRemoteFile(cf.remote.file.Id, absPath, args, 0)
-		if err != nil {
+		if err = self.downloadRemoteFile(cf.remote.file, absPath, args, 0); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		args.report.addUpdated(cf.remote.relPath)
+		return nil
+	})
 }
 
-func (self *Drive) downloadRemoteFile(id, fpath string, args DownloadSyncArgs, try int) error {
+func (self *Drive) downloadRemoteFile(f *drive.File, fpath string, args DownloadSyncArgs, try int) error {
 	if args.DryRun {
 		return nil
 	}
 
-	// Get timeout reader wrapper and context
-	timeoutReaderWrapper, ctx := getTimeoutReaderWrapperContext(args.Timeout)
-
-	res, err := self.service.Files.Get(id).Context(ctx).Download()
-	if err != nil {
-		if isBackendOrRateLimitError(err) && try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(try)
-			try++
-			return self.downloadRemoteFile(id, fpath, args, try)
-		} else if isTimeoutError(err) {
-			return fmt.Errorf("Failed to download file: timeout, no data was transferred for %v", args.Timeout)
-		} else {
-			return fmt.Errorf("Failed to download file: %s", err)
-		}
-	}
-
-	// Close body on function exit
-	defer res.Body.Close()
-
-	// Wrap response body in progress reader
-	progressReader := getProgressReader(res.Body, args.Progress, res.ContentLength)
-
-	// Wrap reader in timeout reader
-	reader := timeoutReaderWrapper(progressReader)
-
-	// Ensure any parent directories exists
-	if err = mkdir(fpath); err != nil {
-		return err
+	// Encrypted files are decrypted after the download is complete
+	downloadPath := fpath
+	if isEncrypted(f) {
+		downloadPath += encryptedSuffix
 	}
 
-	// Download to tmp file
-	tmpPath := fpath + ".incomplete"
-
-	// Create new file
-	outFile, err := os.Create(tmpPath)
-	if err != nil {
-		return fmt.Errorf("Unable to create local file: %s", err)
-	}
+	_, err := self.downloadFile(downloadFileArgs{
+		download: func(ctx context.Context, offset int64) (*http.Response, error) {
+			return self.store.DownloadFile(ctx, f.Id, offset)
+		},
+		fpath:    downloadPath,
+		md5:      f.Md5Checksum,
+		sha256:   f.Sha256Checksum,
+		progress: args.Progress,
+		timeout:  args.Timeout,
+	})
 
-	// Save file to disk
-	_, err = io.Copy(outFile, reader)
 	if err != nil {
-		outFile.Close()
-		if try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(try)
+		// Retried downloads continue from where the previous attempt stopped
+		if isDownloadInterruptedError(err) && self.retry.shouldRetry(err, try) {
+			if err := self.retry.wait(self.ctx, err, try); err != nil {
+				return err
+			}
 			try++
-			return self.downloadRemoteFile(id, fpath, args, try)
+			return self.downloadRemoteFile(f, fpath, args, try)
 		} else {
-			os.Remove(tmpPath)
-			return fmt.Errorf("Download was interrupted: %s", err)
+			return err
 		}
 	}
 
-	// Close file
-	outFile.Close()
+	if isEncrypted(f) {
+		return self.decryptFile(downloadPath, fpath, f.AppProperties[plainMd5Property])
+	}
 
-	// Rename tmp file to proper filename
-	return os.Rename(tmpPath, fpath)
+	return nil
 }
 
 func (self *Drive) deleteExtraneousLocalFiles(files *syncFiles, args DownloadSyncArgs) error {
@@ -255,31 +272,61 @@ func (self *Drive) deleteExtraneousLocalFiles(files *syncFiles, args DownloadSyn
 	extraneousCount := len(extraneousFiles)
 
 	if extraneousCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d local files are extraneous\n", extraneousCount)
+		args.OnEvent(SyncEvent{Kind: SyncExtraneousLocalFiles, Count: extraneousCount})
 	}
 
 	// Sort files so that the files with the longest path comes first
 	sort.Sort(sort.Reverse(byLocalPathLength(extraneousFiles)))
 
 	for i, lf := range extraneousFiles {
-		fmt.Fprintf(args.Out, "[%04d/%04d] Deleting %s\n", i+1, extraneousCount, lf.absPath)
-
-		if args.DryRun {
-			continue
+		// Directories that still hold ignored or filtered files are kept along with the files
+		if lf.info.IsDir() && !args.DryRun {
+			isEmpty, err := localDirIsEmpty(lf.absPath)
+			if err != nil {
+				return err
+			}
+
+			if !isEmpty {
+				args.OnEvent(SyncEvent{Kind: SyncKeeping, Path: lf.absPath, Reason: "holds ignored files", Index: i + 1, Count: extraneousCount})
+				args.report.addKept(lf.relPath)
+				continue
+			}
 		}
 
-		err := os.Remove(lf.absPath)
-		if err != nil {
-			return fmt.Errorf("Failed to delete local file: %s", err)
+		args.OnEvent(SyncEvent{Kind: SyncDeleting, Path: lf.absPath, Index: i + 1, Count: extraneousCount})
+
+		if !args.DryRun {
+			if err := os.Remove(lf.absPath); err != nil {
+				return fmt.Errorf("Failed to delete local file: %s", err)
+			}
 		}
+
+		args.report.addDeleted(lf.relPath)
 	}
 
 	return nil
 }
 
+func localDirIsEmpty(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("Failed to open directory: %s", err)
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to read directory: %s", err)
+	}
+	return false, nil
+}
+
 func checkLocalConflict(cf *changedFile, resolution constants.ConflictResolution) (bool, string) {
-	// No conflict unless local file was last modified
-	if cf.compareModTime() != constants.LocalLastModified {
+	// No conflict unless local file has changed
+	if !cf.conflict {
 		return false, ""
 	}
 
@@ -317,14 +364,3 @@ func checkLocalConflict(cf *changedFile, resolution constants.ConflictResolution
 	// in which case we default to being non-destructive and skip the file
 	return true, "conflicting file, unhandled case"
 }
-
-func ensureNoLocalModifications(files []*changedFile) error {
-	conflicts := findLocalConflicts(files)
-	if len(conflicts) == 0 {
-		return nil
-	}
-
-	buffer := bytes.NewBufferString("")
-	formatConflicts(conflicts, buffer)
-	return fmt.Errorf(buffer.String())
-}
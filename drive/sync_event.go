@@ -0,0 +1,114 @@
+package drive
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+type SyncEventKind int
+
+const (
+	SyncStarted SyncEventKind = iota
+	SyncCollecting
+	// LocalFiles and RemoteFiles holds the number of collected files
+	SyncCollected
+
+	// The number of files in a group is given by Count, the files of
+	// the group follows with their position in Index
+	SyncMissingLocalDirs
+	SyncMissingRemoteDirs
+	SyncMissingLocalFiles
+	SyncMissingRemoteFiles
+	SyncChangedLocalFiles
+	SyncChangedRemoteFiles
+	SyncExtraneousLocalFiles
+	SyncExtraneousRemoteFiles
+
+	SyncCreatingDir
+	// The file at Path is transferred to Target
+	SyncUploading
+	SyncUpdating
+	SyncDownloading
+	// The file is left alone for the given Reason
+	SyncSkipping
+	SyncKeeping
+	SyncDeleting
+	SyncTrashing
+
+	// Only sent by WatchSync, Path is the local directory and Target the sync root
+	SyncWatching
+	SyncStopping
+	SyncFinished
+	SyncFailed
+	SyncWatchError
+
+	// Only sent by AdoptSync, Count holds the number of files to tag
+	SyncAdopting
+	SyncTagging
+)
+
+// A step of a sync, passed to the OnEvent function of the sync args
+type SyncEvent struct {
+	Kind SyncEventKind
+	// Path of the file relative to the sync root, or prefixed with the root
+	// name or the local directory when it is where the file is written
+	Path   string
+	Target string
+	// Position of the file in its group, starting at one, and the size of the group
+	Index  int
+	Count  int
+	Reason string
+
+	LocalFiles  int
+	RemoteFiles int
+	Duration    time.Duration
+	Err         error
+}
+
+// Wraps the event function and progress writer so that events and progress from
+// parallel transfers are serialized and don't interleave. The progress
+// of each file is drawn on the same line, so it is discarded when
+// more than one file is transferred at the time
+func serializeEvents(onEvent func(SyncEvent), progress io.Writer, parallel int) (func(SyncEvent), io.Writer) {
+	mutex := &sync.Mutex{}
+
+	onEvent = discardEventsIfNil(onEvent)
+	serialized := func(event SyncEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		onEvent(event)
+	}
+
+	progress = discardIfNil(progress)
+	if parallel > 1 {
+		progress = ioutil.Discard
+	}
+
+	// Keep discarded progress untouched so that progress readers are not created
+	if progress != ioutil.Discard {
+		progress = &syncWriter{mutex: mutex, writer: progress}
+	}
+
+	return serialized, progress
+}
+
+func discardEventsIfNil(onEvent func(SyncEvent)) func(SyncEvent) {
+	if onEvent == nil {
+		return func(SyncEvent) {}
+	}
+	return onEvent
+}
+
+type syncWriter struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+}
+
+func (self *syncWriter) Write(p []byte) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.writer.Write(p)
+}
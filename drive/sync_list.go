@@ -1,97 +1,75 @@
 package drive
 
 import (
-	"fmt"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
-	"io"
+	"path"
 	"sort"
-	"text/tabwriter"
 )
 
-type ListSyncArgs struct {
-	Out        io.Writer
-	SkipHeader bool
-}
+// Returns the sync root directories
+func (self *Drive) ListSync(ctx context.Context) ([]*drive.File, error) {
+	self = self.withContext(ctx)
 
-func (self *Drive) ListSync(args ListSyncArgs) error {
 	listArgs := listAllFilesArgs{
 		query:  "appProperties has {key='syncRoot' and value='true'}",
 		fields: []googleapi.Field{"nextPageToken", "files(id,name,mimeType,createdTime)"},
 	}
-	files, err := self.listAllFiles(listArgs)
-	if err != nil {
-		return err
-	}
-	printSyncDirectories(files, args)
-	return nil
+	return self.listAllFiles(listArgs)
 }
 
 type ListRecursiveSyncArgs struct {
-	Out         io.Writer
-	RootId      string
-	SkipHeader  bool
-	PathWidth   int64
-	SizeInBytes bool
-	SortOrder   string
+	RootId    string
+	SortOrder string
+	AbsPath   bool
+}
+
+// A file in a sync directory
+type SyncFile struct {
+	*drive.File
+	// Path relative to the sync root
+	RelPath string
+	// Absolute path with a leading slash, only set when requested
+	Path string
 }
 
-func (self *Drive) ListRecursiveSync(args ListRecursiveSyncArgs) error {
+// Returns the files in the sync directory, sorted by path if no sort order is given
+func (self *Drive) ListRecursiveSync(ctx context.Context, args ListRecursiveSyncArgs) ([]*SyncFile, error) {
+	self = self.withContext(ctx)
+
 	rootDir, err := self.getSyncRoot(args.RootId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	files, err := self.prepareRemoteFiles(rootDir, args.SortOrder)
 	if err != nil {
-		return err
-	}
-
-	printSyncDirContent(files, args)
-	return nil
-}
-
-func printSyncDirectories(files []*drive.File, args ListSyncArgs) {
-	w := new(tabwriter.Writer)
-	w.Init(args.Out, 0, 0, 3, ' ', 0)
-
-	if !args.SkipHeader {
-		fmt.Fprintln(w, "Id\tName\tCreated")
-	}
-
-	for _, f := range files {
-		fmt.Fprintf(w, "%s\t%s\t%s\n",
-			f.Id,
-			f.Name,
-			formatDatetime(f.CreatedTime),
-		)
+		return nil, err
 	}
 
-	w.Flush()
-}
-
-func printSyncDirContent(files []*RemoteFile, args ListRecursiveSyncArgs) {
 	if args.SortOrder == "" {
 		// Sort files by path
 		sort.Sort(byRemotePath(files))
 	}
 
-	w := new(tabwriter.Writer)
-	w.Init(args.Out, 0, 0, 3, ' ', 0)
-
-	if !args.SkipHeader {
-		fmt.Fprintln(w, "Id\tPath\tType\tSize\tModified")
+	var rootPath string
+	if args.AbsPath {
+		absPath, err := self.newPathfinder().absPath(rootDir)
+		if err != nil {
+			return nil, err
+		}
+		rootPath = formatAbsPath(absPath)
 	}
 
+	var result []*SyncFile
 	for _, rf := range files {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			rf.file.Id,
-			truncateString(rf.relPath, int(args.PathWidth)),
-			filetype(rf.file),
-			formatSize(rf.file.Size, args.SizeInBytes),
-			formatDatetime(rf.file.ModifiedTime),
-		)
+		f := &SyncFile{File: rf.file, RelPath: rf.relPath}
+		if args.AbsPath {
+			f.Path = path.Join(rootPath, rf.relPath)
+		}
+		result = append(result, f)
 	}
 
-	w.Flush()
+	return result, nil
 }
@@ -0,0 +1,165 @@
+package drive
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Returns a directory that is synced in mirror mode. Any directory can be
+// mirrored, the files are matched by path and are not tagged as synced
+func (self *Drive) getMirrorRoot(rootId string) (*drive.File, error) {
+	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties", "parents", "driveId"}
+	f, err := self.store.GetFile(self.ctx, rootId, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find root dir: %s", err)
+	}
+
+	// Ensure file is a directory
+	if !isDir(f) {
+		return nil, fmt.Errorf("Provided root id is not a directory")
+	}
+
+	// Files created in mirror mode are not tagged and would be ignored by a normal sync
+	if isSyncRoot(f) {
+		return nil, fmt.Errorf("'%s' is a sync root and can't be mirrored, sync it without --mirror", f.Name)
+	}
+
+	return f, nil
+}
+
+// Returns the sync root id that synced files are tagged with,
+// files created in mirror mode are not tagged
+func syncRootIdArg(rootId string, mirror bool) string {
+	if mirror {
+		return ""
+	}
+	return rootId
+}
+
+// Finds the files of a mirrored directory by listing the content of each directory.
+// Documents can't be synced and are left out
+func (self *Drive) prepareMirrorFiles(rootDir *drive.File) ([]*RemoteFile, error) {
+	descendants, err := self.listDescendants(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*drive.File
+	for _, f := range descendants {
+		if isDir(f) || isBinary(f) {
+			files = append(files, f)
+		}
+	}
+
+	return self.newRemoteFiles(rootDir, files)
+}
+
+type AdoptSyncArgs struct {
+	// Receives the progress of the adoption, may be nil
+	OnEvent func(SyncEvent)
+	RootId  string
+	DryRun  bool
+}
+
+// Turns an existing directory into a sync root by tagging the directory and its content,
+// returns the new sync root
+func (self *Drive) AdoptSync(ctx context.Context, args AdoptSyncArgs) (*drive.File, error) {
+	self = self.withContext(ctx)
+	args.OnEvent = discardEventsIfNil(args.OnEvent)
+
+	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties", "driveId"}
+	rootDir, err := self.store.GetFile(self.ctx, args.RootId, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find root dir: %s", err)
+	}
+
+	if !isDir(rootDir) {
+		return nil, fmt.Errorf("Provided root id is not a directory")
+	}
+
+	if isSyncRoot(rootDir) {
+		return nil, fmt.Errorf("'%s' is already a sync root", rootDir.Name)
+	}
+
+	if syncRootIdOf(rootDir) != "" {
+		return nil, fmt.Errorf("'%s' is part of a sync directory, sync roots can't be placed inside another sync root", rootDir.Name)
+	}
+
+	args.OnEvent(SyncEvent{Kind: SyncCollecting})
+	descendants, err := self.listDescendants(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ensureNoSyncRoots(descendants); err != nil {
+		return nil, err
+	}
+
+	// Documents can't be synced and are left untagged so that sync ignores them
+	var files []*drive.File
+	for _, f := range descendants {
+		if isDir(f) || isBinary(f) {
+			files = append(files, f)
+		} else {
+			args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: f.Name, Reason: "documents can't be synced"})
+		}
+	}
+
+	// Sync requires that each file has a unique path
+	if err = checkFiles(files); err != nil {
+		return nil, fmt.Errorf("%s, rename or remove one of the files before adopting the directory", err)
+	}
+
+	relPaths, err := prepareRemoteRelPaths(rootDir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var remoteFiles []*RemoteFile
+	for _, f := range files {
+		remoteFiles = append(remoteFiles, &RemoteFile{relPath: relPaths[f.Id], file: f})
+	}
+
+	// List directories before the files they contain
+	sort.Sort(byRemotePathLength(remoteFiles))
+
+	count := len(remoteFiles)
+	args.OnEvent(SyncEvent{Kind: SyncAdopting, Path: rootDir.Name, Count: count})
+
+	var calls []*batchCall
+	var names []string
+
+	for i, rf := range remoteFiles {
+		args.OnEvent(SyncEvent{Kind: SyncTagging, Path: rf.relPath, Index: i + 1, Count: count})
+
+		dstFile := &drive.File{}
+		setSyncProperties(dstFile, rootDir.Id)
+
+		calls = append(calls, self.updateFileCall(rf.file.Id, dstFile))
+		names = append(names, rf.relPath)
+	}
+
+	if args.DryRun {
+		return rootDir, nil
+	}
+
+	if err = batchError("tag", names, self.runBatch(calls)); err != nil {
+		return nil, err
+	}
+
+	// The root is tagged last so that an interrupted adoption can be started over
+	dstFile := &drive.File{
+		AppProperties: map[string]string{"sync": "true", "syncRoot": "true"},
+	}
+
+	_, err = self.store.UpdateFile(self.ctx, rootDir.Id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id"}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update root directory: %s", err)
+	}
+
+	return rootDir, nil
+}
@@ -0,0 +1,111 @@
+package drive
+
+import (
+	"sync"
+	"time"
+)
+
+// Summary of an upload or download sync. The files are given by their path relative
+// to the sync root, on a dry run they are the files that would have been changed
+type SyncReport struct {
+	LocalFiles  int
+	RemoteFiles int
+	// Directories created on the receiving side
+	CreatedDirs []string
+	// Files that were missing on the receiving side
+	Created []string
+	// Files that had changed on the sending side
+	Updated []string
+	// Changed files that were left alone because of a conflict
+	Skipped []string
+	// Extraneous files deleted from the receiving side
+	Deleted []string
+	// Extraneous directories kept as they hold ignored files
+	Kept []string
+	// Files that had changed on both sides, the sync stops before changing
+	// any file when there are conflicts and no conflict resolution is given
+	Conflicts []SyncConflict
+	Duration  time.Duration
+}
+
+// A file that has changed on both sides since the last sync
+type SyncConflict struct {
+	// Path relative to the sync root
+	Path           string
+	LocalSize      int64
+	RemoteSize     int64
+	LocalModified  time.Time
+	RemoteModified time.Time
+}
+
+// Collects the report of a sync, files are added from parallel transfers
+type syncReporter struct {
+	mutex  *sync.Mutex
+	report SyncReport
+}
+
+func newSyncReporter(localFiles, remoteFiles int) *syncReporter {
+	return &syncReporter{
+		mutex:  &sync.Mutex{},
+		report: SyncReport{LocalFiles: localFiles, RemoteFiles: remoteFiles},
+	}
+}
+
+// Returns a copy of the collected report
+func (self *syncReporter) result(duration time.Duration) *SyncReport {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	report := self.report
+	report.Duration = duration
+	return &report
+}
+
+func (self *syncReporter) addCreatedDir(relPath string) {
+	self.add(func(r *SyncReport) { r.CreatedDirs = append(r.CreatedDirs, relPath) })
+}
+
+func (self *syncReporter) addCreated(relPath string) {
+	self.add(func(r *SyncReport) { r.Created = append(r.Created, relPath) })
+}
+
+func (self *syncReporter) addUpdated(relPath string) {
+	self.add(func(r *SyncReport) { r.Updated = append(r.Updated, relPath) })
+}
+
+func (self *syncReporter) addSkipped(relPath string) {
+	self.add(func(r *SyncReport) { r.Skipped = append(r.Skipped, relPath) })
+}
+
+func (self *syncReporter) addDeleted(relPath string) {
+	self.add(func(r *SyncReport) { r.Deleted = append(r.Deleted, relPath) })
+}
+
+func (self *syncReporter) addKept(relPath string) {
+	self.add(func(r *SyncReport) { r.Kept = append(r.Kept, relPath) })
+}
+
+// Files are not recorded when there is no reporter, i.e. when syncing changes while watching
+func (self *syncReporter) add(update func(r *SyncReport)) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	update(&self.report)
+}
+
+func syncConflicts(conflicts []*changedFile) []SyncConflict {
+	var result []SyncConflict
+	for _, cf := range conflicts {
+		result = append(result, SyncConflict{
+			Path:           cf.local.relPath,
+			LocalSize:      cf.local.Size(),
+			RemoteSize:     cf.remote.Size(),
+			LocalModified:  cf.local.Modified(),
+			RemoteModified: cf.remote.Modified(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,254 @@
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/grandeto/gdrive/util"
+	"google.golang.org/api/drive/v3"
+)
+
+// How a file has changed on one side since the last sync
+type fileChange int
+
+const (
+	fileUnchanged fileChange = iota
+	fileCreated
+	fileModified
+	fileDeleted
+)
+
+// State of a file that existed on both sides after the last sync.
+// The size and modification time is of the local file, and is used
+// to avoid calculating the md5 of local files that has not changed
+type syncRecord struct {
+	Id       string `json:"id"`
+	Md5      string `json:"md5,omitempty"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+	Dir      bool   `json:"dir,omitempty"`
+}
+
+// Sync state of a local directory synced with a sync root. The state of all
+// local directories synced with the same root is kept in one file per root
+type syncState struct {
+	path    string
+	key     string
+	records map[string]*syncRecord
+}
+
+// Loads the sync state of the given root and local directory. Records is nil
+// if the directory has not been synced before, or if no state dir is given
+func loadSyncState(dir, rootId, localPath string) (*syncState, error) {
+	if dir == "" {
+		return &syncState{}, nil
+	}
+
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine absolute path: %s", err)
+	}
+
+	state := &syncState{
+		path: filepath.Join(dir, rootId+".json"),
+		key:  absPath,
+	}
+
+	states, err := state.read()
+	if err != nil {
+		return nil, err
+	}
+
+	state.records = states[state.key]
+	return state, nil
+}
+
+// Records the files that are equal on both sides, files that
+// differ keep their previous record as they are still not synced
+func (self *syncState) update(files *syncFiles) error {
+	if self.path == "" {
+		return nil
+	}
+
+	records := map[string]*syncRecord{}
+
+	for _, rf := range files.remote {
+		lf, found := files.findLocalByPath(rf.relPath)
+		if !found {
+			continue
+		}
+
+		if isDir(rf.file) && lf.info.IsDir() {
+			records[rf.relPath] = &syncRecord{Id: rf.file.Id, Dir: true}
+			continue
+		}
+
+		if isDir(rf.file) || lf.info.IsDir() {
+			continue
+		}
+
+		if !files.compare.Changed(lf, rf) {
+			records[rf.relPath] = &syncRecord{
+				Id:       rf.file.Id,
+				Md5:      rf.Md5(),
+				Size:     lf.Size(),
+				Modified: lf.Modified().UnixNano(),
+			}
+		} else if record, ok := self.records[rf.relPath]; ok {
+			records[rf.relPath] = record
+		}
+	}
+
+	self.records = records
+	return self.save()
+}
+
+func (self *syncState) save() error {
+	states, err := self.read()
+	if err != nil {
+		return err
+	}
+
+	states[self.key] = self.records
+
+	if err = mkdir(self.path); err != nil {
+		return err
+	}
+
+	if err = util.WriteJson(self.path, states); err != nil {
+		return fmt.Errorf("Failed to save sync state: %s", err)
+	}
+
+	return nil
+}
+
+func (self *syncState) read() (map[string]map[string]*syncRecord, error) {
+	states := map[string]map[string]*syncRecord{}
+
+	f, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read sync state: %s", err)
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(&states); err != nil {
+		return nil, fmt.Errorf("Failed to read sync state: %s", err)
+	}
+
+	return states, nil
+}
+
+// Collects file information after a sync and saves the new sync state
+func (self *Drive) saveSyncState(state *syncState, localPath string, root *drive.File, cmp FileComparer) error {
+	if state.path == "" {
+		return nil
+	}
+
+	files, err := self.prepareSyncFiles(localPath, root, cmp, state)
+	if err != nil {
+		return err
+	}
+
+	return state.update(files)
+}
+
+// Returns true if there is a record of an earlier sync to compare against
+func (self *syncFiles) hasState() bool {
+	return self.state != nil && self.state.records != nil
+}
+
+func (self *syncFiles) record(relPath string) (*syncRecord, bool) {
+	if !self.hasState() {
+		return nil, false
+	}
+
+	record, ok := self.state.records[relPath]
+	return record, ok
+}
+
+// Returns how the local file at relPath has changed since the last sync, lf is nil if there is no local file
+func (self *syncFiles) localChange(relPath string, lf *LocalFile) fileChange {
+	record, synced := self.record(relPath)
+
+	if lf == nil {
+		if synced {
+			return fileDeleted
+		}
+		return fileUnchanged
+	}
+
+	if !synced {
+		return fileCreated
+	}
+
+	if record.Dir != lf.info.IsDir() {
+		return fileModified
+	}
+
+	if record.Dir {
+		return fileUnchanged
+	}
+
+	if lf.Size() != record.Size {
+		return fileModified
+	}
+
+	// Only calculate md5 if the modification time has changed
+	if lf.Modified().UnixNano() != record.Modified && util.Md5sum(lf.absPath) != record.Md5 {
+		return fileModified
+	}
+
+	return fileUnchanged
+}
+
+// Returns how the remote file at relPath has changed since the last sync, rf is nil if there is no remote file
+func (self *syncFiles) remoteChange(relPath string, rf *RemoteFile) fileChange {
+	record, synced := self.record(relPath)
+
+	if rf == nil {
+		if synced {
+			return fileDeleted
+		}
+		return fileUnchanged
+	}
+
+	if !synced {
+		return fileCreated
+	}
+
+	// A different file at the same path means the file has been replaced
+	if record.Id != rf.file.Id || record.Dir != isDir(rf.file) {
+		return fileModified
+	}
+
+	if !record.Dir && rf.Md5() != record.Md5 {
+		return fileModified
+	}
+
+	return fileUnchanged
+}
+
+// Returns true if the remote file, or any file below it, has changed since the last sync
+func (self *syncFiles) remoteChangedBelow(relPath string) bool {
+	for _, rf := range self.remote {
+		if isSubPath(rf.relPath, []string{relPath}) && self.remoteChange(rf.relPath, rf) != fileUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the local file, or any file below it, has changed since the last sync
+func (self *syncFiles) localChangedBelow(relPath string) bool {
+	for _, lf := range self.local {
+		if isSubPath(lf.relPath, []string{relPath}) && self.localChange(lf.relPath, lf) != fileUnchanged {
+			return true
+		}
+	}
+	return false
+}
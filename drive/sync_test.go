@@ -0,0 +1,743 @@
+package drive_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grandeto/gdrive/compare"
+	"github.com/grandeto/gdrive/constants"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"github.com/grandeto/gdrive/fakedrive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// A local directory and a sync root on a fake drive
+type syncTest struct {
+	t        *testing.T
+	client   *gdrive.Drive
+	store    *fakedrive.Store
+	rootId   string
+	localDir string
+	stateDir string
+	comparer gdrive.FileComparer
+}
+
+func newSyncTest(t *testing.T) *syncTest {
+	client := newTestClient(t)
+	store := fakedrive.NewStore()
+	client.SetStore(store)
+
+	root, err := store.CreateFile(context.Background(), gdrive.WriteFileArgs{
+		File: &drive.File{Name: "sync", MimeType: constants.DirectoryMimeType, Parents: []string{fakedrive.RootId}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	localDir := filepath.Join(tmp, "local")
+	if err = os.Mkdir(localDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &syncTest{
+		t:        t,
+		client:   client,
+		store:    store,
+		rootId:   root.Id,
+		localDir: localDir,
+		stateDir: filepath.Join(tmp, "state"),
+		comparer: compare.NewCachedMd5Comparer(filepath.Join(tmp, "md5_cache.json")),
+	}
+}
+
+// Like newSyncTest, but the client sends its requests to a fake drive server,
+// the directory changes are then sent as batch requests
+func newServerSyncTest(t *testing.T) *syncTest {
+	st := newSyncTest(t)
+	server := fakedrive.NewServer(st.store)
+	t.Cleanup(server.Close)
+
+	st.client = newTestClient(t)
+	st.client.SetEndpoint(server.URL)
+	return st
+}
+
+// Returns a client that retries failed requests without waiting
+func newTestClient(t *testing.T) *gdrive.Drive {
+	client, err := gdrive.New(&http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(gdrive.RetryPolicy{Retries: 2, MaxBackoff: time.Millisecond})
+	return client
+}
+
+func (self *syncTest) upload(args gdrive.UploadSyncArgs) (*gdrive.SyncReport, error) {
+	args.Path = self.localDir
+	args.RootId = self.rootId
+	args.Parallel = 1
+	args.Comparer = self.comparer
+	return self.client.UploadSync(context.Background(), args)
+}
+
+func (self *syncTest) download(args gdrive.DownloadSyncArgs) (*gdrive.SyncReport, error) {
+	args.Path = self.localDir
+	args.RootId = self.rootId
+	args.Parallel = 1
+	args.Comparer = self.comparer
+	return self.client.DownloadSync(context.Background(), args)
+}
+
+// Uploads the local directory and fails the test if the sync fails
+func (self *syncTest) mustUpload(args gdrive.UploadSyncArgs) *gdrive.SyncReport {
+	report, err := self.upload(args)
+	if err != nil {
+		self.t.Fatalf("Upload sync failed: %s", err)
+	}
+	return report
+}
+
+func (self *syncTest) changedLocalFiles(stateDir string) map[string]bool {
+	changed, err := self.client.ChangedLocalFiles(context.Background(), self.localDir, self.rootId, stateDir, self.comparer)
+	if err != nil {
+		self.t.Fatal(err)
+	}
+	return changed
+}
+
+func (self *syncTest) writeLocal(relPath, content string) {
+	path := filepath.Join(self.localDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		self.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+func (self *syncTest) mkdirLocal(relPath string) {
+	if err := os.MkdirAll(filepath.Join(self.localDir, relPath), 0755); err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+func (self *syncTest) removeLocal(relPath string) {
+	if err := os.RemoveAll(filepath.Join(self.localDir, relPath)); err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+func (self *syncTest) touchLocal(relPath string, modified time.Time) {
+	if err := os.Chtimes(filepath.Join(self.localDir, relPath), modified, modified); err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+func (self *syncTest) readLocal(relPath string) string {
+	content, err := ioutil.ReadFile(filepath.Join(self.localDir, relPath))
+	if err != nil {
+		self.t.Fatal(err)
+	}
+	return string(content)
+}
+
+// Returns the files with the given path below the sync root that are not trashed
+func (self *syncTest) remoteFiles(relPath string) []*drive.File {
+	parents := []string{self.rootId}
+	var found []*drive.File
+
+	for _, name := range strings.Split(relPath, "/") {
+		found = nil
+		for _, f := range self.store.Files() {
+			if f.Name == name && !f.Trashed && len(f.Parents) == 1 && containsString(parents, f.Parents[0]) {
+				found = append(found, f)
+			}
+		}
+
+		parents = nil
+		for _, f := range found {
+			parents = append(parents, f.Id)
+		}
+	}
+
+	return found
+}
+
+func (self *syncTest) remoteFile(relPath string) *drive.File {
+	files := self.remoteFiles(relPath)
+	if len(files) != 1 {
+		self.t.Fatalf("Expected one remote file with path %s, found %d", relPath, len(files))
+	}
+	return files[0]
+}
+
+func (self *syncTest) remoteExists(relPath string) bool {
+	return len(self.remoteFiles(relPath)) > 0
+}
+
+func (self *syncTest) readRemote(relPath string) string {
+	content, err := self.store.Content(self.remoteFile(relPath).Id)
+	if err != nil {
+		self.t.Fatal(err)
+	}
+	return string(content)
+}
+
+func (self *syncTest) writeRemote(relPath, content string) {
+	_, err := self.store.UpdateFile(context.Background(), self.remoteFile(relPath).Id, gdrive.WriteFileArgs{
+		File:  &drive.File{},
+		Media: bytes.NewReader([]byte(content)),
+	})
+	if err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+// Creates a file in an existing remote directory the way another client syncing the root would
+func (self *syncTest) createRemote(relPath, content string) {
+	parentId := self.rootId
+	if dir := filepath.Dir(relPath); dir != "." {
+		parentId = self.remoteFile(dir).Id
+	}
+
+	_, err := self.store.CreateFile(context.Background(), gdrive.WriteFileArgs{
+		File: &drive.File{
+			Name:          filepath.Base(relPath),
+			Parents:       []string{parentId},
+			AppProperties: map[string]string{"sync": "true", "syncRootId": self.rootId},
+		},
+		Media: bytes.NewReader([]byte(content)),
+	})
+	if err != nil {
+		self.t.Fatal(err)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sorted(values []string) []string {
+	values = append([]string(nil), values...)
+	sort.Strings(values)
+	return values
+}
+
+func expectPaths(t *testing.T, name string, actual, expected []string) {
+	t.Helper()
+	if !reflect.DeepEqual(sorted(actual), sorted(expected)) {
+		t.Errorf("Expected %s to be %v, got %v", name, expected, actual)
+	}
+}
+
+func conflictPaths(conflicts []gdrive.SyncConflict) []string {
+	var paths []string
+	for _, c := range conflicts {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+func apiError(code int, reason string) error {
+	return &googleapi.Error{
+		Code:    code,
+		Message: reason,
+		Errors:  []googleapi.ErrorItem{{Reason: reason, Message: reason}},
+	}
+}
+
+func TestUploadSyncCreatesMissingDirs(t *testing.T) {
+	st := newSyncTest(t)
+	st.mkdirLocal("a/b/c")
+	st.mkdirLocal("a/d")
+	st.mkdirLocal("e")
+	st.writeLocal("a/b/c/file.txt", "content")
+
+	report := st.mustUpload(gdrive.UploadSyncArgs{})
+
+	expectPaths(t, "created dirs", report.CreatedDirs, []string{"a", "a/b", "a/b/c", "a/d", "e"})
+	expectPaths(t, "created files", report.Created, []string{"a/b/c/file.txt"})
+
+	for _, relPath := range []string{"a", "a/b", "a/b/c", "a/d", "e"} {
+		f := st.remoteFile(relPath)
+		if f.MimeType != constants.DirectoryMimeType {
+			t.Errorf("Expected %s to be a directory, got %s", relPath, f.MimeType)
+		}
+		if f.AppProperties["syncRootId"] != st.rootId {
+			t.Errorf("Expected %s to be part of the sync root, got properties %v", relPath, f.AppProperties)
+		}
+	}
+
+	if content := st.readRemote("a/b/c/file.txt"); content != "content" {
+		t.Errorf("Expected uploaded content 'content', got '%s'", content)
+	}
+
+	// Nothing is created when the directories exist
+	report = st.mustUpload(gdrive.UploadSyncArgs{})
+	expectPaths(t, "created dirs", report.CreatedDirs, nil)
+}
+
+func TestUploadSyncSendsEvents(t *testing.T) {
+	st := newSyncTest(t)
+	st.mkdirLocal("a")
+	st.writeLocal("a/file.txt", "content")
+	st.writeLocal("other.txt", "content")
+
+	var events []gdrive.SyncEvent
+	st.mustUpload(gdrive.UploadSyncArgs{OnEvent: func(e gdrive.SyncEvent) { events = append(events, e) }})
+
+	var kinds []gdrive.SyncEventKind
+	uploaded := map[string]int{}
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+		if e.Kind == gdrive.SyncUploading {
+			uploaded[e.Path] = e.Count
+		}
+	}
+
+	expected := []gdrive.SyncEventKind{
+		gdrive.SyncStarted,
+		gdrive.SyncCollecting,
+		gdrive.SyncCollected,
+		gdrive.SyncMissingRemoteDirs,
+		gdrive.SyncCreatingDir,
+		gdrive.SyncMissingRemoteFiles,
+		gdrive.SyncUploading,
+		gdrive.SyncUploading,
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected events %v, got %v", expected, kinds)
+	}
+
+	expectedUploads := map[string]int{"a/file.txt": 2, "other.txt": 2}
+	if !reflect.DeepEqual(uploaded, expectedUploads) {
+		t.Errorf("Expected uploads %v, got %v", expectedUploads, uploaded)
+	}
+}
+
+func TestUploadSyncDryRunCreatesNothing(t *testing.T) {
+	st := newSyncTest(t)
+	st.mkdirLocal("a/b")
+	st.writeLocal("a/file.txt", "content")
+
+	report := st.mustUpload(gdrive.UploadSyncArgs{DryRun: true})
+
+	expectPaths(t, "created dirs", report.CreatedDirs, []string{"a", "a/b"})
+	expectPaths(t, "created files", report.Created, []string{"a/file.txt"})
+
+	if st.remoteExists("a") {
+		t.Errorf("Expected dry run to not create any directories")
+	}
+}
+
+func TestUploadSyncCreateDirFailure(t *testing.T) {
+	st := newSyncTest(t)
+	st.mkdirLocal("a")
+	st.mkdirLocal("b")
+
+	st.store.FailNext("create", apiError(500, "backendError"))
+
+	_, err := st.upload(gdrive.UploadSyncArgs{})
+	if err == nil || !strings.Contains(err.Error(), "Failed to create 1 of 2 files") {
+		t.Fatalf("Expected failed directory create, got %v", err)
+	}
+
+	// The next sync creates the missing directory without duplicating the other one
+	report := st.mustUpload(gdrive.UploadSyncArgs{})
+	if len(report.CreatedDirs) != 1 {
+		t.Errorf("Expected one directory to be created, got %v", report.CreatedDirs)
+	}
+	st.remoteFile("a")
+	st.remoteFile("b")
+}
+
+func TestUploadSyncRetriesRejectedUploads(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+
+	st.store.FailNext("create", apiError(503, "backendError"), apiError(429, "rateLimitExceeded"))
+
+	report := st.mustUpload(gdrive.UploadSyncArgs{})
+
+	expectPaths(t, "created files", report.Created, []string{"file.txt"})
+	if content := st.readRemote("file.txt"); content != "content" {
+		t.Errorf("Expected uploaded content 'content', got '%s'", content)
+	}
+}
+
+func TestUploadSyncDoesNotRetryFailedUploads(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+
+	// The file may have been created when drive fails with 500, so the upload is not sent again
+	st.store.FailNext("create", apiError(500, "backendError"), apiError(500, "backendError"))
+
+	_, err := st.upload(gdrive.UploadSyncArgs{})
+	if err == nil || !strings.Contains(err.Error(), "Failed to upload file") {
+		t.Fatalf("Expected failed upload, got %v", err)
+	}
+
+	// The second failure is still queued if the upload was only sent once
+	if _, err = st.upload(gdrive.UploadSyncArgs{}); err == nil {
+		t.Errorf("Expected the upload to only be sent once")
+	}
+}
+
+func TestUploadSyncListFailure(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{})
+
+	st.store.FailNext("list", apiError(403, "insufficientPermissions"))
+
+	_, err := st.upload(gdrive.UploadSyncArgs{})
+	if err == nil || !strings.Contains(err.Error(), "Failed listing files") {
+		t.Errorf("Expected failed listing, got %v", err)
+	}
+}
+
+func TestChangedLocalFilesWithoutState(t *testing.T) {
+	st := newSyncTest(t)
+	modified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	st.store.SetClock(func() time.Time { return modified })
+
+	st.writeLocal("newer.txt", "content")
+	st.writeLocal("older.txt", "content")
+	st.writeLocal("unchanged.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{})
+
+	// Without a state the file is in conflict if the remote file was modified last
+	st.writeLocal("newer.txt", "local change")
+	st.touchLocal("newer.txt", modified.Add(time.Hour))
+	st.writeLocal("older.txt", "local change")
+	st.touchLocal("older.txt", modified.Add(-time.Hour))
+
+	expected := map[string]bool{"newer.txt": false, "older.txt": true}
+	if changed := st.changedLocalFiles(""); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Expected changed files %v, got %v", expected, changed)
+	}
+}
+
+func TestChangedLocalFilesWithState(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("local.txt", "content")
+	st.writeLocal("both.txt", "content")
+	st.writeLocal("remote.txt", "content")
+	st.writeLocal("unchanged.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+	// With a state the file is in conflict if the remote file changed since the last sync,
+	// regardless of the modification times
+	st.writeLocal("local.txt", "local change")
+	st.touchLocal("local.txt", time.Now().Add(-time.Hour))
+	st.writeLocal("both.txt", "local change")
+	st.touchLocal("both.txt", time.Now().Add(time.Hour))
+	st.writeRemote("both.txt", "remote change")
+	st.writeRemote("remote.txt", "remote change")
+
+	expected := map[string]bool{"local.txt": false, "both.txt": true, "remote.txt": true}
+	if changed := st.changedLocalFiles(st.stateDir); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Expected changed files %v, got %v", expected, changed)
+	}
+
+	// The remote change is uploaded over unless a conflict resolution is given
+	report, err := st.upload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+	if err == nil || !strings.Contains(err.Error(), "Conflict detected") {
+		t.Fatalf("Expected conflict, got %v", err)
+	}
+	expectPaths(t, "conflicts", conflictPaths(report.Conflicts), []string{"both.txt", "remote.txt"})
+
+	report = st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir, Resolution: constants.KeepRemote})
+	expectPaths(t, "updated files", report.Updated, []string{"local.txt"})
+	expectPaths(t, "skipped files", report.Skipped, []string{"both.txt", "remote.txt"})
+}
+
+func TestUploadSyncConflictResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution constants.ConflictResolution
+		local      string
+		remote     string
+		updated    []string
+		skipped    []string
+	}{
+		{"keep local", constants.KeepLocal, "local", "remote change", []string{"file.txt"}, nil},
+		{"keep remote", constants.KeepRemote, "local change", "remote", nil, []string{"file.txt"}},
+		{"keep largest local", constants.KeepLargest, "local change", "remote", []string{"file.txt"}, nil},
+		{"keep largest remote", constants.KeepLargest, "local", "remote change", nil, []string{"file.txt"}},
+		{"keep largest equal", constants.KeepLargest, "local", "other", nil, []string{"file.txt"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := newSyncTest(t)
+			st.writeLocal("file.txt", "content")
+			st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+			st.writeLocal("file.txt", test.local)
+			st.writeRemote("file.txt", test.remote)
+
+			report := st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir, Resolution: test.resolution})
+
+			expectPaths(t, "updated files", report.Updated, test.updated)
+			expectPaths(t, "skipped files", report.Skipped, test.skipped)
+
+			expected := test.remote
+			if len(test.updated) > 0 {
+				expected = test.local
+			}
+			if content := st.readRemote("file.txt"); content != expected {
+				t.Errorf("Expected remote content '%s', got '%s'", expected, content)
+			}
+		})
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := ioutil.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		resolution constants.ConflictResolution
+		remoteSize int64
+		keep       constants.ModTime
+		skipped    bool
+	}{
+		{"keep local", constants.KeepLocal, 10, constants.LocalLastModified, false},
+		{"keep remote", constants.KeepRemote, 1, constants.RemoteLastModified, false},
+		{"keep largest local", constants.KeepLargest, 1, constants.LocalLastModified, false},
+		{"keep largest remote", constants.KeepLargest, 10, constants.RemoteLastModified, false},
+		{"keep largest equal", constants.KeepLargest, 5, constants.EqualModifiedTime, true},
+		{"no resolution", constants.NoResolution, 1, constants.EqualModifiedTime, true},
+	}
+
+	for _, test := range tests {
+		keep, reason, err := gdrive.ResolveConflict(path, &drive.File{Size: test.remoteSize}, test.resolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keep != test.keep || (reason != "") != test.skipped {
+			t.Errorf("%s: expected keep %d and skipped %v, got %d and reason '%s'", test.name, test.keep, test.skipped, keep, reason)
+		}
+	}
+}
+
+func TestDeleteExtraneousRemoteFilesWithoutState(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("keep.txt", "content")
+	st.writeLocal("dir/file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{})
+
+	st.removeLocal("dir")
+	st.createRemote("remote.txt", "content")
+
+	// Without a state every file that is missing locally is deleted
+	report := st.mustUpload(gdrive.UploadSyncArgs{DeleteExtraneous: true})
+
+	expectPaths(t, "deleted files", report.Deleted, []string{"dir", "dir/file.txt", "remote.txt"})
+	if st.remoteExists("dir") || st.remoteExists("remote.txt") {
+		t.Errorf("Expected extraneous files to be deleted")
+	}
+	st.remoteFile("keep.txt")
+}
+
+func TestDeleteExtraneousRemoteFilesWithState(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("keep.txt", "content")
+	st.writeLocal("deleted.txt", "content")
+	st.writeLocal("dir/file.txt", "content")
+	st.writeLocal("changed/file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+	st.removeLocal("deleted.txt")
+	st.removeLocal("dir")
+	st.removeLocal("changed")
+
+	// Files created or changed on drive since the last sync are kept
+	st.createRemote("remote.txt", "content")
+	st.createRemote("changed/remote.txt", "content")
+
+	report := st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir, DeleteExtraneous: true})
+
+	expectPaths(t, "deleted files", report.Deleted, []string{"deleted.txt", "dir", "dir/file.txt", "changed/file.txt"})
+	for _, relPath := range []string{"deleted.txt", "dir", "changed/file.txt"} {
+		if st.remoteExists(relPath) {
+			t.Errorf("Expected %s to be deleted", relPath)
+		}
+	}
+	for _, relPath := range []string{"keep.txt", "remote.txt", "changed", "changed/remote.txt"} {
+		st.remoteFile(relPath)
+	}
+}
+
+func TestDeleteExtraneousRemoteFilesTrash(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{})
+
+	id := st.remoteFile("file.txt").Id
+	st.removeLocal("file.txt")
+	st.mustUpload(gdrive.UploadSyncArgs{DeleteExtraneous: true, Trash: true})
+
+	f, err := st.store.GetFile(context.Background(), id, "trashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Trashed {
+		t.Errorf("Expected the file to be trashed")
+	}
+}
+
+func TestDeleteExtraneousRemoteFilesFailure(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("a.txt", "content")
+	st.writeLocal("b.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+	st.removeLocal("a.txt")
+	st.removeLocal("b.txt")
+	st.store.FailNext("delete", apiError(403, "insufficientFilePermissions"))
+
+	_, err := st.upload(gdrive.UploadSyncArgs{StateDir: st.stateDir, DeleteExtraneous: true})
+	if err == nil || !strings.Contains(err.Error(), "Failed to delete 1 of 2 files") {
+		t.Fatalf("Expected failed delete, got %v", err)
+	}
+
+	// The state is not saved after a failed sync, so the remaining file is deleted by the next sync
+	report := st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir, DeleteExtraneous: true})
+	if len(report.Deleted) != 1 {
+		t.Errorf("Expected one file to be deleted, got %v", report.Deleted)
+	}
+	if st.remoteExists("a.txt") || st.remoteExists("b.txt") {
+		t.Errorf("Expected extraneous files to be deleted")
+	}
+}
+
+func TestDownloadSyncWithState(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+	// The local file looks newer, but only the remote file changed since the last sync
+	st.writeRemote("file.txt", "remote change")
+	st.touchLocal("file.txt", time.Now().Add(time.Hour))
+
+	report, err := st.download(gdrive.DownloadSyncArgs{})
+	if err == nil || !strings.Contains(err.Error(), "Conflict detected") {
+		t.Fatalf("Expected conflict without state, got %v", err)
+	}
+	expectPaths(t, "conflicts", conflictPaths(report.Conflicts), []string{"file.txt"})
+
+	report, err = st.download(gdrive.DownloadSyncArgs{StateDir: st.stateDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPaths(t, "updated files", report.Updated, []string{"file.txt"})
+	if content := st.readLocal("file.txt"); content != "remote change" {
+		t.Errorf("Expected local content 'remote change', got '%s'", content)
+	}
+
+	// Both sides are equal after the sync
+	expected := map[string]bool{}
+	if changed := st.changedLocalFiles(st.stateDir); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Expected no changed files, got %v", changed)
+	}
+}
+
+func TestDownloadSyncDeletesFilesDeletedOnDrive(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("deleted.txt", "content")
+	st.writeLocal("keep.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+
+	if err := st.store.DeleteFile(context.Background(), st.remoteFile("deleted.txt").Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files created locally since the last sync are kept
+	st.writeLocal("local.txt", "content")
+
+	report, err := st.download(gdrive.DownloadSyncArgs{StateDir: st.stateDir, DeleteExtraneous: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectPaths(t, "deleted files", report.Deleted, []string{"deleted.txt"})
+	st.readLocal("keep.txt")
+	st.readLocal("local.txt")
+}
+
+func TestDownloadSyncRetriesFailedDownloads(t *testing.T) {
+	st := newSyncTest(t)
+	st.writeLocal("file.txt", "content")
+	st.mustUpload(gdrive.UploadSyncArgs{})
+	st.removeLocal("file.txt")
+
+	st.store.FailNext("download", apiError(503, "backendError"))
+
+	report, err := st.download(gdrive.DownloadSyncArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPaths(t, "created files", report.Created, []string{"file.txt"})
+	if content := st.readLocal("file.txt"); content != "content" {
+		t.Errorf("Expected local content 'content', got '%s'", content)
+	}
+}
+
+func TestSyncThroughServer(t *testing.T) {
+	st := newServerSyncTest(t)
+	st.mkdirLocal("a/b")
+	st.mkdirLocal("c")
+	st.writeLocal("a/b/file.txt", "content")
+	st.writeLocal("deleted.txt", "content")
+
+	// Rejected creates of directories with pre-allocated ids are sent again
+	st.store.FailNext("create", apiError(503, "backendError"))
+
+	report := st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir})
+	expectPaths(t, "created dirs", report.CreatedDirs, []string{"a", "a/b", "c"})
+	expectPaths(t, "created files", report.Created, []string{"a/b/file.txt", "deleted.txt"})
+	for _, relPath := range []string{"a", "a/b", "c"} {
+		st.remoteFile(relPath)
+	}
+
+	st.removeLocal("c")
+	st.removeLocal("deleted.txt")
+
+	report = st.mustUpload(gdrive.UploadSyncArgs{StateDir: st.stateDir, DeleteExtraneous: true})
+	expectPaths(t, "deleted files", report.Deleted, []string{"c", "deleted.txt"})
+	if st.remoteExists("c") || st.remoteExists("deleted.txt") {
+		t.Errorf("Expected extraneous files to be deleted")
+	}
+
+	st.writeRemote("a/b/file.txt", "remote change")
+
+	report, err := st.download(gdrive.DownloadSyncArgs{StateDir: st.stateDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPaths(t, "updated files", report.Updated, []string{"a/b/file.txt"})
+	if content := st.readLocal("a/b/file.txt"); content != "remote change" {
+		t.Errorf("Expected local content 'remote change', got '%s'", content)
+	}
+}
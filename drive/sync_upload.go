@@ -1,7 +1,6 @@
 package drive
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -10,12 +9,15 @@ import (
 	"time"
 
 	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 )
 
 type UploadSyncArgs struct {
-	Out              io.Writer
+	// Receives the progress of the sync, may be nil
+	OnEvent          func(SyncEvent)
 	Progress         io.Writer
 	Path             string
 	RootId           string
@@ -23,82 +25,114 @@ type UploadSyncArgs struct {
 	DeleteExtraneous bool
 	ChunkSize        int64
 	Timeout          time.Duration
+	Parallel         int
+	Trash            bool
+	StateDir         string
 	Resolution       constants.ConflictResolution
 	Comparer         FileComparer
+	Mirror           bool
+
+	// The changed files are recorded in the reporter if set
+	report *syncReporter
 }
 
-func (self *Drive) UploadSync(args UploadSyncArgs) error {
+// Uploads the local directory to the sync root and returns a report of the changed files
+func (self *Drive) UploadSync(ctx context.Context, args UploadSyncArgs) (*SyncReport, error) {
+	self = self.withContext(ctx)
+
 	if args.ChunkSize > intMax()-1 {
-		return fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
+		return nil, fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
 	}
 
-	fmt.Fprintln(args.Out, "Starting sync...")
+	// Serialize events as files may be uploaded in parallel
+	args.OnEvent, args.Progress = serializeEvents(args.OnEvent, args.Progress, args.Parallel)
+
+	args.OnEvent(SyncEvent{Kind: SyncStarted})
 	started := time.Now()
 
 	// Create root directory if it does not exist
 	rootDir, err := self.prepareSyncRoot(args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Fprintln(args.Out, "Collecting local and remote file information...")
-	files, err := self.prepareSyncFiles(args.Path, rootDir, args.Comparer)
+	state, err := loadSyncState(args.StateDir, rootDir.Id, args.Path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	args.OnEvent(SyncEvent{Kind: SyncCollecting})
+	files, err := self.prepareSyncFiles(args.Path, rootDir, args.Comparer, state)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find missing and changed files
 	changedFiles := files.filterChangedLocalFiles()
 	missingFiles := files.filterMissingRemoteFiles()
 
-	fmt.Fprintf(args.Out, "Found %d local files and %d remote files\n", len(files.local), len(files.remote))
+	args.OnEvent(SyncEvent{Kind: SyncCollected, LocalFiles: len(files.local), RemoteFiles: len(files.remote)})
+
+	args.report = newSyncReporter(len(files.local), len(files.remote))
 
 	// Ensure that there is enough free space on drive
-	if ok, msg := self.checkRemoteFreeSpace(missingFiles, changedFiles); !ok {
-		return fmt.Errorf(msg)
+	if ok, msg := self.checkRemoteFreeSpace(rootDir, missingFiles, changedFiles); !ok {
+		return nil, fmt.Errorf(msg)
 	}
 
 	// Ensure that we don't overwrite any remote changes
 	if args.Resolution == constants.NoResolution {
-		err = ensureNoRemoteModifications(changedFiles)
-		if err != nil {
-			return fmt.Errorf("Conflict detected!\nThe following files have changed and the remote file are newer than it's local counterpart:\n\n%s\nNo conflict resolution was given, aborting...", err)
+		if conflicts := findConflicts(changedFiles); len(conflicts) > 0 {
+			report := args.report.result(time.Since(started))
+			report.Conflicts = syncConflicts(conflicts)
+			return report, fmt.Errorf("Conflict detected! %d files have changed on both sides, no conflict resolution was given, aborting...", len(conflicts))
 		}
 	}
 
 	// Create missing directories
 	files, err = self.createMissingRemoteDirs(files, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Upload missing files
 	err = self.uploadMissingFiles(missingFiles, files, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Update modified files
 	err = self.updateChangedFiles(changedFiles, rootDir, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Delete extraneous files on drive
 	if args.DeleteExtraneous {
 		err = self.deleteExtraneousRemoteFiles(files, args)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	fmt.Fprintf(args.Out, "Sync finished in %s\n", time.Since(started))
 
-	return nil
+	// Save state so that the next sync can tell which side has changed
+	if !args.DryRun {
+		err = self.saveSyncState(state, args.Path, rootDir, args.Comparer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args.report.result(time.Since(started)), nil
 }
 
 func (self *Drive) prepareSyncRoot(args UploadSyncArgs) (*drive.File, error) {
-	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties"}
-	f, err := self.service.Files.Get(args.RootId).Fields(fields...).Do()
+	if args.Mirror {
+		return self.getMirrorRoot(args.RootId)
+	}
+
+	fields := []googleapi.Field{"id", "name", "mimeType", "appProperties", "driveId"}
+	f, err := self.store.GetFile(self.ctx, args.RootId, fields...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to find root dir: %s", err)
 	}
@@ -115,7 +149,7 @@ func (self *Drive) prepareSyncRoot(args UploadSyncArgs) (*drive.File, error) {
 
 	// This is the first time this directory have been used for sync
 	// Check if the directory is empty
-	isEmpty, err := self.dirIsEmpty(f.Id)
+	isEmpty, err := self.dirIsEmpty(f.Id, f.DriveId)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to check if root dir is empty: %s", err)
 	}
@@ -130,7 +164,7 @@ func (self *Drive) prepareSyncRoot(args UploadSyncArgs) (*drive.File, error) {
 		AppProperties: map[string]string{"sync": "true", "syncRoot": "true"},
 	}
 
-	f, err = self.service.Files.Update(f.Id, dstFile).Fields(fields...).Do()
+	f, err = self.store.UpdateFile(self.ctx, f.Id, WriteFileArgs{File: dstFile, Fields: fields})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to update root directory: %s", err)
 	}
@@ -143,36 +177,68 @@ func (self *Drive) createMissingRemoteDirs(files *syncFiles, args UploadSyncArgs
 	missingCount := len(missingDirs)
 
 	if missingCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d remote directories are missing\n", missingCount)
+		args.OnEvent(SyncEvent{Kind: SyncMissingRemoteDirs, Count: missingCount})
 	}
 
 	// Sort directories so that the dirs with the shortest path comes first
 	sort.Sort(byLocalPathLength(missingDirs))
 
-	for i, lf := range missingDirs {
-		parentPath := parentFilePath(lf.relPath)
-		parent, ok := files.findRemoteByPath(parentPath)
-		if !ok {
-			return nil, fmt.Errorf("Could not find remote directory with path '%s'", parentPath)
+	// Directories with the same path length are created in one batch after their parents
+	for start := 0; start < missingCount; {
+		end := start + 1
+		for end < missingCount && pathLength(missingDirs[end].relPath) == pathLength(missingDirs[start].relPath) {
+			end++
 		}
 
-		fmt.Fprintf(args.Out, "[%04d/%04d] Creating directory %s\n", i+1, missingCount, filepath.Join(files.root.file.Name, lf.relPath))
+		var calls []*batchCall
+		var names []string
+		var created []*RemoteFile
+
+		// The directories are created with pre-allocated ids so that the batch can be sent again safely
+		var ids []string
+		if !args.DryRun {
+			var err error
+			if ids, err = self.generateIds(end - start); err != nil {
+				return nil, err
+			}
+		}
 
-		f, err := self.createMissingRemoteDir(createMissingRemoteDirArgs{
-			name:     lf.info.Name(),
-			parentId: parent.file.Id,
-			rootId:   args.RootId,
-			dryRun:   args.DryRun,
-			try:      0,
-		})
-		if err != nil {
+		for i, lf := range missingDirs[start:end] {
+			parentPath := parentFilePath(lf.relPath)
+			parent, ok := files.findRemoteByPath(parentPath)
+			if !ok {
+				return nil, fmt.Errorf("Could not find remote directory with path '%s'", parentPath)
+			}
+
+			args.OnEvent(SyncEvent{Kind: SyncCreatingDir, Path: filepath.Join(files.root.file.Name, lf.relPath), Index: start + i + 1, Count: missingCount})
+
+			dstFile := self.newRemoteDir(createMissingRemoteDirArgs{
+				name:     lf.info.Name(),
+				parentId: parent.file.Id,
+				rootId:   syncRootIdArg(args.RootId, args.Mirror),
+			})
+
+			rf := &RemoteFile{relPath: lf.relPath, file: dstFile}
+			created = append(created, rf)
+
+			if !args.DryRun {
+				dstFile.Id = ids[i]
+				rf.file = &drive.File{}
+				calls = append(calls, self.createFileCall(dstFile, rf.file))
+				names = append(names, lf.relPath)
+			}
+		}
+
+		if err := batchError("create", names, self.runBatch(calls)); err != nil {
 			return nil, err
 		}
 
-		files.remote = append(files.remote, &RemoteFile{
-			relPath: lf.relPath,
-			file:    f,
-		})
+		for _, rf := range created {
+			args.report.addCreatedDir(rf.relPath)
+		}
+
+		files.remote = append(files.remote, created...)
+		start = end
 	}
 
 	return files, nil
@@ -182,57 +248,58 @@ type createMissingRemoteDirArgs struct {
 	name     string
 	parentId string
 	rootId   string
-	dryRun   bool
-	try      int
 }
 
 func (self *Drive) uploadMissingFiles(missingFiles []*LocalFile, files *syncFiles, args UploadSyncArgs) error {
 	missingCount := len(missingFiles)
 
 	if missingCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d remote files are missing\n", missingCount)
+		args.OnEvent(SyncEvent{Kind: SyncMissingRemoteFiles, Count: missingCount})
 	}
 
-	for i, lf := range missingFiles {
+	return runParallel(args.Parallel, missingCount, func(i int) error {
+		lf := missingFiles[i]
 		parentPath := parentFilePath(lf.relPath)
 		parent, ok := files.findRemoteByPath(parentPath)
 		if !ok {
 			return fmt.Errorf("Could not find remote directory with path '%s'", parentPath)
 		}
 
-		fmt.Fprintf(args.Out, "[%04d/%04d] Uploading %s -> %s\n", i+1, missingCount, lf.relPath, filepath.Join(files.root.file.Name, lf.relPath))
+		args.OnEvent(SyncEvent{Kind: SyncUploading, Path: lf.relPath, Target: filepath.Join(files.root.file.Name, lf.relPath), Index: i + 1, Count: missingCount})
 
-		err := self.uploadMissingFile(parent.file.Id, lf, args, 0)
-		if err != nil {
+		if err := self.uploadMissingFile(parent.file.Id, lf, args, 0); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		args.report.addCreated(lf.relPath)
+		return nil
+	})
 }
 
 func (self *Drive) updateChangedFiles(changedFiles []*changedFile, root *drive.File, args UploadSyncArgs) error {
 	changedCount := len(changedFiles)
 
 	if changedCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d local files has changed\n", changedCount)
+		args.OnEvent(SyncEvent{Kind: SyncChangedLocalFiles, Count: changedCount})
 	}
 
-	for i, cf := range changedFiles {
+	return runParallel(args.Parallel, changedCount, func(i int) error {
+		cf := changedFiles[i]
 		if skip, reason := checkRemoteConflict(cf, args.Resolution); skip {
-			fmt.Fprintf(args.Out, "[%04d/%04d] Skipping %s (%s)\n", i+1, changedCount, cf.local.relPath, reason)
-			continue
+			args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: cf.local.relPath, Reason: reason, Index: i + 1, Count: changedCount})
+			args.report.addSkipped(cf.local.relPath)
+			return nil
 		}
 
-		fmt.Fprintf(args.Out, "[%04d/%04d] Updating %s -> %s\n", i+1, changedCount, cf.local.relPath, filepath.Join(root.Name, cf.local.relPath))
+		args.OnEvent(SyncEvent{Kind: SyncUpdating, Path: cf.local.relPath, Target: filepath.Join(root.Name, cf.local.relPath), Index: i + 1, Count: changedCount})
 
-		err := self.updateChangedFile(cf, args, 0)
-		if err != nil {
+		if err := self.updateChangedFile(cf, args, 0); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		args.report.addUpdated(cf.local.relPath)
+		return nil
+	})
 }
 
 func (self *Drive) deleteExtraneousRemoteFiles(files *syncFiles, args UploadSyncArgs) error {
@@ -240,48 +307,56 @@ func (self *Drive) deleteExtraneousRemoteFiles(files *syncFiles, args UploadSync
 	extraneousCount := len(extraneousFiles)
 
 	if extraneousCount > 0 {
-		fmt.Fprintf(args.Out, "\n%d remote files are extraneous\n", extraneousCount)
+		args.OnEvent(SyncEvent{Kind: SyncExtraneousRemoteFiles, Count: extraneousCount})
 	}
 
 	// Sort files so that the files with the longest path comes first
 	sort.Sort(sort.Reverse(byRemotePathLength(extraneousFiles)))
 
-	for i, rf := range extraneousFiles {
-		fmt.Fprintf(args.Out, "[%04d/%04d] Deleting %s\n", i+1, extraneousCount, filepath.Join(files.root.file.Name, rf.relPath))
+	// Files with the same path length are deleted in one batch before their parents
+	for start := 0; start < extraneousCount; {
+		end := start + 1
+		for end < extraneousCount && pathLength(extraneousFiles[end].relPath) == pathLength(extraneousFiles[start].relPath) {
+			end++
+		}
 
-		err := self.deleteRemoteFile(rf, args, 0)
-		if err != nil {
-			return err
+		var calls []*batchCall
+		var names []string
+
+		for i, rf := range extraneousFiles[start:end] {
+			args.OnEvent(SyncEvent{Kind: deleteEvent(args.Trash), Path: filepath.Join(files.root.file.Name, rf.relPath), Index: start + i + 1, Count: extraneousCount})
+
+			calls = append(calls, self.deleteFileCall(rf.file.Id, args.Trash))
+			names = append(names, rf.relPath)
+		}
+
+		if !args.DryRun {
+			if err := batchError("delete", names, self.runBatch(calls)); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range names {
+			args.report.addDeleted(name)
 		}
+
+		start = end
 	}
 
 	return nil
 }
 
-func (self *Drive) createMissingRemoteDir(args createMissingRemoteDirArgs) (*drive.File, error) {
+func (self *Drive) newRemoteDir(args createMissingRemoteDirArgs) *drive.File {
 	dstFile := &drive.File{
 		Name:          args.name,
 		MimeType:      constants.DirectoryMimeType,
 		Parents:       []string{args.parentId},
-		AppProperties: map[string]string{"sync": "true", "syncRootId": args.rootId},
-	}
-
-	if args.dryRun {
-		return dstFile, nil
+		AppProperties: syncProperties(args.rootId),
 	}
 
-	f, err := self.service.Files.Create(dstFile).Do()
-	if err != nil {
-		if isBackendOrRateLimitError(err) && args.try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(args.try)
-			args.try++
-			return self.createMissingRemoteDir(args)
-		} else {
-			return nil, fmt.Errorf("Failed to create directory: %s", err)
-		}
-	}
-
-	return f, nil
+	// Encrypt name if name encryption is enabled
+	self.setEncryptedName(dstFile)
+	return dstFile
 }
 
 func (self *Drive) uploadMissingFile(parentId string, lf *LocalFile, args UploadSyncArgs, try int) error {
@@ -301,7 +376,12 @@ func (self *Drive) uploadMissingFile(parentId string, lf *LocalFile, args Upload
 	dstFile := &drive.File{
 		Name:          lf.info.Name(),
 		Parents:       []string{parentId},
-		AppProperties: map[string]string{"sync": "true", "syncRootId": args.RootId},
+		AppProperties: syncProperties(syncRootIdArg(args.RootId, args.Mirror)),
+	}
+
+	// Store the md5 of the plaintext as the checksum of the remote file is of the ciphertext
+	if self.cipher != nil {
+		self.setEncrypted(dstFile, util.Md5sum(lf.absPath), lf.info.Size())
 	}
 
 	// Chunk size option
@@ -310,22 +390,54 @@ func (self *Drive) uploadMissingFile(parentId string, lf *LocalFile, args Upload
 	// Wrap file in progress reader
 	progressReader := getProgressReader(srcFile, args.Progress, lf.info.Size())
 
-	// Wrap reader in timeout reader
-	reader, ctx := getTimeoutReaderContext(progressReader, args.Timeout)
+	// Encrypt file if a key is given
+	encryptReader, err := self.encryptReader(progressReader)
+	if err != nil {
+		return err
+	}
+
+	// Hash the data as it is uploaded
+	hasher := newChecksumWriter()
+	hashReader := io.TeeReader(encryptReader, hasher)
 
-	_, err = self.service.Files.Create(dstFile).Fields("id", "name", "size", "md5Checksum").Context(ctx).Media(reader, chunkSize).Do()
+	// Wrap reader in timeout reader
+	reader, ctx := getTimeoutReaderContext(self.ctx, self.getLimitedReader(hashReader), args.Timeout)
+
+	f, err := self.store.CreateFile(withCallerRetries(ctx), WriteFileArgs{
+		File:         dstFile,
+		Fields:       []googleapi.Field{"id", "name", "size", "md5Checksum", "sha256Checksum"},
+		Media:        reader,
+		MediaOptions: []googleapi.MediaOption{chunkSize},
+	})
 	if err != nil {
-		if isBackendOrRateLimitError(err) && try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(try)
+		// Streamed uploads can't be retried by the transport, so they are retried here.
+		// The file may have been created if the response was lost, so the upload is
+		// only sent again if drive refused it
+		if self.retry.shouldRetry(err, try) && isRejectedError(err) {
+			if err := self.retry.wait(self.ctx, err, try); err != nil {
+				return err
+			}
 			try++
 			return self.uploadMissingFile(parentId, lf, args, try)
-		} else if isTimeoutError(err) {
+		} else if self.isTimeoutError(err) {
 			return fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
 		} else {
 			return fmt.Errorf("Failed to upload file: %s", err)
 		}
 	}
 
+	if err = hasher.verifyUpload(f); err != nil {
+		// Remove the corrupt file before uploading it again
+		if try < self.retry.Retries {
+			if delErr := self.store.DeleteFile(self.ctx, f.Id); delErr != nil {
+				return fmt.Errorf("Failed to delete corrupt file: %s", delErr)
+			}
+			try++
+			return self.uploadMissingFile(parentId, lf, args, try)
+		}
+		return err
+	}
+
 	return nil
 }
 
@@ -345,63 +457,83 @@ func (self *Drive) updateChangedFile(cf *changedFile, args UploadSyncArgs, try i
 	// Instantiate drive file
 	dstFile := &drive.File{}
 
+	// Store the md5 of the plaintext as the checksum of the remote file is of the ciphertext
+	if self.cipher != nil {
+		self.setEncrypted(dstFile, util.Md5sum(cf.local.absPath), cf.local.info.Size())
+	}
+
 	// Chunk size option
 	chunkSize := googleapi.ChunkSize(int(args.ChunkSize))
 
 	// Wrap file in progress reader
 	progressReader := getProgressReader(srcFile, args.Progress, cf.local.info.Size())
 
-	// Wrap reader in timeout reader
-	reader, ctx := getTimeoutReaderContext(progressReader, args.Timeout)
+	// Encrypt file if a key is given
+	encryptReader, err := self.encryptReader(progressReader)
+	if err != nil {
+		return err
+	}
+
+	// Hash the data as it is uploaded
+	hasher := newChecksumWriter()
+	hashReader := io.TeeReader(encryptReader, hasher)
 
-	_, err = self.service.Files.Update(cf.remote.file.Id, dstFile).Context(ctx).Media(reader, chunkSize).Do()
+	// Wrap reader in timeout reader
+	reader, ctx := getTimeoutReaderContext(self.ctx, self.getLimitedReader(hashReader), args.Timeout)
+
+	f, err := self.store.UpdateFile(withCallerRetries(ctx), cf.remote.file.Id, WriteFileArgs{
+		File:         dstFile,
+		Fields:       []googleapi.Field{"id", "md5Checksum", "sha256Checksum"},
+		Media:        reader,
+		MediaOptions: []googleapi.MediaOption{chunkSize},
+	})
 	if err != nil {
-		if isBackendOrRateLimitError(err) && try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(try)
+		// Streamed uploads can't be retried by the transport, so they are retried here
+		if self.retry.shouldRetry(err, try) {
+			if err := self.retry.wait(self.ctx, err, try); err != nil {
+				return err
+			}
 			try++
 			return self.updateChangedFile(cf, args, try)
-		} else if isTimeoutError(err) {
+		} else if self.isTimeoutError(err) {
 			return fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
 		} else {
 			return fmt.Errorf("Failed to update file: %s", err)
 		}
 	}
 
-	return nil
-}
-
-func (self *Drive) deleteRemoteFile(rf *RemoteFile, args UploadSyncArgs, try int) error {
-	if args.DryRun {
-		return nil
-	}
-
-	err := self.service.Files.Delete(rf.file.Id).Do()
-	if err != nil {
-		if isBackendOrRateLimitError(err) && try < constants.MaxErrorRetries {
-			exponentialBackoffSleep(try)
+	if err = hasher.verifyUpload(f); err != nil {
+		// Upload the content again, replacing the corrupt content
+		if try < self.retry.Retries {
 			try++
-			return self.deleteRemoteFile(rf, args, try)
-		} else {
-			return fmt.Errorf("Failed to delete file: %s", err)
+			return self.updateChangedFile(cf, args, try)
 		}
+		return err
 	}
 
 	return nil
 }
 
-func (self *Drive) dirIsEmpty(id string) (bool, error) {
+func deleteEvent(trash bool) SyncEventKind {
+	if trash {
+		return SyncTrashing
+	}
+	return SyncDeleting
+}
+
+func (self *Drive) dirIsEmpty(id, driveId string) (bool, error) {
 	query := fmt.Sprintf("'%s' in parents", id)
-	fileList, err := self.service.Files.List().Q(query).Do()
+	fileList, err := self.store.ListFiles(self.ctx, ListPageArgs{Query: query, DriveId: driveId})
 	if err != nil {
-		return false, fmt.Errorf("Empty dir check failed: ", err)
+		return false, fmt.Errorf("Empty dir check failed: %s", err)
 	}
 
 	return len(fileList.Files) == 0, nil
 }
 
 func checkRemoteConflict(cf *changedFile, resolution constants.ConflictResolution) (bool, string) {
-	// No conflict unless remote file was last modified
-	if cf.compareModTime() != constants.RemoteLastModified {
+	// No conflict unless remote file has changed
+	if !cf.conflict {
 		return false, ""
 	}
 
@@ -440,24 +572,18 @@ func checkRemoteConflict(cf *changedFile, resolution constants.ConflictResolutio
 	return true, "conflicting file, unhandled case"
 }
 
-func ensureNoRemoteModifications(files []*changedFile) error {
-	conflicts := findRemoteConflicts(files)
-	if len(conflicts) == 0 {
-		return nil
+func (self *Drive) checkRemoteFreeSpace(root *drive.File, missingFiles []*LocalFile, changedFiles []*changedFile) (bool, string) {
+	// Files in a shared drive does not count against the users storage quota,
+	// they use the pooled storage of the organization which is not exposed by the api
+	if root.DriveId != "" {
+		return true, ""
 	}
 
-	buffer := bytes.NewBufferString("")
-	formatConflicts(conflicts, buffer)
-	return fmt.Errorf(buffer.String())
-}
-
-func (self *Drive) checkRemoteFreeSpace(missingFiles []*LocalFile, changedFiles []*changedFile) (bool, string) {
-	about, err := self.service.About.Get().Fields("storageQuota").Do()
+	quota, err := self.storageQuota()
 	if err != nil {
 		return false, fmt.Sprintf("Failed to determine free space: %s", err)
 	}
 
-	quota := about.StorageQuota
 	if quota.Limit == 0 {
 		return true, ""
 	}
@@ -475,7 +601,7 @@ func (self *Drive) checkRemoteFreeSpace(missingFiles []*LocalFile, changedFiles
 	}
 
 	if totalSize > freeSpace {
-		return false, fmt.Sprintf("Not enough free space, have %s need %s", formatSize(freeSpace, false), formatSize(totalSize, false))
+		return false, fmt.Sprintf("Not enough free space, have %s need %s", util.FormatSize(freeSpace, false), util.FormatSize(totalSize, false))
 	}
 
 	return true, ""
@@ -0,0 +1,618 @@
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Time to wait after the last local event before syncing,
+// so that a burst of events only results in a single sync
+const watchSettleDelay = time.Second * 2
+
+type WatchSyncArgs struct {
+	// Receives the progress of the sync, may be nil
+	OnEvent    func(SyncEvent)
+	Progress   io.Writer
+	Path       string
+	RootId     string
+	StatePath  string
+	StateDir   string
+	Interval   time.Duration
+	ChunkSize  int64
+	Timeout    time.Duration
+	Parallel   int
+	Trash      bool
+	Resolution constants.ConflictResolution
+	Comparer   FileComparer
+}
+
+// State of a watched directory, persisted between runs. The state of
+// the synced files is kept in the sync state shared with sync upload and download
+type watchSession struct {
+	PageToken string `json:"pageToken"`
+}
+
+// Keeps a local directory and a sync root on drive in sync until the context is cancelled.
+// Local changes are picked up with fsnotify and remote changes by polling
+// the changes feed, each change triggers a two-way sync of the directory
+func (self *Drive) WatchSync(ctx context.Context, args WatchSyncArgs) error {
+	self = self.withContext(ctx)
+
+	if args.ChunkSize > intMax()-1 {
+		return fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
+	}
+
+	if args.Interval <= 0 {
+		return fmt.Errorf("Interval must be at least one second")
+	}
+
+	// Serialize events as files may be transferred in parallel
+	args.OnEvent, args.Progress = serializeEvents(args.OnEvent, args.Progress, args.Parallel)
+
+	absPath, err := filepath.Abs(args.Path)
+	if err != nil {
+		return fmt.Errorf("Failed to determine absolute path: %s", err)
+	}
+	args.Path = absPath
+
+	// Create root directory if it does not exist
+	rootDir, err := self.prepareSyncRoot(UploadSyncArgs{RootId: args.RootId})
+	if err != nil {
+		return err
+	}
+
+	syncState, err := loadSyncState(args.StateDir, rootDir.Id, absPath)
+	if err != nil {
+		return err
+	}
+
+	state := &watchState{path: args.StatePath, key: rootDir.Id + ":" + absPath}
+	session, err := state.load()
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		session = &watchSession{}
+	}
+
+	// Start listening for remote changes from now if this is the first run
+	if session.PageToken == "" {
+		session.PageToken, err = self.changesStartPageToken(rootDir.DriveId)
+		if err != nil {
+			return err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Failed to create file watcher: %s", err)
+	}
+	defer watcher.Close()
+
+	if err = watchDirs(watcher, absPath); err != nil {
+		return err
+	}
+
+	w := &syncWatcher{
+		drive:   self,
+		root:    rootDir,
+		state:   syncState,
+		session: session,
+		args:    args,
+	}
+
+	args.OnEvent(SyncEvent{Kind: SyncWatching, Path: absPath, Target: rootDir.Name})
+
+	// Sync changes made while we were not watching
+	w.sync()
+	if err = state.save(session); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(args.Interval)
+	defer ticker.Stop()
+
+	var settle <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			args.OnEvent(SyncEvent{Kind: SyncStopping})
+			return state.save(session)
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return state.save(session)
+			}
+
+			// Skip events caused by the sync itself or by files the sync leaves alone
+			if w.skipsEvent(event) {
+				continue
+			}
+
+			w.handleLocalEvent(watcher, event)
+			settle = time.After(watchSettleDelay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return state.save(session)
+			}
+			args.OnEvent(SyncEvent{Kind: SyncWatchError, Err: fmt.Errorf("File watcher error: %s", err)})
+
+		case <-settle:
+			settle = nil
+			w.sync()
+			if err := state.save(session); err != nil {
+				args.OnEvent(SyncEvent{Kind: SyncWatchError, Err: err})
+			}
+
+		case <-ticker.C:
+			changed, pageToken, err := w.pollChanges()
+			if err != nil {
+				args.OnEvent(SyncEvent{Kind: SyncWatchError, Err: err})
+				continue
+			}
+
+			// The changes are read again on the next poll if the sync fails
+			if changed && !w.sync() {
+				continue
+			}
+
+			session.PageToken = pageToken
+			if err := state.save(session); err != nil {
+				args.OnEvent(SyncEvent{Kind: SyncWatchError, Err: err})
+			}
+		}
+	}
+}
+
+type syncWatcher struct {
+	drive   *Drive
+	root    *drive.File
+	state   *syncState
+	session *watchSession
+	args    WatchSyncArgs
+}
+
+func (self *syncWatcher) handleLocalEvent(watcher *fsnotify.Watcher, event fsnotify.Event) {
+	if event.Op&fsnotify.Create == 0 {
+		return
+	}
+
+	// New directories must be watched as well
+	info, err := os.Stat(event.Name)
+	if err == nil && info.IsDir() {
+		if err = watchDirs(watcher, event.Name); err != nil {
+			self.args.OnEvent(SyncEvent{Kind: SyncWatchError, Err: err})
+		}
+	}
+}
+
+// Returns true if the event concerns a partially downloaded file, the state files
+// or a file that is ignored or filtered out, or that is inside such a directory
+func (self *syncWatcher) skipsEvent(event fsnotify.Event) bool {
+	if strings.HasSuffix(event.Name, incompleteSuffix) {
+		return true
+	}
+
+	for _, statePath := range []string{self.args.StatePath, self.args.StateDir} {
+		absPath, err := filepath.Abs(statePath)
+		if statePath != "" && err == nil && isSubPath(event.Name, []string{absPath}) {
+			return true
+		}
+	}
+
+	relPath, err := filepath.Rel(self.args.Path, event.Name)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+
+	// The ignore files are read again as they may have changed
+	exclude, err := self.drive.prepareSyncExcluder(self.args.Path)
+	if err != nil {
+		return false
+	}
+
+	parts := strings.Split(relPath, string(os.PathSeparator))
+	for i := range parts {
+		path := filepath.Join(parts[:i+1]...)
+
+		// Removed files are checked by their path only
+		item := filterItem{path: filepath.ToSlash(path), dir: i < len(parts)-1}
+		if info, err := os.Lstat(filepath.Join(self.args.Path, path)); err == nil {
+			item = localFilterItem(path, info)
+		}
+
+		if excluded, err := exclude(item); err == nil && excluded {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads the changes feed and returns true if any of the changes concerns the sync root,
+// along with the page token to continue from once the changes has been synced
+func (self *syncWatcher) pollChanges() (bool, string, error) {
+	changed := false
+	pageToken := self.session.PageToken
+
+	syncedIds := map[string]bool{}
+	for _, record := range self.state.records {
+		syncedIds[record.Id] = true
+	}
+
+	for {
+		cl, err := self.drive.changesList(pageToken, self.root.DriveId).Fields("newStartPageToken", "nextPageToken", "changes(fileId,removed,file(appProperties))").Do()
+		if err != nil {
+			return false, "", fmt.Errorf("Failed listing changes: %s", err)
+		}
+
+		for _, c := range cl.Changes {
+			if syncedIds[c.FileId] {
+				changed = true
+			} else if c.File != nil && c.File.AppProperties["syncRootId"] == self.root.Id {
+				changed = true
+			}
+		}
+
+		if cl.NextPageToken == "" {
+			return changed, cl.NewStartPageToken, nil
+		}
+
+		pageToken = cl.NextPageToken
+	}
+}
+
+// Runs a two-way sync and returns true if it succeeded, errors are sent as events
+// instead of returned as a failed sync should not stop the watcher
+func (self *syncWatcher) sync() bool {
+	self.args.OnEvent(SyncEvent{Kind: SyncStarted})
+	started := time.Now()
+
+	if err := self.syncFiles(); err != nil {
+		self.args.OnEvent(SyncEvent{Kind: SyncFailed, Err: err})
+		return false
+	}
+
+	self.args.OnEvent(SyncEvent{Kind: SyncFinished, Duration: time.Since(started)})
+	return true
+}
+
+func (self *syncWatcher) syncFiles() error {
+	files, err := self.drive.prepareSyncFiles(self.args.Path, self.root, self.args.Comparer, self.state)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := self.deleteRemovedFiles(files)
+	if err != nil {
+		return err
+	}
+
+	// Collect file information again as the deleted files are gone
+	if deleted {
+		files, err = self.drive.prepareSyncFiles(self.args.Path, self.root, self.args.Comparer, self.state)
+		if err != nil {
+			return err
+		}
+	}
+
+	downloadArgs := self.downloadArgs(constants.KeepRemote)
+	uploadArgs := self.uploadArgs(constants.KeepLocal)
+
+	// Transfer files that only exist on one side
+	if err = self.drive.createMissingLocalDirs(files, downloadArgs); err != nil {
+		return err
+	}
+
+	if err = self.drive.downloadMissingFiles(files, downloadArgs); err != nil {
+		return err
+	}
+
+	files, err = self.drive.createMissingRemoteDirs(files, uploadArgs)
+	if err != nil {
+		return err
+	}
+
+	missingFiles := files.filterMissingRemoteFiles()
+	downloads, uploads := self.resolveChangedFiles(files, files.filterChangedLocalFiles())
+
+	// Ensure that there is enough free space on drive
+	if ok, msg := self.drive.checkRemoteFreeSpace(self.root, missingFiles, uploads); !ok {
+		return fmt.Errorf(msg)
+	}
+
+	if err = self.drive.uploadMissingFiles(missingFiles, files, uploadArgs); err != nil {
+		return err
+	}
+
+	// Transfer changed files in the direction given by the conflict resolution
+	if err = self.drive.downloadChangedFiles(downloads, downloadArgs); err != nil {
+		return err
+	}
+
+	if err = self.drive.updateChangedFiles(uploads, self.root, uploadArgs); err != nil {
+		return err
+	}
+
+	// Save state so that the next sync can tell which side has changed
+	return self.drive.saveSyncState(self.state, self.args.Path, self.root, self.args.Comparer)
+}
+
+// Propagates deletions of files that existed on both sides after the last sync.
+// Files that has changed since the last sync are kept unless the conflict
+// resolution says otherwise, they will be transferred again by the sync
+func (self *syncWatcher) deleteRemovedFiles(files *syncFiles) (bool, error) {
+	if !files.hasState() {
+		return false, nil
+	}
+
+	remoteByPath := map[string]*RemoteFile{}
+	for _, rf := range files.remote {
+		remoteByPath[rf.relPath] = rf
+	}
+
+	localByPath := map[string]*LocalFile{}
+	for _, lf := range files.local {
+		localByPath[lf.relPath] = lf
+	}
+
+	var localDeleted []*RemoteFile
+	var remoteDeleted []*LocalFile
+
+	for relPath := range files.state.records {
+		rf, remoteExists := remoteByPath[relPath]
+		lf, localExists := localByPath[relPath]
+
+		if localExists && !remoteExists {
+			remoteDeleted = append(remoteDeleted, lf)
+		}
+
+		if remoteExists && !localExists {
+			localDeleted = append(localDeleted, rf)
+		}
+	}
+
+	deleted := false
+
+	// Delete parent directories before their content
+	sort.Sort(byRemotePathLength(localDeleted))
+
+	// Files below a deleted directory are deleted with the directory, so the deletions can be sent in one batch
+	var calls []*batchCall
+	var names []string
+	var deletedDirs []string
+	for _, rf := range localDeleted {
+		if isSubPath(rf.relPath, deletedDirs) {
+			continue
+		}
+
+		if self.args.Resolution != constants.KeepLocal && files.remoteChangedBelow(rf.relPath) {
+			self.args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: filepath.Join(self.root.Name, rf.relPath), Reason: "deleted locally, but the remote file has changed"})
+			continue
+		}
+
+		self.args.OnEvent(SyncEvent{Kind: deleteEvent(self.args.Trash), Path: filepath.Join(self.root.Name, rf.relPath)})
+		calls = append(calls, self.drive.deleteFileCall(rf.file.Id, self.args.Trash))
+		names = append(names, rf.relPath)
+
+		if isDir(rf.file) {
+			deletedDirs = append(deletedDirs, rf.relPath)
+		}
+	}
+
+	errs := self.drive.runBatch(calls)
+	for _, err := range errs {
+		if err == nil {
+			deleted = true
+		}
+	}
+	if err := batchError("delete", names, errs); err != nil {
+		return deleted, err
+	}
+
+	// Delete directory content before the directories
+	sort.Sort(sort.Reverse(byLocalPathLength(remoteDeleted)))
+
+	for _, lf := range remoteDeleted {
+		if lf.info.IsDir() {
+			// Directories are only removed if they are empty, files that were kept stays where they are
+			if err := os.Remove(lf.absPath); err == nil {
+				self.args.OnEvent(SyncEvent{Kind: SyncDeleting, Path: lf.absPath})
+				deleted = true
+			}
+			continue
+		}
+
+		if self.args.Resolution != constants.KeepRemote && files.localChange(lf.relPath, lf) != fileUnchanged {
+			self.args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: lf.absPath, Reason: "deleted on drive, but the local file has changed"})
+			continue
+		}
+
+		self.args.OnEvent(SyncEvent{Kind: SyncDeleting, Path: lf.absPath})
+		if err := os.Remove(lf.absPath); err != nil {
+			return deleted, fmt.Errorf("Failed to delete local file: %s", err)
+		}
+		deleted = true
+	}
+
+	return deleted, nil
+}
+
+// Decides which way each changed file should be transferred. A file is a
+// conflict when both sides has changed since the last sync, which is always
+// the case for the first sync. Conflicts are skipped unless a resolution is given
+func (self *syncWatcher) resolveChangedFiles(files *syncFiles, changedFiles []*changedFile) ([]*changedFile, []*changedFile) {
+	var downloads []*changedFile
+	var uploads []*changedFile
+
+	for _, cf := range changedFiles {
+		localChanged := files.localChange(cf.local.relPath, cf.local) != fileUnchanged
+		remoteChanged := files.remoteChange(cf.remote.relPath, cf.remote) != fileUnchanged
+
+		var keep constants.ModTime
+		if localChanged && !remoteChanged {
+			keep = constants.LocalLastModified
+		} else if remoteChanged && !localChanged {
+			keep = constants.RemoteLastModified
+		} else {
+			var reason string
+			keep, reason = resolveConflict(cf, self.args.Resolution)
+			if reason != "" {
+				self.args.OnEvent(SyncEvent{Kind: SyncSkipping, Path: cf.local.relPath, Reason: reason})
+			}
+		}
+
+		if keep == constants.LocalLastModified {
+			uploads = append(uploads, cf)
+		} else if keep == constants.RemoteLastModified {
+			downloads = append(downloads, cf)
+		}
+	}
+
+	return downloads, uploads
+}
+
+// Returns which side of a conflicting file to keep, or the reason the file is skipped
+func resolveConflict(cf *changedFile, resolution constants.ConflictResolution) (constants.ModTime, string) {
+	switch resolution {
+	case constants.KeepLocal:
+		return constants.LocalLastModified, ""
+	case constants.KeepRemote:
+		return constants.RemoteLastModified, ""
+	case constants.KeepLargest:
+		largest := cf.compareSize()
+		if largest == constants.LocalLargestSize {
+			return constants.LocalLastModified, ""
+		}
+		if largest == constants.RemoteLargestSize {
+			return constants.RemoteLastModified, ""
+		}
+		return constants.EqualModifiedTime, "conflicting file, file sizes are equal"
+	}
+
+	return constants.EqualModifiedTime, "conflicting file, no conflict resolution given"
+}
+
+func (self *syncWatcher) downloadArgs(resolution constants.ConflictResolution) DownloadSyncArgs {
+	return DownloadSyncArgs{
+		OnEvent:    self.args.OnEvent,
+		Progress:   self.args.Progress,
+		RootId:     self.root.Id,
+		Path:       self.args.Path,
+		Timeout:    self.args.Timeout,
+		Parallel:   self.args.Parallel,
+		Resolution: resolution,
+		Comparer:   self.args.Comparer,
+	}
+}
+
+func (self *syncWatcher) uploadArgs(resolution constants.ConflictResolution) UploadSyncArgs {
+	return UploadSyncArgs{
+		OnEvent:    self.args.OnEvent,
+		Progress:   self.args.Progress,
+		Path:       self.args.Path,
+		RootId:     self.root.Id,
+		ChunkSize:  self.args.ChunkSize,
+		Timeout:    self.args.Timeout,
+		Parallel:   self.args.Parallel,
+		Trash:      self.args.Trash,
+		Resolution: resolution,
+		Comparer:   self.args.Comparer,
+	}
+}
+
+// Returns true if path is one of the given dirs or is inside one of them
+func isSubPath(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds root and all directories below it to the watcher
+func watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("Failed to watch %s: %s", path, err)
+		}
+
+		return nil
+	})
+}
+
+type watchState struct {
+	path string
+	key  string
+}
+
+func (self *watchState) load() (*watchSession, error) {
+	sessions, err := self.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions[self.key], nil
+}
+
+func (self *watchState) save(session *watchSession) error {
+	sessions, err := self.read()
+	if err != nil {
+		return err
+	}
+
+	sessions[self.key] = session
+
+	if err = mkdir(self.path); err != nil {
+		return err
+	}
+
+	if err = util.WriteJson(self.path, sessions); err != nil {
+		return fmt.Errorf("Failed to save watch state: %s", err)
+	}
+
+	return nil
+}
+
+func (self *watchState) read() (map[string]*watchSession, error) {
+	sessions := map[string]*watchSession{}
+
+	f, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read watch state: %s", err)
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("Failed to read watch state: %s", err)
+	}
+
+	return sessions, nil
+}
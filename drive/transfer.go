@@ -0,0 +1,19 @@
+package drive
+
+import (
+	"google.golang.org/api/drive/v3"
+)
+
+// The result of uploading or downloading a file
+type TransferResult struct {
+	// The remote file
+	File *drive.File
+	// The local path of the file, empty for streams
+	Path string
+	// Number of bytes transferred
+	Bytes int64
+	// Average transfer rate in bytes per second
+	Rate int64
+	// True if the file was not transferred as it already existed
+	Skipped bool
+}
@@ -0,0 +1,104 @@
+package drive
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+func (self *Drive) trashFile(fileId string) error {
+	_, err := self.store.UpdateFile(self.ctx, fileId, WriteFileArgs{File: &drive.File{Trashed: true}, Fields: []googleapi.Field{"id"}})
+	if err != nil {
+		return fmt.Errorf("Failed to trash file: %s", err)
+	}
+	return nil
+}
+
+type RestoreTrashArgs struct {
+	Id string
+}
+
+// Restores the file from the trash and returns it
+func (self *Drive) RestoreTrash(ctx context.Context, args RestoreTrashArgs) (*drive.File, error) {
+	self = self.withContext(ctx)
+
+	f, err := self.store.GetFile(self.ctx, args.Id, "id", "name", "parents", "appProperties", "trashed", "driveId")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file: %s", err)
+	}
+
+	if !f.Trashed {
+		return nil, fmt.Errorf("'%s' is not in the trash", f.Name)
+	}
+
+	// A file with the same name may have been synced after the file was trashed
+	if syncRootIdOf(f) != "" && !isSyncRoot(f) && len(f.Parents) > 0 {
+		parent, err := self.getParentDir(f.Parents[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if err = self.ensureUniqueSyncName(parent, f.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	dstFile := &drive.File{Trashed: false, ForceSendFields: []string{"Trashed"}}
+
+	_, err = self.store.UpdateFile(self.ctx, f.Id, WriteFileArgs{File: dstFile, Fields: []googleapi.Field{"id"}})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to restore file: %s", err)
+	}
+
+	f.Trashed = false
+	return f, nil
+}
+
+// Empties the trash and returns the number of deleted files,
+// the number is only known when emptying the trash of a shared drive
+func (self *Drive) EmptyTrash(ctx context.Context) (int, error) {
+	self = self.withContext(ctx)
+
+	if self.driveId == "" {
+		err := self.service.Files.EmptyTrash().Context(self.ctx).Do()
+		if err != nil {
+			return 0, fmt.Errorf("Failed to empty trash: %s", err)
+		}
+		return 0, nil
+	}
+
+	// The trash of a shared drive is emptied by deleting the trashed files in batches.
+	// Files in trashed directories are deleted with the directory
+	listArgs := listAllFilesArgs{
+		query:  "trashed = true",
+		fields: []googleapi.Field{"nextPageToken", "files(id,name,explicitlyTrashed)"},
+	}
+	files, err := self.listAllFiles(listArgs)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list trashed files: %s", err)
+	}
+
+	var calls []*batchCall
+	var names []string
+	for _, f := range files {
+		if !f.ExplicitlyTrashed {
+			continue
+		}
+
+		calls = append(calls, self.deleteFileCall(f.Id, false))
+		names = append(names, f.Name)
+	}
+
+	errs := self.runBatch(calls)
+
+	count := 0
+	for _, err := range errs {
+		if err == nil {
+			count++
+		}
+	}
+
+	return count, batchError("delete", names, errs)
+}
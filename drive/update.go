@@ -2,6 +2,8 @@ package drive
 
 import (
 	"fmt"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 	"io"
@@ -11,6 +13,7 @@ import (
 )
 
 type UpdateArgs struct {
+	// Receives progress messages, may be nil
 	Out         io.Writer
 	Progress    io.Writer
 	Id          string
@@ -22,12 +25,17 @@ type UpdateArgs struct {
 	Recursive   bool
 	ChunkSize   int64
 	Timeout     time.Duration
+	StatePath   string
 }
 
-func (self *Drive) Update(args UpdateArgs) error {
+// Uploads the file as the new content of the remote file
+func (self *Drive) Update(ctx context.Context, args UpdateArgs) (*TransferResult, error) {
+	self = self.withContext(ctx)
+	args.Out = discardIfNil(args.Out)
+
 	srcFile, srcFileInfo, err := openFile(args.Path)
 	if err != nil {
-		return fmt.Errorf("Failed to open file: %s", err)
+		return nil, fmt.Errorf("Failed to open file: %s", err)
 	}
 
 	defer srcFile.Close()
@@ -52,29 +60,82 @@ func (self *Drive) Update(args UpdateArgs) error {
 	// Set parent folders
 	dstFile.Parents = args.Parents
 
-	// Chunk size option
-	chunkSize := googleapi.ChunkSize(int(args.ChunkSize))
-
-	// Wrap file in progress reader
-	progressReader := getProgressReader(srcFile, args.Progress, srcFileInfo.Size())
+	// Store the md5 of the plaintext as the checksum of the remote file is of the ciphertext
+	if self.cipher != nil {
+		self.setEncrypted(dstFile, util.Md5sum(args.Path), srcFileInfo.Size())
+	}
 
-	// Wrap reader in timeout reader
-	reader, ctx := getTimeoutReaderContext(progressReader, args.Timeout)
+	// Remove encryption properties left by an earlier version of the file
+	clearEncrypted(dstFile)
 
 	fmt.Fprintf(args.Out, "Uploading %s\n", args.Path)
 	started := time.Now()
 
-	f, err := self.service.Files.Update(args.Id, dstFile).Fields("id", "name", "size").Context(ctx).Media(reader, chunkSize).Do()
+	fields := []googleapi.Field{"id", "name", "size", "md5Checksum", "sha256Checksum"}
+
+	var f *drive.File
+
+	// Checksum of the uploaded data, compared with the checksum calculated by drive
+	hasher := newChecksumWriter()
+
+	// Encrypted uploads can't be resumed as the ciphertext differs between attempts.
+	// Upload sessions are only supported by the drive api, not by other stores
+	if args.StatePath != "" && self.cipher == nil && self.usesApiStore() {
+		// Upload using a resumable session that survives restarts
+		f, err = self.resumableUpload(resumableUploadArgs{
+			statePath: args.StatePath,
+			file:      srcFile,
+			info:      srcFileInfo,
+			method:    "PATCH",
+			fileId:    args.Id,
+			metadata:  dstFile,
+			fields:    fields,
+			chunkSize: args.ChunkSize,
+			progress:  args.Progress,
+			timeout:   args.Timeout,
+			hasher:    hasher,
+		})
+	} else {
+		// Chunk size option
+		chunkSize := googleapi.ChunkSize(int(args.ChunkSize))
+
+		// Wrap file in progress reader
+		progressReader := getProgressReader(srcFile, args.Progress, srcFileInfo.Size())
+
+		// Encrypt file if a key is given
+		var encryptReader io.Reader
+		encryptReader, err = self.encryptReader(progressReader)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hash the data as it is uploaded
+		hashReader := io.TeeReader(encryptReader, hasher)
+
+		// Wrap reader in timeout reader
+		reader, ctx := getTimeoutReaderContext(self.ctx, self.getLimitedReader(hashReader), args.Timeout)
+
+		f, err = self.store.UpdateFile(ctx, args.Id, WriteFileArgs{
+			File:         dstFile,
+			Fields:       fields,
+			Media:        reader,
+			MediaOptions: []googleapi.MediaOption{chunkSize},
+		})
+	}
+
 	if err != nil {
-		if isTimeoutError(err) {
-			return fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
+		if self.isTimeoutError(err) {
+			return nil, fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
 		}
-		return fmt.Errorf("Failed to upload file: %s", err)
+		return nil, fmt.Errorf("Failed to upload file: %s", err)
+	}
+
+	if err = hasher.verifyUpload(f); err != nil {
+		return nil, err
 	}
 
 	// Calculate average upload rate
 	rate := calcRate(f.Size, started, time.Now())
 
-	fmt.Fprintf(args.Out, "Updated %s at %s/s, total %s\n", f.Id, formatSize(rate, false), formatSize(f.Size, false))
-	return nil
+	return &TransferResult{File: f, Path: args.Path, Bytes: f.Size, Rate: rate}, nil
 }
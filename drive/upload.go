@@ -2,16 +2,21 @@ package drive
 
 import (
 	"fmt"
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 	"io"
 	"mime"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 )
 
 type UploadArgs struct {
+	// Receives progress messages, may be nil
 	Out         io.Writer
 	Progress    io.Writer
 	Path        string
@@ -24,22 +29,27 @@ type UploadArgs struct {
 	Delete      bool
 	ChunkSize   int64
 	Timeout     time.Duration
+	StatePath   string
 }
 
-func (self *Drive) Upload(args UploadArgs) error {
+// Uploads the file, or the files in the directory when uploading recursively
+func (self *Drive) Upload(ctx context.Context, args UploadArgs) ([]*TransferResult, error) {
+	self = self.withContext(ctx)
+	args.Out = discardIfNil(args.Out)
+
 	if args.ChunkSize > intMax()-1 {
-		return fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
+		return nil, fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
 	}
 
 	// Ensure that none of the parents are sync dirs
 	for _, parent := range args.Parents {
 		isSyncDir, err := self.isSyncFile(parent)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if isSyncDir {
-			return fmt.Errorf("%s is a sync directory, use 'sync upload' instead", parent)
+			return nil, fmt.Errorf("%s is a sync directory, use 'sync upload' instead", parent)
 		}
 	}
 
@@ -49,104 +59,196 @@ func (self *Drive) Upload(args UploadArgs) error {
 
 	info, err := os.Stat(args.Path)
 	if err != nil {
-		return fmt.Errorf("Failed stat file: %s", err)
+		return nil, fmt.Errorf("Failed stat file: %s", err)
 	}
 
 	if info.IsDir() {
-		return fmt.Errorf("'%s' is a directory, use --recursive to upload directories", info.Name())
+		return nil, fmt.Errorf("'%s' is a directory, use --recursive to upload directories", info.Name())
 	}
 
-	f, rate, err := self.uploadFile(args)
+	result, err := self.uploadFile(args)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Fprintf(args.Out, "Uploaded %s at %s/s, total %s\n", f.Id, formatSize(rate, false), formatSize(f.Size, false))
 
 	if args.Share {
-		err = self.shareAnyoneReader(f.Id)
+		err = self.shareAnyoneReader(result.File.Id)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		fmt.Fprintf(args.Out, "File is readable by anyone at %s\n", f.WebContentLink)
 	}
 
 	if args.Delete {
 		err = os.Remove(args.Path)
 		if err != nil {
-			return fmt.Errorf("Failed to delete file: %s", err)
+			return nil, fmt.Errorf("Failed to delete file: %s", err)
 		}
-		fmt.Fprintf(args.Out, "Removed %s\n", args.Path)
 	}
 
-	return nil
+	return []*TransferResult{result}, nil
 }
 
-func (self *Drive) uploadRecursive(args UploadArgs) error {
+// Uploads a file or directory, relPath is the path of the file
+// relative to the uploaded directory and is used to filter files
+func (self *Drive) uploadRecursive(args UploadArgs) ([]*TransferResult, error) {
 	info, err := os.Stat(args.Path)
 	if err != nil {
-		return fmt.Errorf("Failed stat file: %s", err)
+		return nil, fmt.Errorf("Failed stat file: %s", err)
 	}
 
-	if info.IsDir() {
-		args.Name = ""
-		return self.uploadDirectory(args)
-	} else if info.Mode().IsRegular() {
-		_, _, err := self.uploadFile(args)
-		return err
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return nil, nil
+		}
+		result, err := self.uploadFile(args)
+		if err != nil {
+			return nil, err
+		}
+		return []*TransferResult{result}, nil
 	}
 
-	return nil
-}
-
-func (self *Drive) uploadDirectory(args UploadArgs) error {
-	srcFile, srcFileInfo, err := openFile(args.Path)
+	dirs, files, err := self.collectUploadFiles(args.Path, "")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Close file on function exit
-	defer srcFile.Close()
-
-	fmt.Fprintf(args.Out, "Creating directory %s\n", srcFileInfo.Name())
+	fmt.Fprintf(args.Out, "Creating directory %s\n", info.Name())
 	// Make directory on drive
-	f, err := self.mkdir(MkdirArgs{
-		Out:         args.Out,
-		Name:        srcFileInfo.Name(),
+	root, err := self.mkdir(MkdirArgs{
+		Name:        info.Name(),
 		Parents:     args.Parents,
 		Description: args.Description,
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Ids of the created directories by their path relative to the uploaded directory
+	dirIds := map[string]string{".": root.Id}
+	if err = self.createUploadDirs(args, info.Name(), dirs, dirIds); err != nil {
+		return nil, err
+	}
+
+	var results []*TransferResult
+
+	for _, lf := range files {
+		// Copy args and set new path and parents
+		newArgs := args
+		newArgs.Path = lf.absPath
+		newArgs.Name = ""
+		newArgs.Description = ""
+		newArgs.Parents = []string{dirIds[parentFilePath(lf.relPath)]}
+
+		result, err := self.uploadFile(newArgs)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Returns the directories and regular files below the directory that are not excluded by the filter
+func (self *Drive) collectUploadFiles(absPath, relPath string) ([]*LocalFile, []*LocalFile, error) {
+	srcFile, _, err := openFile(absPath)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Read files from directory
 	names, err := srcFile.Readdirnames(0)
+	srcFile.Close()
 	if err != nil && err != io.EOF {
-		return fmt.Errorf("Failed reading directory: %s", err)
+		return nil, nil, fmt.Errorf("Failed reading directory: %s", err)
 	}
 
+	var dirs, files []*LocalFile
+
 	for _, name := range names {
-		// Copy args and set new path and parents
-		newArgs := args
-		newArgs.Path = filepath.Join(args.Path, name)
-		newArgs.Parents = []string{f.Id}
-		newArgs.Description = ""
+		lf := &LocalFile{absPath: filepath.Join(absPath, name), relPath: filepath.Join(relPath, name)}
+
+		// Symlinks are followed
+		lf.info, err = os.Stat(lf.absPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed stat file: %s", err)
+		}
+
+		if self.isExcluded(localFilterItem(lf.relPath, lf.info)) {
+			continue
+		}
+
+		if lf.info.IsDir() {
+			subDirs, subFiles, err := self.collectUploadFiles(lf.absPath, lf.relPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			dirs = append(append(dirs, lf), subDirs...)
+			files = append(files, subFiles...)
+		} else if lf.info.Mode().IsRegular() {
+			files = append(files, lf)
+		}
+	}
+
+	return dirs, files, nil
+}
+
+// Creates the directories below the uploaded directory, one batch per level
+func (self *Drive) createUploadDirs(args UploadArgs, rootName string, dirs []*LocalFile, dirIds map[string]string) error {
+	// Sort directories so that the dirs with the shortest path comes first
+	sort.Sort(byLocalPathLength(dirs))
+
+	for start := 0; start < len(dirs); {
+		end := start + 1
+		for end < len(dirs) && pathLength(dirs[end].relPath) == pathLength(dirs[start].relPath) {
+			end++
+		}
 
-		// Upload
-		err = self.uploadRecursive(newArgs)
+		// The directories are created with pre-allocated ids so that the batch can be sent again safely
+		ids, err := self.generateIds(end - start)
 		if err != nil {
 			return err
 		}
+
+		var calls []*batchCall
+		var names []string
+		created := make([]*drive.File, end-start)
+
+		for i, lf := range dirs[start:end] {
+			fmt.Fprintf(args.Out, "Creating directory %s\n", filepath.Join(rootName, lf.relPath))
+
+			dstFile := &drive.File{
+				Id:       ids[i],
+				Name:     lf.info.Name(),
+				MimeType: constants.DirectoryMimeType,
+				Parents:  []string{dirIds[parentFilePath(lf.relPath)]},
+			}
+
+			// Encrypt name if name encryption is enabled
+			self.setEncryptedName(dstFile)
+
+			created[i] = &drive.File{}
+			calls = append(calls, self.createFileCall(dstFile, created[i]))
+			names = append(names, lf.relPath)
+		}
+
+		if err := batchError("create", names, self.runBatch(calls)); err != nil {
+			return err
+		}
+
+		for i, lf := range dirs[start:end] {
+			dirIds[lf.relPath] = created[i].Id
+		}
+		start = end
 	}
 
 	return nil
 }
 
-func (self *Drive) uploadFile(args UploadArgs) (*drive.File, int64, error) {
+func (self *Drive) uploadFile(args UploadArgs) (*TransferResult, error) {
 	srcFile, srcFileInfo, err := openFile(args.Path)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	// Close file on function exit
@@ -172,33 +274,84 @@ func (self *Drive) uploadFile(args UploadArgs) (*drive.File, int64, error) {
 	// Set parent folders
 	dstFile.Parents = args.Parents
 
-	// Chunk size option
-	chunkSize := googleapi.ChunkSize(int(args.ChunkSize))
-
-	// Wrap file in progress reader
-	progressReader := getProgressReader(srcFile, args.Progress, srcFileInfo.Size())
-
-	// Wrap reader in timeout reader
-	reader, ctx := getTimeoutReaderContext(progressReader, args.Timeout)
+	// Store the md5 of the plaintext as the checksum of the remote file is of the ciphertext
+	if self.cipher != nil {
+		self.setEncrypted(dstFile, util.Md5sum(args.Path), srcFileInfo.Size())
+	}
 
 	fmt.Fprintf(args.Out, "Uploading %s\n", args.Path)
 	started := time.Now()
 
-	f, err := self.service.Files.Create(dstFile).Fields("id", "name", "size", "md5Checksum", "webContentLink").Context(ctx).Media(reader, chunkSize).Do()
+	fields := []googleapi.Field{"id", "name", "mimeType", "size", "md5Checksum", "sha256Checksum", "webContentLink"}
+
+	var f *drive.File
+
+	// Checksum of the uploaded data, compared with the checksum calculated by drive
+	hasher := newChecksumWriter()
+
+	// Encrypted uploads can't be resumed as the ciphertext differs between attempts.
+	// Upload sessions are only supported by the drive api, not by other stores
+	if args.StatePath != "" && self.cipher == nil && self.usesApiStore() {
+		// Upload using a resumable session that survives restarts
+		f, err = self.resumableUpload(resumableUploadArgs{
+			statePath: args.StatePath,
+			file:      srcFile,
+			info:      srcFileInfo,
+			method:    "POST",
+			metadata:  dstFile,
+			fields:    fields,
+			chunkSize: args.ChunkSize,
+			progress:  args.Progress,
+			timeout:   args.Timeout,
+			hasher:    hasher,
+		})
+	} else {
+		// Chunk size option
+		chunkSize := googleapi.ChunkSize(int(args.ChunkSize))
+
+		// Wrap file in progress reader
+		progressReader := getProgressReader(srcFile, args.Progress, srcFileInfo.Size())
+
+		// Encrypt file if a key is given
+		var encryptReader io.Reader
+		encryptReader, err = self.encryptReader(progressReader)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hash the data as it is uploaded
+		hashReader := io.TeeReader(encryptReader, hasher)
+
+		// Wrap reader in timeout reader
+		reader, ctx := getTimeoutReaderContext(self.ctx, self.getLimitedReader(hashReader), args.Timeout)
+
+		f, err = self.store.CreateFile(ctx, WriteFileArgs{
+			File:         dstFile,
+			Fields:       fields,
+			Media:        reader,
+			MediaOptions: []googleapi.MediaOption{chunkSize},
+		})
+	}
+
 	if err != nil {
-		if isTimeoutError(err) {
-			return nil, 0, fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
+		if self.isTimeoutError(err) {
+			return nil, fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
 		}
-		return nil, 0, fmt.Errorf("Failed to upload file: %s", err)
+		return nil, fmt.Errorf("Failed to upload file: %s", err)
+	}
+
+	if err = hasher.verifyUpload(f); err != nil {
+		return nil, err
 	}
 
 	// Calculate average upload rate
 	rate := calcRate(f.Size, started, time.Now())
 
-	return f, rate, nil
+	return &TransferResult{File: f, Path: args.Path, Bytes: f.Size, Rate: rate}, nil
 }
 
 type UploadStreamArgs struct {
+	// Receives progress messages, may be nil
 	Out         io.Writer
 	In          io.Reader
 	Name        string
@@ -211,9 +364,12 @@ type UploadStreamArgs struct {
 	Timeout     time.Duration
 }
 
-func (self *Drive) UploadStream(args UploadStreamArgs) error {
+func (self *Drive) UploadStream(ctx context.Context, args UploadStreamArgs) (*TransferResult, error) {
+	self = self.withContext(ctx)
+	args.Out = discardIfNil(args.Out)
+
 	if args.ChunkSize > intMax()-1 {
-		return fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
+		return nil, fmt.Errorf("Chunk size is to big, max chunk size for this computer is %d", intMax()-1)
 	}
 
 	// Instantiate empty drive file
@@ -233,31 +389,62 @@ func (self *Drive) UploadStream(args UploadStreamArgs) error {
 	// Wrap file in progress reader
 	progressReader := getProgressReader(args.In, args.Progress, 0)
 
+	// The md5 of the plaintext is calculated while uploading
+	plainHasher := newChecksumWriter()
+	if self.cipher != nil {
+		self.setEncrypted(dstFile, "", 0)
+		progressReader = io.TeeReader(progressReader, plainHasher)
+	}
+
+	// Encrypt file if a key is given
+	encryptReader, err := self.encryptReader(progressReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the data as it is uploaded
+	hasher := newChecksumWriter()
+	hashReader := io.TeeReader(encryptReader, hasher)
+
 	// Wrap reader in timeout reader
-	reader, ctx := getTimeoutReaderContext(progressReader, args.Timeout)
+	reader, ctx := getTimeoutReaderContext(self.ctx, self.getLimitedReader(hashReader), args.Timeout)
 
-	fmt.Fprintf(args.Out, "Uploading %s\n", dstFile.Name)
+	fmt.Fprintf(args.Out, "Uploading %s\n", args.Name)
 	started := time.Now()
 
-	f, err := self.service.Files.Create(dstFile).Fields("id", "name", "size", "webContentLink").Context(ctx).Media(reader, chunkSize).Do()
+	f, err := self.store.CreateFile(ctx, WriteFileArgs{
+		File:         dstFile,
+		Fields:       []googleapi.Field{"id", "name", "size", "md5Checksum", "sha256Checksum", "webContentLink"},
+		Media:        reader,
+		MediaOptions: []googleapi.MediaOption{chunkSize},
+	})
 	if err != nil {
-		if isTimeoutError(err) {
-			return fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
+		if self.isTimeoutError(err) {
+			return nil, fmt.Errorf("Failed to upload file: timeout, no data was transferred for %v", args.Timeout)
+		}
+		return nil, fmt.Errorf("Failed to upload file: %s", err)
+	}
+
+	if err = hasher.verifyUpload(f); err != nil {
+		return nil, err
+	}
+
+	if self.cipher != nil {
+		err = self.setPlainChecksum(f.Id, plainHasher)
+		if err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("Failed to upload file: %s", err)
 	}
 
 	// Calculate average upload rate
 	rate := calcRate(f.Size, started, time.Now())
 
-	fmt.Fprintf(args.Out, "Uploaded %s at %s/s, total %s\n", f.Id, formatSize(rate, false), formatSize(f.Size, false))
 	if args.Share {
 		err = self.shareAnyoneReader(f.Id)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		fmt.Fprintf(args.Out, "File is readable by anyone at %s\n", f.WebContentLink)
 	}
-	return nil
+
+	return &TransferResult{File: f, Bytes: f.Size, Rate: rate}, nil
 }
@@ -0,0 +1,223 @@
+package drive_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	gdrive "github.com/grandeto/gdrive/drive"
+	"github.com/grandeto/gdrive/fakedrive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Serves a fake drive and counts the chunks sent to resumable uploads.
+// Chunks for which refuse returns true are refused with a 503
+type chunkServer struct {
+	*httptest.Server
+	drive  *fakedrive.Server
+	mutex  *sync.Mutex
+	chunks int
+	refuse func(chunk int) bool
+}
+
+func newChunkServer(t *testing.T, store *fakedrive.Store, refuse func(chunk int) bool) *chunkServer {
+	server := &chunkServer{drive: fakedrive.NewServer(store), mutex: &sync.Mutex{}, refuse: refuse}
+	server.Server = httptest.NewServer(server)
+	t.Cleanup(server.Close)
+	t.Cleanup(server.drive.Close)
+	return server
+}
+
+func (self *chunkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests without content only ask for the number of received bytes
+	if r.URL.Query().Get("upload_id") == "" || r.ContentLength == 0 {
+		self.drive.ServeHTTP(w, r)
+		return
+	}
+
+	self.mutex.Lock()
+	chunk := self.chunks
+	self.chunks++
+	self.mutex.Unlock()
+
+	if self.refuse(chunk) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"code": 503, "message": "Backend error", "errors": [{"reason": "backendError"}]}}`))
+		return
+	}
+
+	self.drive.ServeHTTP(w, r)
+}
+
+// Returns the number of chunks received so far, including the refused ones
+func (self *chunkServer) chunkCount() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.chunks
+}
+
+// Writes a local file that is sent in three chunks of the minimum chunk size
+func writeChunkedFile(t *testing.T) (string, []byte) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 40*1024)
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+func TestResumableUploadContinuesAfterFailedChunk(t *testing.T) {
+	store := fakedrive.NewStore()
+	server := newChunkServer(t, store, func(chunk int) bool { return chunk == 1 })
+
+	client := newTestClient(t)
+	client.SetEndpoint(server.URL)
+
+	path, content := writeChunkedFile(t)
+	results, err := client.Upload(context.Background(), gdrive.UploadArgs{
+		Path:      path,
+		Parents:   []string{fakedrive.RootId},
+		ChunkSize: 256 * 1024,
+		StatePath: filepath.Join(t.TempDir(), "upload_state.json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := store.Content(results[0].File.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uploaded, content) {
+		t.Errorf("Expected the uploaded content to match the local file")
+	}
+
+	// The refused chunk is sent again from the offset committed by drive
+	if count := server.chunkCount(); count != 4 {
+		t.Errorf("Expected 4 chunks to be sent, got %d", count)
+	}
+}
+
+func TestResumableUploadResumesSessionOfEarlierRun(t *testing.T) {
+	store := fakedrive.NewStore()
+	server := newChunkServer(t, store, func(chunk int) bool { return chunk == 1 })
+
+	client := newTestClient(t)
+	client.SetEndpoint(server.URL)
+
+	path, content := writeChunkedFile(t)
+	args := gdrive.UploadArgs{
+		Path:      path,
+		Parents:   []string{fakedrive.RootId},
+		ChunkSize: 256 * 1024,
+		StatePath: filepath.Join(t.TempDir(), "upload_state.json"),
+	}
+
+	// The first run stops at the refused chunk
+	client.SetRetryPolicy(gdrive.RetryPolicy{})
+	if _, err := client.Upload(context.Background(), args); err == nil {
+		t.Fatal("Expected the first upload to fail")
+	}
+
+	// The second run continues the session, the checksum includes the data sent by the first run
+	results, err := client.Upload(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded, err := store.Content(results[0].File.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uploaded, content) {
+		t.Errorf("Expected the uploaded content to match the local file")
+	}
+
+	if count := server.chunkCount(); count != 4 {
+		t.Errorf("Expected 4 chunks to be sent, got %d", count)
+	}
+}
+
+func TestChunkedUploadRetriesFailedChunkAccordingToPolicy(t *testing.T) {
+	store := fakedrive.NewStore()
+	server := newChunkServer(t, store, func(chunk int) bool { return true })
+
+	client := newTestClient(t)
+	client.SetEndpoint(server.URL)
+
+	// Without a state file the chunks are sent by the api library
+	path, _ := writeChunkedFile(t)
+	_, err := client.Upload(context.Background(), gdrive.UploadArgs{
+		Path:      path,
+		Parents:   []string{fakedrive.RootId},
+		ChunkSize: 256 * 1024,
+	})
+	if err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+
+	// The first chunk is sent once and retried twice, by the transport only
+	if count := server.chunkCount(); count != 3 {
+		t.Errorf("Expected 3 tries of the first chunk, got %d", count)
+	}
+}
+
+func TestRecursiveUploadCreatesDirectoriesBelowTheirParents(t *testing.T) {
+	store := fakedrive.NewStore()
+	client := newTestClient(t)
+	client.SetStore(store)
+
+	root := filepath.Join(t.TempDir(), "src")
+	for _, path := range []string{"top.txt", "a/x.txt", "a/b/file.txt", "c/file.txt"} {
+		absPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(absPath, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := client.Upload(context.Background(), gdrive.UploadArgs{
+		Path:      root,
+		Parents:   []string{fakedrive.RootId},
+		Recursive: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 uploaded files, got %d", len(results))
+	}
+
+	byId := map[string]*drive.File{}
+	for _, f := range store.Files() {
+		byId[f.Id] = f
+	}
+
+	// Every file is uploaded to the directory matching its local path
+	for _, result := range results {
+		var names []string
+		for f := result.File; f.Parents[0] != fakedrive.RootId; f = byId[f.Parents[0]] {
+			names = append([]string{byId[f.Parents[0]].Name}, names...)
+		}
+		names = append(names, result.File.Name)
+
+		content, err := store.Content(result.File.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path := strings.Join(names, "/"); path != "src/"+string(content) {
+			t.Errorf("Expected %s to be uploaded to src/%s", path, content)
+		}
+	}
+}
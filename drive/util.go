@@ -8,37 +8,27 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 )
 
-type kv struct {
-	key   string
-	value string
-}
-
-func formatList(a []string) string {
-	return strings.Join(a, ", ")
-}
+// Parses a number of bytes with an optional K, M or G suffix, i.e. 500K or 1.5G
+func parseByteSize(value string) (int64, bool) {
+	multipliers := map[byte]int64{'B': 1, 'K': 1000, 'M': 1000 * 1000, 'G': 1000 * 1000 * 1000}
 
-func formatSize(bytes int64, forceBytes bool) string {
-	if bytes == 0 {
-		return ""
+	number := value
+	multiplier := int64(1)
+	if len(value) > 0 {
+		if m, ok := multipliers[strings.ToUpper(value)[len(value)-1]]; ok {
+			number = value[:len(value)-1]
+			multiplier = m
+		}
 	}
 
-	if forceBytes {
-		return fmt.Sprintf("%v B", bytes)
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, false
 	}
 
-	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
-
-	var i int
-	value := float64(bytes)
-
-	for value > 1000 {
-		value /= 1000
-		i++
-	}
-	return fmt.Sprintf("%.1f %s", value, units[i])
+	return int64(size * float64(multiplier)), true
 }
 
 func calcRate(bytes int64, start, end time.Time) int64 {
@@ -56,65 +46,6 @@ func round(n float64) int64 {
 	return int64(math.Floor(n + 0.5))
 }
 
-func formatBool(b bool) string {
-	return strings.Title(strconv.FormatBool(b))
-}
-
-func formatDatetime(iso string) string {
-	t, err := time.Parse(time.RFC3339, iso)
-	if err != nil {
-		return iso
-	}
-	local := t.Local()
-	year, month, day := local.Date()
-	hour, min, sec := local.Clock()
-	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, min, sec)
-}
-
-// Truncates string to given max length, and inserts ellipsis into
-// the middle of the string to signify that the string has been truncated
-func truncateString(str string, maxRunes int) string {
-	indicator := "..."
-
-	// Number of runes in string
-	runeCount := utf8.RuneCountInString(str)
-
-	// Return input string if length of input string is less than max length
-	// Input string is also returned if max length is less than 9 which is the minmal supported length
-	if runeCount <= maxRunes || maxRunes < 9 {
-		return str
-	}
-
-	// Number of remaining runes to be removed
-	remaining := (runeCount - maxRunes) + utf8.RuneCountInString(indicator)
-
-	var truncated string
-	var skip bool
-
-	for leftOffset, char := range str {
-		rightOffset := runeCount - (leftOffset + remaining)
-
-		// Start skipping chars when the left and right offsets are equal
-		// Or in the case where we wont be able to do an even split: when the left offset is larger than the right offset
-		if leftOffset == rightOffset || (leftOffset > rightOffset && !skip) {
-			skip = true
-			truncated += indicator
-		}
-
-		if skip && remaining > 0 {
-			// Skip char and decrement the remaining skip counter
-			remaining--
-			continue
-		}
-
-		// Add char to result string
-		truncated += string(char)
-	}
-
-	// Return truncated string
-	return truncated
-}
-
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -144,11 +75,6 @@ func parentFilePath(path string) string {
 	return filepath.Dir(dir)
 }
 
-func pow(x int, y int) int {
-	f := math.Pow(float64(x), float64(y))
-	return int(f)
-}
-
 func min(x int, y int) int {
 	n := math.Min(float64(x), float64(y))
 	return int(n)
@@ -167,3 +93,9 @@ func openFile(path string) (*os.File, os.FileInfo, error) {
 
 	return f, info, nil
 }
+
+// Escapes a string value used in a search query
+func escapeQuery(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, `'`, `\'`, -1)
+}
@@ -0,0 +1,63 @@
+package drive
+
+import (
+	"sync"
+)
+
+// Calls fn for each index in [0, count) using the given number of workers.
+// Indexes are handed out in order, no new work is handed out after the
+// first error and that error is returned when all workers are done
+func runParallel(workers, count int, fn func(int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	next := 0
+
+	nextIndex := func() (int, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if firstErr != nil || next >= count {
+			return 0, false
+		}
+
+		i := next
+		next++
+		return i, true
+	}
+
+	setErr := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < min(workers, count); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				i, ok := nextIndex()
+				if !ok {
+					return
+				}
+
+				if err := fn(i); err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
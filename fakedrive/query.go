@@ -0,0 +1,423 @@
+package fakedrive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Returns true if the file matches the query
+type matchFunc func(f *drive.File) bool
+
+// Parses a files.list query. The operators and, or, not and parentheses are
+// supported along with the terms used by gdrive, i.e. "'<id>' in parents",
+// "name = '<name>'", "trashed = false" and "appProperties has {key='k' and value='v'}"
+func parseQuery(query string) (matchFunc, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty query matches all files
+	if len(tokens) == 0 {
+		return func(*drive.File) bool { return true }, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("Unexpected '%s' in query", p.peek().value)
+	}
+
+	return match, nil
+}
+
+const (
+	tokenString = iota
+	tokenWord
+	tokenSymbol
+)
+
+type queryToken struct {
+	kind  int
+	value string
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			value, n, err := readQueryString(query[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{tokenString, value})
+			i += n
+		case strings.HasPrefix(query[i:], "!=") || strings.HasPrefix(query[i:], "<=") || strings.HasPrefix(query[i:], ">="):
+			tokens = append(tokens, queryToken{tokenSymbol, query[i : i+2]})
+			i += 2
+		case strings.ContainsRune("(){}=<>", rune(c)):
+			tokens = append(tokens, queryToken{tokenSymbol, string(c)})
+			i++
+		case isWordChar(c):
+			start := i
+			for i < len(query) && isWordChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokenWord, query[start:i]})
+		default:
+			return nil, fmt.Errorf("Unexpected character '%c' in query", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Reads a quoted string, returns the unescaped value and the number of bytes read
+func readQueryString(s string) (string, int, error) {
+	var value strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '\'':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, fmt.Errorf("Unterminated string in query")
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (self *queryParser) done() bool {
+	return self.pos >= len(self.tokens)
+}
+
+func (self *queryParser) peek() queryToken {
+	if self.done() {
+		return queryToken{}
+	}
+	return self.tokens[self.pos]
+}
+
+func (self *queryParser) next() (queryToken, error) {
+	if self.done() {
+		return queryToken{}, fmt.Errorf("Unexpected end of query")
+	}
+	token := self.tokens[self.pos]
+	self.pos++
+	return token, nil
+}
+
+// Returns true and moves past the next token if it is the given word or symbol
+func (self *queryParser) accept(value string) bool {
+	token := self.peek()
+	if token.kind != tokenString && strings.EqualFold(token.value, value) && !self.done() {
+		self.pos++
+		return true
+	}
+	return false
+}
+
+func (self *queryParser) expect(value string) error {
+	if !self.accept(value) {
+		return fmt.Errorf("Expected '%s' in query", value)
+	}
+	return nil
+}
+
+func (self *queryParser) parseOr() (matchFunc, error) {
+	left, err := self.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for self.accept("or") {
+		right, err := self.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orMatch(left, right)
+	}
+
+	return left, nil
+}
+
+func (self *queryParser) parseAnd() (matchFunc, error) {
+	left, err := self.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for self.accept("and") {
+		right, err := self.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andMatch(left, right)
+	}
+
+	return left, nil
+}
+
+func (self *queryParser) parseNot() (matchFunc, error) {
+	if !self.accept("not") {
+		return self.parsePrimary()
+	}
+
+	match, err := self.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return func(f *drive.File) bool { return !match(f) }, nil
+}
+
+func (self *queryParser) parsePrimary() (matchFunc, error) {
+	if self.accept("(") {
+		match, err := self.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return match, self.expect(")")
+	}
+
+	token, err := self.next()
+	if err != nil {
+		return nil, err
+	}
+
+	// '<value>' in <collection>
+	if token.kind == tokenString {
+		if err := self.expect("in"); err != nil {
+			return nil, err
+		}
+		collection, err := self.next()
+		if err != nil {
+			return nil, err
+		}
+		return inMatch(token.value, collection.value)
+	}
+
+	if token.kind != tokenWord {
+		return nil, fmt.Errorf("Unexpected '%s' in query", token.value)
+	}
+
+	field := token.value
+
+	if self.accept("has") {
+		return self.parseHas(field)
+	}
+
+	operator, err := self.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if operator.kind != tokenSymbol && !strings.EqualFold(operator.value, "contains") {
+		return nil, fmt.Errorf("Unexpected '%s' in query", operator.value)
+	}
+
+	value, err := self.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return compareMatch(field, strings.ToLower(operator.value), value)
+}
+
+// Parses the rest of "<properties> has {key='<key>' and value='<value>'}"
+func (self *queryParser) parseHas(field string) (matchFunc, error) {
+	if field != "appProperties" && field != "properties" {
+		return nil, fmt.Errorf("Unsupported field '%s' in query", field)
+	}
+
+	if err := self.expect("{"); err != nil {
+		return nil, err
+	}
+
+	key, err := self.parseAssignment("key")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := self.expect("and"); err != nil {
+		return nil, err
+	}
+
+	value, err := self.parseAssignment("value")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := self.expect("}"); err != nil {
+		return nil, err
+	}
+
+	return func(f *drive.File) bool {
+		properties := f.AppProperties
+		if field == "properties" {
+			properties = f.Properties
+		}
+		v, ok := properties[key]
+		return ok && v == value
+	}, nil
+}
+
+// Parses "<name> = '<value>'" and returns the value
+func (self *queryParser) parseAssignment(name string) (string, error) {
+	if err := self.expect(name); err != nil {
+		return "", err
+	}
+
+	if err := self.expect("="); err != nil {
+		return "", err
+	}
+
+	token, err := self.next()
+	if err != nil {
+		return "", err
+	}
+
+	if token.kind != tokenString {
+		return "", fmt.Errorf("Expected a string after '%s =' in query", name)
+	}
+	return token.value, nil
+}
+
+func inMatch(value, collection string) (matchFunc, error) {
+	switch collection {
+	case "parents":
+		return func(f *drive.File) bool {
+			for _, parent := range f.Parents {
+				if parent == value {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "owners", "writers", "readers":
+		// All files are owned by the one user of the fake
+		return func(*drive.File) bool { return value == "me" }, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported collection '%s' in query", collection)
+}
+
+func compareMatch(field, operator string, token queryToken) (matchFunc, error) {
+	switch field {
+	case "name", "mimeType", "fullText":
+		if token.kind != tokenString {
+			return nil, fmt.Errorf("Expected a string value for '%s' in query", field)
+		}
+		return stringMatch(field, operator, token.value)
+	case "trashed", "starred":
+		if token.kind != tokenWord || (token.value != "true" && token.value != "false") {
+			return nil, fmt.Errorf("Expected true or false for '%s' in query", field)
+		}
+		if operator != "=" && operator != "!=" {
+			return nil, fmt.Errorf("Unsupported operator '%s' for '%s' in query", operator, field)
+		}
+		want := (token.value == "true") == (operator == "=")
+		return func(f *drive.File) bool {
+			if field == "trashed" {
+				return f.Trashed == want
+			}
+			return f.Starred == want
+		}, nil
+	case "modifiedTime", "createdTime":
+		if token.kind != tokenString {
+			return nil, fmt.Errorf("Expected a string value for '%s' in query", field)
+		}
+		return timeMatch(field, operator, token.value)
+	}
+
+	return nil, fmt.Errorf("Unsupported field '%s' in query", field)
+}
+
+func stringMatch(field, operator, value string) (matchFunc, error) {
+	get := func(f *drive.File) string {
+		switch field {
+		case "name":
+			return f.Name
+		case "mimeType":
+			return f.MimeType
+		}
+		return f.Name + "\n" + f.Description
+	}
+
+	switch operator {
+	case "=":
+		return func(f *drive.File) bool { return get(f) == value }, nil
+	case "!=":
+		return func(f *drive.File) bool { return get(f) != value }, nil
+	case "contains":
+		return func(f *drive.File) bool {
+			return strings.Contains(strings.ToLower(get(f)), strings.ToLower(value))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported operator '%s' for '%s' in query", operator, field)
+}
+
+func timeMatch(field, operator, value string) (matchFunc, error) {
+	want, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid time '%s' in query", value)
+	}
+
+	compare := map[string]func(time.Time) bool{
+		"=":  func(t time.Time) bool { return t.Equal(want) },
+		"!=": func(t time.Time) bool { return !t.Equal(want) },
+		"<":  func(t time.Time) bool { return t.Before(want) },
+		"<=": func(t time.Time) bool { return !t.After(want) },
+		">":  func(t time.Time) bool { return t.After(want) },
+		">=": func(t time.Time) bool { return !t.Before(want) },
+	}[operator]
+
+	if compare == nil {
+		return nil, fmt.Errorf("Unsupported operator '%s' for '%s' in query", operator, field)
+	}
+
+	return func(f *drive.File) bool {
+		value := f.ModifiedTime
+		if field == "createdTime" {
+			value = f.CreatedTime
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		return err == nil && compare(t)
+	}, nil
+}
+
+func andMatch(left, right matchFunc) matchFunc {
+	return func(f *drive.File) bool { return left(f) && right(f) }
+}
+
+func orMatch(left, right matchFunc) matchFunc {
+	return func(f *drive.File) bool { return left(f) || right(f) }
+}
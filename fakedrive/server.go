@@ -0,0 +1,621 @@
+package fakedrive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	gdrive "github.com/grandeto/gdrive/drive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// A fake of the drive api backed by a store, for running gdrive or any other
+// api client without google. The files, generate ids, upload, batch and about
+// endpoints are served, other endpoints respond with 501 Not Implemented
+type Server struct {
+	*httptest.Server
+	store      gdrive.RemoteStore
+	mutex      *sync.Mutex
+	uploads    map[string]*uploadSession
+	nextUpload int
+	nextId     int
+}
+
+// A resumable upload that is in progress or completed
+type uploadSession struct {
+	fileId   string
+	metadata *drive.File
+	content  []byte
+	file     *drive.File
+}
+
+// Starts a server for the store, the server must be closed when done
+func NewServer(store gdrive.RemoteStore) *Server {
+	server := &Server{
+		store:   store,
+		mutex:   &sync.Mutex{},
+		uploads: map[string]*uploadSession{},
+	}
+	server.Server = httptest.NewServer(server)
+	return server
+}
+
+func (self *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == "/batch/drive/v3" && r.Method == "POST":
+		self.handleBatch(w, r)
+	case path == "/drive/v3/about" && r.Method == "GET":
+		self.handleAbout(w, r)
+	case path == "/drive/v3/files":
+		self.handleFiles(w, r)
+	case path == "/drive/v3/files/generateIds" && r.Method == "GET":
+		self.handleGenerateIds(w, r)
+	case strings.HasPrefix(path, "/drive/v3/files/") && !strings.Contains(strings.TrimPrefix(path, "/drive/v3/files/"), "/"):
+		self.handleFile(w, r, strings.TrimPrefix(path, "/drive/v3/files/"))
+	case path == "/upload/drive/v3/files" || strings.HasPrefix(path, "/upload/drive/v3/files/"):
+		self.handleUpload(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "/upload/drive/v3/files"), "/"))
+	default:
+		writeError(w, apiError(501, "notImplemented", fmt.Sprintf("%s %s is not implemented by the fake", r.Method, path)))
+	}
+}
+
+func (self *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	switch r.Method {
+	case "GET":
+		pageSize, _ := strconv.ParseInt(query.Get("pageSize"), 10, 64)
+		fl, err := self.store.ListFiles(r.Context(), gdrive.ListPageArgs{
+			Query:     query.Get("q"),
+			Fields:    requestFields(r),
+			OrderBy:   query.Get("orderBy"),
+			PageSize:  pageSize,
+			PageToken: query.Get("pageToken"),
+			DriveId:   query.Get("driveId"),
+		})
+		writeResult(w, fl, err)
+	case "POST":
+		metadata, err := decodeFile(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		f, err := self.store.CreateFile(r.Context(), gdrive.WriteFileArgs{
+			File:   metadata,
+			Fields: requestFields(r),
+		})
+		writeResult(w, f, err)
+	default:
+		writeError(w, apiError(405, "methodNotAllowed", "Method not allowed"))
+	}
+}
+
+// The ids are not reserved in the store, they are unique as long as the
+// files of the store are not created with ids on the same form
+func (self *Server) handleGenerateIds(w http.ResponseWriter, r *http.Request) {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count <= 0 {
+		count = 10
+	}
+
+	self.mutex.Lock()
+	var ids []string
+	for i := 0; i < count; i++ {
+		self.nextId++
+		ids = append(ids, fmt.Sprintf("generated%06d", self.nextId))
+	}
+	self.mutex.Unlock()
+
+	writeJSON(w, 200, &drive.GeneratedIds{Ids: ids, Kind: "drive#generatedIds", Space: "drive"})
+}
+
+func (self *Server) handleFile(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+
+	switch r.Method {
+	case "GET":
+		if query.Get("alt") == "media" {
+			self.handleDownload(w, r, id)
+			return
+		}
+
+		f, err := self.store.GetFile(r.Context(), id, requestFields(r)...)
+		writeResult(w, f, err)
+	case "PATCH":
+		metadata, err := decodeFile(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		f, err := self.store.UpdateFile(r.Context(), id, gdrive.WriteFileArgs{
+			File:          metadata,
+			Fields:        requestFields(r),
+			AddParents:    query.Get("addParents"),
+			RemoveParents: query.Get("removeParents"),
+		})
+		writeResult(w, f, err)
+	case "DELETE":
+		if err := self.store.DeleteFile(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, apiError(405, "methodNotAllowed", "Method not allowed"))
+	}
+}
+
+func (self *Server) handleDownload(w http.ResponseWriter, r *http.Request, id string) {
+	var offset int64
+	if value := r.Header.Get("Range"); value != "" {
+		var err error
+		if offset, err = parseRange(value); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	res, err := self.store.DownloadFile(r.Context(), id, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer res.Body.Close()
+
+	for key, values := range res.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+// Handles simple, multipart and resumable uploads. The id is empty for new files
+func (self *Server) handleUpload(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+
+	// Chunks are sent with PUT by gdrive and with POST by the go client library
+	if query.Get("upload_id") != "" {
+		self.handleUploadChunk(w, r, query.Get("upload_id"))
+		return
+	}
+
+	if (id == "" && r.Method != "POST") || (id != "" && r.Method != "PATCH") {
+		writeError(w, apiError(405, "methodNotAllowed", "Method not allowed"))
+		return
+	}
+
+	var metadata *drive.File
+	var media io.Reader
+	var err error
+
+	switch query.Get("uploadType") {
+	case "media":
+		media = r.Body
+	case "multipart":
+		metadata, media, err = readMultipartUpload(r)
+	case "resumable":
+		self.startResumableUpload(w, r, id)
+		return
+	default:
+		err = apiError(400, "invalid", fmt.Sprintf("Unsupported upload type '%s'", query.Get("uploadType")))
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	f, err := self.writeFile(r, id, metadata, media)
+	writeResult(w, f, err)
+}
+
+func (self *Server) writeFile(r *http.Request, id string, metadata *drive.File, media io.Reader) (*drive.File, error) {
+	query := r.URL.Query()
+	args := gdrive.WriteFileArgs{
+		File:          metadata,
+		Fields:        requestFields(r),
+		Media:         media,
+		AddParents:    query.Get("addParents"),
+		RemoveParents: query.Get("removeParents"),
+	}
+
+	if id == "" {
+		return self.store.CreateFile(r.Context(), args)
+	}
+	return self.store.UpdateFile(r.Context(), id, args)
+}
+
+func (self *Server) startResumableUpload(w http.ResponseWriter, r *http.Request, id string) {
+	metadata, err := decodeFile(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	self.mutex.Lock()
+	self.nextUpload++
+	uploadId := fmt.Sprintf("upload%d", self.nextUpload)
+	self.uploads[uploadId] = &uploadSession{fileId: id, metadata: metadata}
+	self.mutex.Unlock()
+
+	location := url.URL{
+		Scheme:   "http",
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery + "&upload_id=" + uploadId,
+	}
+
+	w.Header().Set("Location", location.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// Appends a chunk to the upload, the file is written to the store when all bytes are received.
+// A chunk without content queries the number of bytes received so far
+func (self *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request, uploadId string) {
+	self.mutex.Lock()
+	session, ok := self.uploads[uploadId]
+	self.mutex.Unlock()
+
+	if !ok {
+		writeError(w, apiError(404, "notFound", "Upload session not found"))
+		return
+	}
+
+	chunk, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, apiError(400, "invalid", fmt.Sprintf("Failed to read chunk: %s", err)))
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if session.file != nil {
+		writeJSON(w, http.StatusOK, session.file)
+		return
+	}
+
+	start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if len(chunk) > 0 {
+		if start > int64(len(session.content)) {
+			writeError(w, apiError(400, "invalid", "Chunk starts after the received bytes"))
+			return
+		}
+
+		// Bytes that are sent again replace the received bytes
+		session.content = append(session.content[:start], chunk...)
+	}
+
+	if total < 0 || int64(len(session.content)) < total {
+		if len(session.content) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(session.content)-1))
+		}
+
+		// Clients can ask for the status to be sent in a header, as 308 is also used for redirects
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(308)
+		return
+	}
+
+	f, err := self.writeFile(r, session.fileId, session.metadata, bytes.NewReader(session.content[:total]))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	session.file = f
+	writeJSON(w, http.StatusOK, f)
+}
+
+// Runs each call of the batch against the server and returns the responses in one multipart response
+func (self *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		writeError(w, apiError(400, "invalid", "Batch request must be multipart/mixed"))
+		return
+	}
+
+	// The whole request is read before the response is written
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, apiError(400, "invalid", fmt.Sprintf("Failed to read batch request: %s", err)))
+			return
+		}
+
+		res := self.runBatchPart(r, part)
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		if id := part.Header.Get("Content-ID"); id != "" {
+			header.Set("Content-ID", "<response-"+strings.Trim(id, "<>")+">")
+		}
+
+		out, err := writer.CreatePart(header)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		res.Write(out)
+	}
+
+	writer.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+func (self *Server) runBatchPart(batch *http.Request, part io.Reader) *http.Response {
+	recorder := httptest.NewRecorder()
+
+	req, err := http.ReadRequest(bufio.NewReader(part))
+	if err != nil {
+		writeError(recorder, apiError(400, "invalid", fmt.Sprintf("Invalid batch part: %s", err)))
+		return recorder.Result()
+	}
+
+	if req.URL.Path == "/batch/drive/v3" || strings.HasPrefix(req.URL.Path, "/upload/") {
+		writeError(recorder, apiError(400, "invalid", "Uploads and batches can't be part of a batch"))
+		return recorder.Result()
+	}
+
+	req.Host = batch.Host
+	self.ServeHTTP(recorder, req.WithContext(batch.Context()))
+	return recorder.Result()
+}
+
+func (self *Server) handleAbout(w http.ResponseWriter, r *http.Request) {
+	about := &drive.About{
+		Kind: "drive#about",
+		User: &drive.User{
+			Kind:         "drive#user",
+			DisplayName:  "Fake User",
+			EmailAddress: "fake@example.com",
+			Me:           true,
+		},
+		StorageQuota: &drive.AboutStorageQuota{},
+	}
+
+	if store, ok := self.store.(interface {
+		StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error)
+	}); ok {
+		quota, err := store.StorageQuota(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		about.StorageQuota = quota
+	}
+
+	writeJSON(w, http.StatusOK, about)
+}
+
+func readMultipartUpload(r *http.Request) (*drive.File, io.Reader, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, nil, apiError(400, "invalid", "Multipart upload must be multipart/related")
+	}
+
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, nil, apiError(400, "invalid", fmt.Sprintf("Missing metadata part: %s", err))
+	}
+
+	metadata, err := decodeFile(part)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	part, err = reader.NextPart()
+	if err != nil {
+		return nil, nil, apiError(400, "invalid", fmt.Sprintf("Missing media part: %s", err))
+	}
+
+	content, err := ioutil.ReadAll(part)
+	if err != nil {
+		return nil, nil, apiError(400, "invalid", fmt.Sprintf("Failed to read media: %s", err))
+	}
+
+	return metadata, bytes.NewReader(content), nil
+}
+
+// Decodes the file metadata of a request. Fields that are sent with a zero value are
+// force sent and null fields are kept as null fields, so that the store sees the
+// same update as the client sent
+func decodeFile(r io.Reader) (*drive.File, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, apiError(400, "invalid", fmt.Sprintf("Failed to read request: %s", err))
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+
+	f := &drive.File{}
+	if err = json.Unmarshal(content, f); err != nil {
+		return nil, apiError(400, "parseError", fmt.Sprintf("Invalid file metadata: %s", err))
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(content, &fields); err != nil {
+		return nil, apiError(400, "parseError", fmt.Sprintf("Invalid file metadata: %s", err))
+	}
+
+	for key, value := range fields {
+		name := goFieldName(key)
+
+		if string(value) == "null" {
+			f.NullFields = append(f.NullFields, name)
+			continue
+		}
+		f.ForceSendFields = append(f.ForceSendFields, name)
+
+		// Null keys of maps like appProperties
+		entries := map[string]*string{}
+		if json.Unmarshal(value, &entries) == nil {
+			for entryKey, entryValue := range entries {
+				if entryValue == nil {
+					f.NullFields = append(f.NullFields, name+"."+entryKey)
+				}
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// The go field of a json field, i.e. appProperties -> AppProperties
+func goFieldName(jsonName string) string {
+	if jsonName == "" {
+		return ""
+	}
+	return strings.ToUpper(jsonName[:1]) + jsonName[1:]
+}
+
+func requestFields(r *http.Request) []googleapi.Field {
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		return []googleapi.Field{googleapi.Field(fields)}
+	}
+	return nil
+}
+
+// Parses a range header like 'bytes=100-' and returns the first byte
+func parseRange(value string) (int64, error) {
+	if !strings.HasPrefix(value, "bytes=") || !strings.HasSuffix(value, "-") {
+		return 0, apiError(400, "invalid", fmt.Sprintf("Unsupported range '%s'", value))
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(value, "bytes="), "-"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, apiError(400, "invalid", fmt.Sprintf("Invalid range '%s'", value))
+	}
+	return offset, nil
+}
+
+// Parses a content range like 'bytes 0-99/1000', 'bytes 0-99/*' or 'bytes */1000'.
+// Returns the first byte of the chunk and the total size, or -1 if the size is unknown
+func parseContentRange(value string) (int64, int64, error) {
+	invalid := apiError(400, "invalid", fmt.Sprintf("Invalid content range '%s'", value))
+
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, invalid
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+
+	total := int64(-1)
+	if parts[1] != "*" {
+		var err error
+		if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, invalid
+		}
+	}
+
+	if parts[0] == "*" {
+		return 0, total, nil
+	}
+
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || len(bounds) != 2 {
+		return 0, 0, invalid
+	}
+
+	return start, total, nil
+}
+
+func writeResult(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+// Writes the error in the format of the drive api, errors that
+// are not api errors are returned as internal server errors
+func writeError(w http.ResponseWriter, err error) {
+	ae, ok := err.(*googleapi.Error)
+	if !ok {
+		ae = apiError(500, "backendError", err.Error())
+	}
+
+	for key, values := range ae.Header {
+		w.Header()[key] = values
+	}
+
+	errors := []map[string]string{}
+	for _, item := range ae.Errors {
+		errors = append(errors, map[string]string{
+			"domain":  "global",
+			"reason":  item.Reason,
+			"message": item.Message,
+		})
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    ae.Code,
+			"message": ae.Message,
+			"errors":  errors,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(ae.Code)
+	w.Write(content)
+}
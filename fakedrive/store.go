@@ -0,0 +1,780 @@
+package fakedrive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grandeto/gdrive/constants"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Id of the root directory of the fake drive
+const RootId = "root"
+
+// Default and max number of files returned in a list page
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Fields that are set by the store and can't be changed by a create or update
+var readOnlyFields = []string{"id", "kind", "md5Checksum", "sha256Checksum", "size", "parents", "driveId", "trashedTime"}
+
+// An in-memory drive that implements gdrive.RemoteStore. All files are owned by one
+// user and live in the users own drive. The store is safe for concurrent use
+type Store struct {
+	mutex    *sync.Mutex
+	files    map[string]*storedFile
+	order    []string
+	nextId   int
+	quota    int64
+	clock    func() time.Time
+	failures map[string][]error
+}
+
+var _ gdrive.RemoteStore = (*Store)(nil)
+
+type storedFile struct {
+	file    *drive.File
+	content []byte
+}
+
+func NewStore() *Store {
+	store := &Store{
+		mutex:    &sync.Mutex{},
+		files:    map[string]*storedFile{},
+		clock:    time.Now,
+		failures: map[string][]error{},
+	}
+
+	now := store.now()
+	store.add(&drive.File{
+		Id:           RootId,
+		Kind:         "drive#file",
+		Name:         "My Drive",
+		MimeType:     constants.DirectoryMimeType,
+		CreatedTime:  now,
+		ModifiedTime: now,
+	}, nil)
+
+	return store
+}
+
+// Sets the storage limit in bytes, 0 means unlimited
+func (self *Store) SetQuota(limit int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.quota = limit
+}
+
+// Sets the function used to get the current time, i.e. to give files fixed timestamps
+func (self *Store) SetClock(clock func() time.Time) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.clock = clock
+}
+
+// Makes the next calls of the given operation fail with the given errors, one error per
+// call. The operation is one of list, get, create, update, delete and download
+func (self *Store) FailNext(operation string, errs ...error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.failures[operation] = append(self.failures[operation], errs...)
+}
+
+// Returns the content of the file
+func (self *Store) Content(id string) ([]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	sf, ok := self.files[id]
+	if !ok {
+		return nil, notFoundError(id)
+	}
+	return append([]byte(nil), sf.content...), nil
+}
+
+// Returns all files, including trashed files, in the order they were created
+func (self *Store) Files() []*drive.File {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var files []*drive.File
+	for _, id := range self.order {
+		files = append(files, self.view(self.files[id]))
+	}
+	return files
+}
+
+func (self *Store) ListFiles(ctx context.Context, args gdrive.ListPageArgs) (*drive.FileList, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("list"); err != nil {
+		return nil, err
+	}
+
+	match, err := parseQuery(args.Query)
+	if err != nil {
+		return nil, invalidError(err.Error())
+	}
+
+	var files []*drive.File
+	for _, id := range self.order {
+		// The root directory is not listed
+		if id == RootId {
+			continue
+		}
+
+		f := self.view(self.files[id])
+		if match(f) && (args.DriveId == "" || f.DriveId == args.DriveId) {
+			files = append(files, f)
+		}
+	}
+
+	if err = sortFiles(files, args.OrderBy); err != nil {
+		return nil, invalidError(err.Error())
+	}
+
+	return listPage(files, args.PageSize, args.PageToken)
+}
+
+func (self *Store) GetFile(ctx context.Context, id string, fields ...googleapi.Field) (*drive.File, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("get"); err != nil {
+		return nil, err
+	}
+
+	sf, ok := self.files[id]
+	if !ok {
+		return nil, notFoundError(id)
+	}
+	return self.view(sf), nil
+}
+
+func (self *Store) CreateFile(ctx context.Context, args gdrive.WriteFileArgs) (*drive.File, error) {
+	content, err := readMedia(args)
+	if err != nil {
+		return nil, err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("create"); err != nil {
+		return nil, err
+	}
+
+	f, err := patchFile(&drive.File{}, args.File)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := []string{RootId}
+	if args.File != nil && len(args.File.Parents) > 0 {
+		parents = args.File.Parents
+	}
+
+	driveId, err := self.checkParents(parents)
+	if err != nil {
+		return nil, err
+	}
+
+	id := ""
+	if args.File != nil {
+		id = args.File.Id
+	}
+	if id == "" {
+		id = self.newId()
+	} else if _, exists := self.files[id]; exists {
+		return nil, apiError(409, "duplicate", fmt.Sprintf("A file already exists with the provided ID: %s", id))
+	}
+
+	now := self.now()
+	f.Id = id
+	f.Kind = "drive#file"
+	f.Parents = parents
+	f.DriveId = driveId
+
+	if f.MimeType == "" {
+		f.MimeType = "application/octet-stream"
+	}
+	if f.CreatedTime == "" {
+		f.CreatedTime = now
+	}
+	if f.ModifiedTime == "" {
+		f.ModifiedTime = now
+	}
+
+	if content != nil && !hasContent(f) {
+		return nil, invalidError("Media can't be uploaded to a directory or document")
+	}
+
+	if err = self.checkQuota(len(content)); err != nil {
+		return nil, err
+	}
+
+	sf := self.add(f, content)
+	return self.view(sf), nil
+}
+
+func (self *Store) UpdateFile(ctx context.Context, id string, args gdrive.WriteFileArgs) (*drive.File, error) {
+	content, err := readMedia(args)
+	if err != nil {
+		return nil, err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("update"); err != nil {
+		return nil, err
+	}
+
+	sf, ok := self.files[id]
+	if !ok {
+		return nil, notFoundError(id)
+	}
+
+	f, err := patchFile(sf.file, args.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.AddParents != "" || args.RemoveParents != "" {
+		if id == RootId {
+			return nil, apiError(403, "cannotModifyRoot", "The root directory can't be moved")
+		}
+		if f.Parents, err = self.moveParents(f.Parents, args.AddParents, args.RemoveParents); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Trashed && !sf.file.Trashed {
+		f.TrashedTime = self.now()
+	} else if !f.Trashed {
+		f.TrashedTime = ""
+	}
+
+	// The modified time is updated unless a new time is given
+	if args.File == nil || args.File.ModifiedTime == "" {
+		f.ModifiedTime = self.now()
+	}
+
+	if content != nil {
+		if !hasContent(f) {
+			return nil, invalidError("Media can't be uploaded to a directory or document")
+		}
+		if err = self.checkQuota(len(content) - len(sf.content)); err != nil {
+			return nil, err
+		}
+		sf.content = content
+	}
+
+	sf.file = f
+	setChecksums(sf)
+	return self.view(sf), nil
+}
+
+// Deletes the file and all files that are only in the deleted directories
+func (self *Store) DeleteFile(ctx context.Context, id string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("delete"); err != nil {
+		return err
+	}
+
+	if _, ok := self.files[id]; !ok {
+		return notFoundError(id)
+	}
+
+	if id == RootId {
+		return apiError(403, "cannotDeleteRoot", "The root directory can't be deleted")
+	}
+
+	self.remove(id)
+	return nil
+}
+
+func (self *Store) DownloadFile(ctx context.Context, id string, offset int64) (*http.Response, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := self.failure("download"); err != nil {
+		return nil, err
+	}
+
+	sf, ok := self.files[id]
+	if !ok {
+		return nil, notFoundError(id)
+	}
+
+	if !hasContent(sf.file) {
+		return nil, apiError(403, "fileNotDownloadable", "Only files with binary content can be downloaded")
+	}
+
+	size := int64(len(sf.content))
+	if offset > size || (offset > 0 && offset == size) {
+		return nil, apiError(416, "requestedRangeNotSatisfiable", "Request range not satisfiable")
+	}
+
+	content := append([]byte(nil), sf.content[offset:]...)
+
+	res := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+	}
+
+	if offset > 0 {
+		res.StatusCode = http.StatusPartialContent
+		res.Status = "206 Partial Content"
+		res.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	}
+
+	res.Header.Set("Content-Type", sf.file.MimeType)
+	res.Header.Set("Content-Length", strconv.Itoa(len(content)))
+	return res, nil
+}
+
+// The usage is the total size of the files
+func (self *Store) StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	usage := self.usage()
+	return &drive.AboutStorageQuota{
+		Limit:        self.quota,
+		Usage:        usage,
+		UsageInDrive: usage,
+	}, nil
+}
+
+func (self *Store) add(f *drive.File, content []byte) *storedFile {
+	sf := &storedFile{file: f, content: content}
+	setChecksums(sf)
+	self.files[f.Id] = sf
+	self.order = append(self.order, f.Id)
+	return sf
+}
+
+func (self *Store) remove(id string) {
+	delete(self.files, id)
+
+	var order []string
+	for _, fileId := range self.order {
+		if fileId != id {
+			order = append(order, fileId)
+		}
+	}
+	self.order = order
+
+	// Remove the directory from its children, children without other parents are deleted
+	for _, childId := range append([]string(nil), self.order...) {
+		child, ok := self.files[childId]
+		if !ok || !containsString(child.file.Parents, id) {
+			continue
+		}
+
+		child.file.Parents = removeString(child.file.Parents, id)
+		if len(child.file.Parents) == 0 {
+			self.remove(childId)
+		}
+	}
+}
+
+// Returns a copy of the file as returned by drive, files
+// inside a trashed directory are trashed as well
+func (self *Store) view(sf *storedFile) *drive.File {
+	f, _ := copyFile(sf.file)
+	f.Trashed = self.isTrashed(sf.file)
+	return f
+}
+
+func (self *Store) isTrashed(f *drive.File) bool {
+	for depth := 0; f != nil && depth < 1000; depth++ {
+		if f.Trashed {
+			return true
+		}
+		if len(f.Parents) == 0 {
+			return false
+		}
+
+		parent, ok := self.files[f.Parents[0]]
+		if !ok {
+			return false
+		}
+		f = parent.file
+	}
+	return false
+}
+
+// Ensures that the parents exist and are directories, returns the shared drive of the parents
+func (self *Store) checkParents(parents []string) (string, error) {
+	driveId := ""
+
+	for _, id := range parents {
+		parent, ok := self.files[id]
+		if !ok {
+			return "", notFoundError(id)
+		}
+
+		if parent.file.MimeType != constants.DirectoryMimeType {
+			return "", invalidError(fmt.Sprintf("The parent '%s' is not a directory", id))
+		}
+
+		driveId = parent.file.DriveId
+	}
+
+	return driveId, nil
+}
+
+func (self *Store) moveParents(parents []string, add, remove string) ([]string, error) {
+	for _, id := range splitIds(remove) {
+		parents = removeString(parents, id)
+	}
+
+	added := splitIds(add)
+	if _, err := self.checkParents(added); err != nil {
+		return nil, err
+	}
+
+	for _, id := range added {
+		if !containsString(parents, id) {
+			parents = append(parents, id)
+		}
+	}
+
+	if len(parents) == 0 {
+		return nil, invalidError("A file must have at least one parent")
+	}
+
+	return parents, nil
+}
+
+func (self *Store) checkQuota(added int) error {
+	if self.quota > 0 && self.usage()+int64(added) > self.quota {
+		return apiError(403, "storageQuotaExceeded", "The user's Drive storage quota has been exceeded")
+	}
+	return nil
+}
+
+func (self *Store) usage() int64 {
+	var usage int64
+	for _, sf := range self.files {
+		usage += int64(len(sf.content))
+	}
+	return usage
+}
+
+func (self *Store) failure(operation string) error {
+	errs := self.failures[operation]
+	if len(errs) == 0 {
+		return nil
+	}
+
+	self.failures[operation] = errs[1:]
+	return errs[0]
+}
+
+func (self *Store) newId() string {
+	for {
+		self.nextId++
+		id := fmt.Sprintf("fake%06d", self.nextId)
+		if _, exists := self.files[id]; !exists {
+			return id
+		}
+	}
+}
+
+func (self *Store) now() string {
+	return self.clock().UTC().Format(time.RFC3339Nano)
+}
+
+// Returns a copy of f with the fields of patch applied the way drive applies an update.
+// Fields set in patch replace the values in f, null fields are removed and maps like
+// appProperties are merged key by key
+func patchFile(f *drive.File, patch *drive.File) (*drive.File, error) {
+	dst, err := fileFields(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch != nil {
+		src, err := fileFields(patch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, field := range readOnlyFields {
+			delete(src, field)
+		}
+
+		mergeFields(dst, src)
+	}
+
+	content, err := json.Marshal(dst)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode file: %s", err)
+	}
+
+	patched := &drive.File{}
+	if err = json.Unmarshal(content, patched); err != nil {
+		return nil, invalidError(fmt.Sprintf("Invalid file metadata: %s", err))
+	}
+
+	// Fields only known by the store are kept as is
+	patched.Id = f.Id
+	patched.Kind = f.Kind
+	patched.Parents = f.Parents
+	patched.DriveId = f.DriveId
+	patched.TrashedTime = f.TrashedTime
+	return patched, nil
+}
+
+func fileFields(f *drive.File) (map[string]interface{}, error) {
+	content, err := json.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode file: %s", err)
+	}
+
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("Failed to decode file: %s", err)
+	}
+	return fields, nil
+}
+
+func mergeFields(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			dstMap, ok := dst[key].(map[string]interface{})
+			if !ok {
+				dstMap = map[string]interface{}{}
+			}
+			mergeFields(dstMap, srcMap)
+			dst[key] = dstMap
+			continue
+		}
+
+		dst[key] = value
+	}
+}
+
+func copyFile(f *drive.File) (*drive.File, error) {
+	content, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &drive.File{}
+	err = json.Unmarshal(content, copied)
+	return copied, err
+}
+
+func setChecksums(sf *storedFile) {
+	if !hasContent(sf.file) {
+		sf.file.Md5Checksum = ""
+		sf.file.Sha256Checksum = ""
+		sf.file.Size = 0
+		return
+	}
+
+	md5sum := md5.Sum(sf.content)
+	sha256sum := sha256.Sum256(sf.content)
+	sf.file.Md5Checksum = hex.EncodeToString(md5sum[:])
+	sf.file.Sha256Checksum = hex.EncodeToString(sha256sum[:])
+	sf.file.Size = int64(len(sf.content))
+}
+
+// Directories and google documents have no binary content
+func hasContent(f *drive.File) bool {
+	return !strings.HasPrefix(f.MimeType, "application/vnd.google-apps.")
+}
+
+// Returns nil if no media is given
+func readMedia(args gdrive.WriteFileArgs) ([]byte, error) {
+	if args.Media == nil {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadAll(args.Media)
+	if err != nil {
+		return nil, err
+	}
+
+	if content == nil {
+		content = []byte{}
+	}
+	return content, nil
+}
+
+// Sorts the files by a comma separated list of keys, each optionally followed by
+// desc. The keys folder, name, name_natural, createdTime and modifiedTime are supported
+func sortFiles(files []*drive.File, orderBy string) error {
+	var less []func(a, b *drive.File) int
+
+	for _, key := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(key)
+		if len(parts) == 0 {
+			continue
+		}
+
+		compare, ok := fileComparers[parts[0]]
+		if !ok || len(parts) > 2 || (len(parts) == 2 && parts[1] != "desc" && parts[1] != "asc") {
+			return fmt.Errorf("Unsupported sort key '%s'", strings.TrimSpace(key))
+		}
+
+		if len(parts) == 2 && parts[1] == "desc" {
+			asc := compare
+			compare = func(a, b *drive.File) int { return -asc(a, b) }
+		}
+		less = append(less, compare)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		for _, compare := range less {
+			if c := compare(files[i], files[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	return nil
+}
+
+var fileComparers = map[string]func(a, b *drive.File) int{
+	"folder": func(a, b *drive.File) int {
+		return compareBool(a.MimeType == constants.DirectoryMimeType, b.MimeType == constants.DirectoryMimeType)
+	},
+	"name": func(a, b *drive.File) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"name_natural": func(a, b *drive.File) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"createdTime": func(a, b *drive.File) int {
+		return strings.Compare(a.CreatedTime, b.CreatedTime)
+	},
+	"modifiedTime": func(a, b *drive.File) int {
+		return strings.Compare(a.ModifiedTime, b.ModifiedTime)
+	},
+}
+
+// True sorts before false
+func compareBool(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if a {
+		return -1
+	}
+	return 1
+}
+
+// The page token is the offset of the first file of the page
+func listPage(files []*drive.File, pageSize int64, pageToken string) (*drive.FileList, error) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	offset := 0
+	if pageToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(pageToken); err != nil || offset < 0 || offset > len(files) {
+			return nil, invalidError("Invalid page token")
+		}
+	}
+
+	end := offset + int(pageSize)
+	if end > len(files) {
+		end = len(files)
+	}
+
+	fl := &drive.FileList{
+		Kind:  "drive#fileList",
+		Files: files[offset:end],
+	}
+
+	if end < len(files) {
+		fl.NextPageToken = strconv.Itoa(end)
+	}
+
+	return fl, nil
+}
+
+func splitIds(ids string) []string {
+	var result []string
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func apiError(code int, reason, message string) *googleapi.Error {
+	return &googleapi.Error{
+		Code:    code,
+		Message: message,
+		Errors: []googleapi.ErrorItem{{
+			Reason:  reason,
+			Message: message,
+		}},
+	}
+}
+
+func notFoundError(id string) *googleapi.Error {
+	return apiError(404, "notFound", fmt.Sprintf("File not found: %s.", id))
+}
+
+func invalidError(message string) *googleapi.Error {
+	return apiError(400, "invalid", message)
+}
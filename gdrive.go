@@ -16,6 +16,8 @@ func main() {
 
 	cli.SetHandlers(handlers)
 
+	cli.SetDefaults(loader.LoadDefaults())
+
 	if ok := cli.Handle(os.Args[1:]); !ok {
 		util.ExitF("No valid arguments given, use '%s help' to see available commands", constants.Name)
 	}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/grandeto/gdrive/auth"
+	"github.com/grandeto/gdrive/cli"
+	"github.com/grandeto/gdrive/util"
+)
+
+func LoginHandler(ctx cli.Context) {
+	args := ctx.Args()
+
+	authFn := auth.LoopbackAuth(os.Stdout, int(args.Int64("port")))
+
+	clientId, clientSecret := oauthCredentials(args)
+	_, err := auth.Login(clientId, clientSecret, tokenPath(args), authFn)
+	util.CheckErr(err)
+
+	fmt.Printf("Logged in, token saved to %s\n", tokenPath(args))
+}
+
+func LogoutHandler(ctx cli.Context) {
+	args := ctx.Args()
+	path := tokenPath(args)
+
+	token, exists, err := auth.ReadToken(path)
+	if err != nil {
+		util.ExitF("Failed to read token: %s", err)
+	}
+
+	if !exists {
+		fmt.Println("Not logged in")
+		return
+	}
+
+	// The local token is removed even if it could not be revoked
+	if err = auth.RevokeToken(token); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to revoke token: %s\n", err)
+	}
+
+	if err = os.Remove(path); err != nil {
+		util.ExitF("Failed to remove token: %s", err)
+	}
+
+	fmt.Println("Logged out")
+}
+
+func AuthStatusHandler(ctx cli.Context) {
+	args := ctx.Args()
+	path := tokenPath(args)
+
+	token, exists, err := auth.ReadToken(path)
+	if err != nil {
+		util.ExitF("Failed to read token: %s", err)
+	}
+
+	if !exists || token.RefreshToken == "" {
+		fmt.Println("Not logged in")
+		return
+	}
+
+	fmt.Println("Logged in")
+	fmt.Printf("Token file: %s\n", path)
+	if token.Expiry.IsZero() {
+		fmt.Println("Access token expires: never")
+	} else {
+		fmt.Printf("Access token expires: %s\n", token.Expiry.Local().Format("2006-01-02 15:04:05"))
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grandeto/gdrive/cli"
+	"github.com/grandeto/gdrive/config"
+	"github.com/grandeto/gdrive/util"
+)
+
+// Options that select the config dir or define profiles can't be given as defaults, neither
+// can the passphrase as it would be stored in plain text. Use a key file instead
+var excludedOptions = []string{"config", "profile", "client-id", "client-secret", "option", "default", "passphrase"}
+
+// Options that can be given with GDRIVE_<OPTION> environment variables. Options that change
+// what a single command does, like dry-run or delete, and tokens are left out so that a
+// forgotten variable can't affect other commands
+var envOptionKeys = []string{
+	"timeout", "no-progress", "no-header", "bytes", "name-width", "path-width", "output",
+	"chunksize", "parallel", "interval", "bwlimit", "retries", "max-backoff", "drive",
+	"key-file", "encrypt-names",
+	"include", "exclude", "filter-from", "mime-type", "min-size", "max-size", "max-age",
+}
+
+func ConfigGetHandler(ctx cli.Context) {
+	args := ctx.Args()
+	key := args.String("key")
+
+	value, ok := loadConfig(args).Get(key)
+	if !ok {
+		util.ExitF("Option '%s' is not set", key)
+	}
+
+	fmt.Println(value)
+}
+
+func ConfigSetHandler(ctx cli.Context) {
+	args := ctx.Args()
+	key := args.String("key")
+	value := args.String("value")
+
+	if value != "" {
+		checkOption(ctx.Handlers(), key, value)
+	}
+
+	cfg := loadConfig(args)
+	cfg.Set(key, value)
+	util.CheckErr(cfg.Save())
+
+	if value == "" {
+		fmt.Printf("Removed %s\n", key)
+	} else {
+		fmt.Printf("Set %s to %s\n", key, value)
+	}
+}
+
+func ConfigListHandler(ctx cli.Context) {
+	args := ctx.Args()
+	cfg := loadConfig(args)
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 0, 3, ' ', 0)
+
+	if !args.Bool("skipHeader") {
+		fmt.Fprintln(w, "Key\tValue")
+	}
+
+	for _, key := range cfg.Keys() {
+		fmt.Fprintf(w, "%s\t%s\n", key, cfg.Options[key])
+	}
+
+	w.Flush()
+}
+
+// Supplies flag defaults from, in increasing order of precedence, the config file,
+// the active profile and the GDRIVE_<OPTION> environment variables of envOptionKeys.
+// Flags given on the command line take precedence over all of them
+func FlagDefaults(args cli.Arguments, handler *cli.Handler) map[string]interface{} {
+	// Commands without global flags don't use defaults
+	if _, ok := args["configDir"]; !ok {
+		return nil
+	}
+
+	command := handler.Command()
+	defaults := map[string]interface{}{}
+
+	options := loadConfig(args).Options
+	if _, p := activeProfile(args); p != nil {
+		options = mergeOptions(options, p.Options)
+	}
+	options = mergeOptions(options, envOptions(handler.Flags()))
+
+	for _, flag := range handler.Flags() {
+		key, ok := optionKey(flag)
+		if !ok {
+			continue
+		}
+
+		// Options given for the command take precedence over options for all commands
+		value, ok := options[optionCommandKey(command, key)]
+		if !ok {
+			value, ok = options[key]
+		}
+		if !ok {
+			continue
+		}
+
+		parsed, err := flagValue(flag, value)
+		if err != nil {
+			util.ExitF("Invalid value '%s' for option '%s': %s", value, key, err)
+		}
+		defaults[flag.GetName()] = parsed
+	}
+
+	return defaults
+}
+
+func loadConfig(args cli.Arguments) *config.Config {
+	cfg, err := config.Load(getConfigDir(args))
+	util.CheckErr(err)
+	return cfg
+}
+
+// Returns the options of the GDRIVE_<OPTION> environment variables, i.e. GDRIVE_NO_PROGRESS
+func envOptions(flags []cli.Flag) map[string]string {
+	options := map[string]string{}
+
+	for _, flag := range flags {
+		key, ok := optionKey(flag)
+		if !ok || !isEnvOption(key) {
+			continue
+		}
+
+		name := "GDRIVE_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+		if value := os.Getenv(name); value != "" {
+			options[key] = value
+		}
+	}
+
+	return options
+}
+
+func isEnvOption(key string) bool {
+	for _, envKey := range envOptionKeys {
+		if key == envKey {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeOptions(a, b map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range a {
+		merged[key] = value
+	}
+	for key, value := range b {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Returns the option key of the flag, which is the long
+// flag name without dashes. Excluded flags have no key
+func optionKey(flag cli.Flag) (string, bool) {
+	for _, pattern := range flag.GetPatterns() {
+		if !strings.HasPrefix(pattern, "--") {
+			continue
+		}
+
+		key := strings.TrimPrefix(pattern, "--")
+		for _, excluded := range excludedOptions {
+			if key == excluded {
+				return "", false
+			}
+		}
+		return key, true
+	}
+
+	return "", false
+}
+
+// Options for a single command are prefixed with the command, i.e. sync.upload.timeout
+func optionCommandKey(command, key string) string {
+	return strings.Replace(command, " ", ".", -1) + "." + key
+}
+
+// Exits if the key is not an option of any command, or if the value is invalid for the option
+func checkOption(handlers []*cli.Handler, key, value string) {
+	found := false
+
+	for _, h := range handlers {
+		for _, flag := range h.Flags() {
+			flagKey, ok := optionKey(flag)
+			if !ok || (key != flagKey && key != optionCommandKey(h.Command(), flagKey)) {
+				continue
+			}
+
+			if _, err := flagValue(flag, value); err != nil {
+				util.ExitF("Invalid value '%s' for option '%s': %s", value, key, err)
+			}
+			found = true
+		}
+	}
+
+	if !found {
+		util.ExitF("Unknown option '%s', options are long flag names without dashes, i.e. timeout, optionally prefixed with a command, i.e. sync.upload.timeout", key)
+	}
+}
+
+func flagValue(flag cli.Flag, value string) (interface{}, error) {
+	switch flag.(type) {
+	case cli.BoolFlag:
+		return strconv.ParseBool(value)
+	case cli.IntFlag:
+		return strconv.ParseInt(value, 10, 64)
+	case cli.StringSliceFlag:
+		return splitList(value), nil
+	}
+	return value, nil
+}
+
+// Splits a list option on commas, a comma that is part of a value is escaped with a
+// backslash. Other backslashes are kept, as patterns use them to escape special characters
+func splitList(value string) []string {
+	var values []string
+	current := &strings.Builder{}
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case value[i] == ',':
+			values = append(values, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+
+	return append(values, current.String())
+}
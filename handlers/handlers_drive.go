@@ -5,21 +5,24 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/grandeto/gdrive/auth"
 	"github.com/grandeto/gdrive/cli"
 	"github.com/grandeto/gdrive/compare"
 	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/crypt"
 	"github.com/grandeto/gdrive/drive"
+	"github.com/grandeto/gdrive/profile"
 	"github.com/grandeto/gdrive/util"
 	_ "github.com/joho/godotenv/autoload"
+	"golang.org/x/net/context"
 )
 
 var ClientId = os.Getenv("CLIENT_ID")
@@ -28,28 +31,55 @@ var OsUser = os.Getenv("OS_USER")
 
 func ListHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).List(drive.ListFilesArgs{
-		Out:         os.Stdout,
-		MaxFiles:    args.Int64("maxFiles"),
-		NameWidth:   args.Int64("nameWidth"),
-		Query:       args.String("query"),
-		SortOrder:   args.String("sortOrder"),
-		SkipHeader:  args.Bool("skipHeader"),
-		SizeInBytes: args.Bool("sizeInBytes"),
-		AbsPath:     args.Bool("absPath"),
+	output := outputFormat(args)
+
+	// Structured output always includes the absolute path of each file
+	absPath := args.Bool("absPath") || output != ""
+
+	files, err := newDrive(args).List(context.Background(), drive.ListFilesArgs{
+		MaxFiles:  args.Int64("maxFiles"),
+		Query:     listQuery(args),
+		SortOrder: args.String("sortOrder"),
+		AbsPath:   absPath,
+	})
+	util.CheckErr(err)
+
+	err = printFileList(printFileListArgs{
+		out:         os.Stdout,
+		files:       files,
+		nameWidth:   int(args.Int64("nameWidth")),
+		skipHeader:  args.Bool("skipHeader"),
+		sizeInBytes: args.Bool("sizeInBytes"),
+		absPath:     absPath,
+		output:      output,
 	})
 	util.CheckErr(err)
 }
 
 func ListChangesHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).ListChanges(drive.ListChangesArgs{
-		Out:        os.Stdout,
+	output := outputFormat(args)
+	client := newDrive(args)
+
+	if args.Bool("now") {
+		pageToken, err := client.GetChangesStartPageToken(context.Background())
+		util.CheckErr(err)
+		util.CheckErr(printPageToken(os.Stdout, pageToken, output))
+		return
+	}
+
+	changeList, err := client.ListChanges(context.Background(), drive.ListChangesArgs{
 		PageToken:  args.String("pageToken"),
 		MaxChanges: args.Int64("maxChanges"),
-		Now:        args.Bool("now"),
-		NameWidth:  args.Int64("nameWidth"),
-		SkipHeader: args.Bool("skipHeader"),
+	})
+	util.CheckErr(err)
+
+	err = printChanges(printChangesArgs{
+		out:        os.Stdout,
+		changeList: changeList,
+		nameWidth:  int(args.Int64("nameWidth")),
+		skipHeader: args.Bool("skipHeader"),
+		output:     output,
 	})
 	util.CheckErr(err)
 }
@@ -57,30 +87,48 @@ func ListChangesHandler(ctx cli.Context) {
 func DownloadHandler(ctx cli.Context) {
 	args := ctx.Args()
 	checkDownloadArgs(args)
-	err := newDrive(args).Download(drive.DownloadArgs{
+	client := newDrive(args)
+	results, err := client.Download(context.Background(), drive.DownloadArgs{
 		Out:       os.Stdout,
-		Id:        args.String("fileId"),
+		Id:        fileIdArg(client, args),
 		Force:     args.Bool("force"),
 		Skip:      args.Bool("skip"),
 		Path:      args.String("path"),
 		Delete:    args.Bool("delete"),
 		Recursive: args.Bool("recursive"),
 		Stdout:    args.Bool("stdout"),
+		Md5File:   args.Bool("md5File"),
 		Progress:  progressWriter(args.Bool("noProgress")),
 		Timeout:   durationInSeconds(args.Int64("timeout")),
 	})
 	util.CheckErr(err)
+
+	// Recursive downloads report each file as it is downloaded
+	if args.Bool("recursive") || args.Bool("stdout") {
+		return
+	}
+
+	for _, r := range results {
+		if !r.Skipped {
+			fmt.Printf("Downloaded %s at %s/s, total %s\n", r.File.Id, util.FormatSize(r.Rate, false), util.FormatSize(r.Bytes, false))
+		}
+	}
+
+	if args.Bool("delete") {
+		fmt.Printf("Removed %s\n", args.String("fileId"))
+	}
 }
 
 func DownloadQueryHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).DownloadQuery(drive.DownloadQueryArgs{
+	_, err := newDrive(args).DownloadQuery(context.Background(), drive.DownloadQueryArgs{
 		Out:       os.Stdout,
 		Query:     args.String("query"),
 		Force:     args.Bool("force"),
 		Skip:      args.Bool("skip"),
 		Recursive: args.Bool("recursive"),
 		Path:      args.String("path"),
+		Md5File:   args.Bool("md5File"),
 		Progress:  progressWriter(args.Bool("noProgress")),
 	})
 	util.CheckErr(err)
@@ -89,25 +137,36 @@ func DownloadQueryHandler(ctx cli.Context) {
 func DownloadSyncHandler(ctx cli.Context) {
 	args := ctx.Args()
 	cachePath := filepath.Join(args.String("configDir"), constants.DefaultCacheFileName)
-	err := newDrive(args).DownloadSync(drive.DownloadSyncArgs{
-		Out:              os.Stdout,
+	client := newDrive(args)
+	report, err := client.DownloadSync(context.Background(), drive.DownloadSyncArgs{
+		OnEvent:          printSyncEvent(os.Stdout),
 		Progress:         progressWriter(args.Bool("noProgress")),
 		Path:             args.String("path"),
-		RootId:           args.String("fileId"),
+		RootId:           fileIdArg(client, args),
 		DryRun:           args.Bool("dryRun"),
 		DeleteExtraneous: args.Bool("deleteExtraneous"),
 		Timeout:          durationInSeconds(args.Int64("timeout")),
+		Parallel:         int(args.Int64("parallel")),
+		StateDir:         syncStateDir(args),
 		Resolution:       conflictResolution(args),
 		Comparer:         compare.NewCachedMd5Comparer(cachePath),
+		Mirror:           args.Bool("mirror"),
 	})
+	if report != nil && len(report.Conflicts) > 0 {
+		fmt.Printf("The following files have changed and the local file are newer than it's remote counterpart or was modified since the last sync:\n\n")
+		printSyncConflicts(os.Stdout, report.Conflicts)
+		fmt.Println()
+	}
 	util.CheckErr(err)
+	fmt.Printf("Sync finished in %s\n", report.Duration)
 }
 
 func DownloadRevisionHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).DownloadRevision(drive.DownloadRevisionArgs{
+	client := newDrive(args)
+	result, err := client.DownloadRevision(context.Background(), drive.DownloadRevisionArgs{
 		Out:        os.Stdout,
-		FileId:     args.String("fileId"),
+		FileId:     fileIdArg(client, args),
 		RevisionId: args.String("revId"),
 		Force:      args.Bool("force"),
 		Stdout:     args.Bool("stdout"),
@@ -116,36 +175,56 @@ func DownloadRevisionHandler(ctx cli.Context) {
 		Timeout:    durationInSeconds(args.Int64("timeout")),
 	})
 	util.CheckErr(err)
+
+	if !args.Bool("stdout") {
+		fmt.Printf("Download complete, rate: %s/s, total size: %s\n", util.FormatSize(result.Rate, false), util.FormatSize(result.Bytes, false))
+	}
 }
 
 func UploadHandler(ctx cli.Context) {
 	args := ctx.Args()
 	checkUploadArgs(args)
-	err := newDrive(args).Upload(drive.UploadArgs{
+	client := newDrive(args)
+	results, err := client.Upload(context.Background(), drive.UploadArgs{
 		Out:         os.Stdout,
 		Progress:    progressWriter(args.Bool("noProgress")),
 		Path:        args.String("path"),
 		Name:        args.String("name"),
 		Description: args.String("description"),
-		Parents:     args.StringSlice("parent"),
+		Parents:     parentArgs(client, args),
 		Mime:        args.String("mime"),
 		Recursive:   args.Bool("recursive"),
 		Share:       args.Bool("share"),
 		Delete:      args.Bool("delete"),
 		ChunkSize:   args.Int64("chunksize"),
 		Timeout:     durationInSeconds(args.Int64("timeout")),
+		StatePath:   uploadStatePath(args),
 	})
 	util.CheckErr(err)
+
+	// Recursive uploads report each file as it is uploaded
+	if args.Bool("recursive") {
+		return
+	}
+
+	for _, r := range results {
+		printUploaded(r, args.Bool("share"))
+	}
+
+	if args.Bool("delete") {
+		fmt.Printf("Removed %s\n", args.String("path"))
+	}
 }
 
 func UploadStdinHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).UploadStream(drive.UploadStreamArgs{
+	client := newDrive(args)
+	result, err := client.UploadStream(context.Background(), drive.UploadStreamArgs{
 		Out:         os.Stdout,
 		In:          os.Stdin,
 		Name:        args.String("name"),
 		Description: args.String("description"),
-		Parents:     args.StringSlice("parent"),
+		Parents:     parentArgs(client, args),
 		Mime:        args.String("mime"),
 		Share:       args.Bool("share"),
 		ChunkSize:   args.Int64("chunksize"),
@@ -153,105 +232,194 @@ func UploadStdinHandler(ctx cli.Context) {
 		Progress:    progressWriter(args.Bool("noProgress")),
 	})
 	util.CheckErr(err)
+	printUploaded(result, args.Bool("share"))
+}
+
+func printUploaded(result *drive.TransferResult, shared bool) {
+	f := result.File
+	fmt.Printf("Uploaded %s at %s/s, total %s\n", f.Id, util.FormatSize(result.Rate, false), util.FormatSize(f.Size, false))
+
+	if shared {
+		fmt.Printf("File is readable by anyone at %s\n", f.WebContentLink)
+	}
 }
 
 func UploadSyncHandler(ctx cli.Context) {
 	args := ctx.Args()
 	cachePath := filepath.Join(args.String("configDir"), constants.DefaultCacheFileName)
-	err := newDrive(args).UploadSync(drive.UploadSyncArgs{
-		Out:              os.Stdout,
+	client := newDrive(args)
+	report, err := client.UploadSync(context.Background(), drive.UploadSyncArgs{
+		OnEvent:          printSyncEvent(os.Stdout),
 		Progress:         progressWriter(args.Bool("noProgress")),
 		Path:             args.String("path"),
-		RootId:           args.String("fileId"),
+		RootId:           fileIdArg(client, args),
 		DryRun:           args.Bool("dryRun"),
 		DeleteExtraneous: args.Bool("deleteExtraneous"),
 		ChunkSize:        args.Int64("chunksize"),
 		Timeout:          durationInSeconds(args.Int64("timeout")),
+		Parallel:         int(args.Int64("parallel")),
+		Trash:            args.Bool("trash"),
+		StateDir:         syncStateDir(args),
 		Resolution:       conflictResolution(args),
 		Comparer:         compare.NewCachedMd5Comparer(cachePath),
+		Mirror:           args.Bool("mirror"),
+	})
+	if report != nil && len(report.Conflicts) > 0 {
+		fmt.Printf("The following files have changed and the remote file are newer than it's local counterpart or was modified since the last sync:\n\n")
+		printSyncConflicts(os.Stdout, report.Conflicts)
+		fmt.Println()
+	}
+	util.CheckErr(err)
+	fmt.Printf("Sync finished in %s\n", report.Duration)
+}
+
+func AdoptSyncHandler(ctx cli.Context) {
+	args := ctx.Args()
+	client := newDrive(args)
+	rootDir, err := client.AdoptSync(context.Background(), drive.AdoptSyncArgs{
+		OnEvent: printSyncEvent(os.Stdout),
+		RootId:  fileIdArg(client, args),
+		DryRun:  args.Bool("dryRun"),
+	})
+	util.CheckErr(err)
+	fmt.Printf("%s is now a sync root\n", rootDir.Name)
+}
+
+func WatchSyncHandler(ctx cli.Context) {
+	args := ctx.Args()
+	cachePath := filepath.Join(args.String("configDir"), constants.DefaultCacheFileName)
+
+	// Stop watching gracefully on interrupt
+	watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := newDrive(args)
+	err := client.WatchSync(watchCtx, drive.WatchSyncArgs{
+		OnEvent:    printSyncEvent(os.Stdout),
+		Progress:   progressWriter(args.Bool("noProgress")),
+		Path:       args.String("path"),
+		RootId:     fileIdArg(client, args),
+		StatePath:  util.ConfigFilePath(getConfigDir(args), constants.WatchStateFileName),
+		StateDir:   syncStateDir(args),
+		Interval:   durationInSeconds(args.Int64("interval")),
+		ChunkSize:  args.Int64("chunksize"),
+		Timeout:    durationInSeconds(args.Int64("timeout")),
+		Parallel:   int(args.Int64("parallel")),
+		Trash:      args.Bool("trash"),
+		Resolution: conflictResolution(args),
+		Comparer:   compare.NewCachedMd5Comparer(cachePath),
 	})
 	util.CheckErr(err)
 }
 
 func UpdateHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Update(drive.UpdateArgs{
+	client := newDrive(args)
+	result, err := client.Update(context.Background(), drive.UpdateArgs{
 		Out:         os.Stdout,
-		Id:          args.String("fileId"),
+		Id:          fileIdArg(client, args),
 		Path:        args.String("path"),
 		Name:        args.String("name"),
 		Description: args.String("description"),
-		Parents:     args.StringSlice("parent"),
+		Parents:     parentArgs(client, args),
 		Mime:        args.String("mime"),
 		Progress:    progressWriter(args.Bool("noProgress")),
 		ChunkSize:   args.Int64("chunksize"),
 		Timeout:     durationInSeconds(args.Int64("timeout")),
+		StatePath:   uploadStatePath(args),
 	})
 	util.CheckErr(err)
+
+	f := result.File
+	fmt.Printf("Updated %s at %s/s, total %s\n", f.Id, util.FormatSize(result.Rate, false), util.FormatSize(f.Size, false))
 }
 
 func InfoHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Info(drive.FileInfoArgs{
-		Out:         os.Stdout,
-		Id:          args.String("fileId"),
-		SizeInBytes: args.Bool("sizeInBytes"),
+	client := newDrive(args)
+	f, err := client.Info(context.Background(), drive.FileInfoArgs{
+		Id: fileIdArg(client, args),
+	})
+	util.CheckErr(err)
+
+	err = printFileInfo(printFileInfoArgs{
+		out:         os.Stdout,
+		file:        f,
+		sizeInBytes: args.Bool("sizeInBytes"),
+		output:      outputFormat(args),
 	})
 	util.CheckErr(err)
 }
 
 func ImportHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Import(drive.ImportArgs{
+	client := newDrive(args)
+	result, err := client.Import(context.Background(), drive.ImportArgs{
 		Mime:     args.String("mime"),
-		Out:      os.Stdout,
 		Path:     args.String("path"),
-		Parents:  args.StringSlice("parent"),
+		Parents:  parentArgs(client, args),
 		Progress: progressWriter(args.Bool("noProgress")),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Imported %s with mime type: '%s'\n", result.File.Id, result.File.MimeType)
 }
 
 func ExportHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Export(drive.ExportArgs{
-		Out:        os.Stdout,
-		Id:         args.String("fileId"),
-		Mime:       args.String("mime"),
-		PrintMimes: args.Bool("printMimes"),
-		Force:      args.Bool("force"),
+	client := newDrive(args)
+
+	if args.Bool("printMimes") {
+		mimes, err := client.ExportFormats(context.Background(), fileIdArg(client, args))
+		util.CheckErr(err)
+		fmt.Printf("Available mime types: %s\n", formatList(mimes))
+		return
+	}
+
+	result, err := client.Export(context.Background(), drive.ExportArgs{
+		Id:    fileIdArg(client, args),
+		Mime:  args.String("mime"),
+		Force: args.Bool("force"),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Exported '%s' with mime type: '%s'\n", result.Path, result.Mime)
 }
 
 func ListRevisionsHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).ListRevisions(drive.ListRevisionsArgs{
-		Out:         os.Stdout,
-		Id:          args.String("fileId"),
-		NameWidth:   args.Int64("nameWidth"),
-		SizeInBytes: args.Bool("sizeInBytes"),
-		SkipHeader:  args.Bool("skipHeader"),
+	client := newDrive(args)
+	revisions, err := client.ListRevisions(context.Background(), drive.ListRevisionsArgs{
+		Id: fileIdArg(client, args),
+	})
+	util.CheckErr(err)
+
+	err = printRevisionList(printRevisionListArgs{
+		out:         os.Stdout,
+		revisions:   revisions,
+		nameWidth:   int(args.Int64("nameWidth")),
+		sizeInBytes: args.Bool("sizeInBytes"),
+		skipHeader:  args.Bool("skipHeader"),
+		output:      outputFormat(args),
 	})
 	util.CheckErr(err)
 }
 
 func MkdirHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Mkdir(drive.MkdirArgs{
-		Out:         os.Stdout,
+	client := newDrive(args)
+	f, err := client.Mkdir(context.Background(), drive.MkdirArgs{
 		Name:        args.String("name"),
 		Description: args.String("description"),
-		Parents:     args.StringSlice("parent"),
+		Parents:     parentArgs(client, args),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Directory %s created\n", f.Id)
 }
 
 func ShareHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Share(drive.ShareArgs{
-		Out:          os.Stdout,
-		FileId:       args.String("fileId"),
+	client := newDrive(args)
+	_, err := client.Share(context.Background(), drive.ShareArgs{
+		FileId:       fileIdArg(client, args),
 		Role:         args.String("role"),
 		Type:         args.String("type"),
 		Email:        args.String("email"),
@@ -259,92 +427,254 @@ func ShareHandler(ctx cli.Context) {
 		Discoverable: args.Bool("discoverable"),
 	})
 	util.CheckErr(err)
+
+	fmt.Printf("Granted %s permission to %s\n", args.String("role"), args.String("type"))
 }
 
 func ShareListHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).ListPermissions(drive.ListPermissionsArgs{
-		Out:    os.Stdout,
-		FileId: args.String("fileId"),
+	client := newDrive(args)
+	permissions, err := client.ListPermissions(context.Background(), drive.ListPermissionsArgs{
+		FileId: fileIdArg(client, args),
 	})
 	util.CheckErr(err)
+	printPermissions(os.Stdout, permissions)
 }
 
 func ShareRevokeHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).RevokePermission(drive.RevokePermissionArgs{
-		Out:          os.Stdout,
-		FileId:       args.String("fileId"),
+	client := newDrive(args)
+	err := client.RevokePermission(context.Background(), drive.RevokePermissionArgs{
+		FileId:       fileIdArg(client, args),
 		PermissionId: args.String("permissionId"),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Permission revoked\n")
 }
 
 func DeleteHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).Delete(drive.DeleteArgs{
-		Out:       os.Stdout,
-		Id:        args.String("fileId"),
+	client := newDrive(args)
+	f, err := client.Delete(context.Background(), drive.DeleteArgs{
+		Id:        fileIdArg(client, args),
 		Recursive: args.Bool("recursive"),
+		Permanent: args.Bool("permanent"),
 	})
 	util.CheckErr(err)
+
+	if args.Bool("permanent") {
+		fmt.Printf("Deleted '%s'\n", f.Name)
+	} else {
+		fmt.Printf("Moved '%s' to trash\n", f.Name)
+	}
 }
 
-func ListSyncHandler(ctx cli.Context) {
+func ListTrashHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).ListSync(drive.ListSyncArgs{
-		Out:        os.Stdout,
-		SkipHeader: args.Bool("skipHeader"),
+	output := outputFormat(args)
+	query := constants.TrashQuery
+	if args.String("driveId") != "" {
+		query = constants.SharedDriveTrashQuery
+	}
+
+	files, err := newDrive(args).List(context.Background(), drive.ListFilesArgs{
+		MaxFiles:  args.Int64("maxFiles"),
+		Query:     query,
+		SortOrder: args.String("sortOrder"),
+		AbsPath:   output != "",
+	})
+	util.CheckErr(err)
+
+	err = printFileList(printFileListArgs{
+		out:         os.Stdout,
+		files:       files,
+		nameWidth:   int(args.Int64("nameWidth")),
+		skipHeader:  args.Bool("skipHeader"),
+		sizeInBytes: args.Bool("sizeInBytes"),
+		output:      output,
+	})
+	util.CheckErr(err)
+}
+
+func RestoreTrashHandler(ctx cli.Context) {
+	args := ctx.Args()
+	client := newDrive(args)
+	f, err := client.RestoreTrash(context.Background(), drive.RestoreTrashArgs{
+		Id: fileIdArg(client, args),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Restored '%s'\n", f.Name)
+}
+
+func EmptyTrashHandler(ctx cli.Context) {
+	args := ctx.Args()
+	if !args.Bool("yes") && !confirm("Permanently delete all files in trash?") {
+		fmt.Println("Aborted")
+		return
+	}
+
+	count, err := newDrive(args).EmptyTrash(context.Background())
+	util.CheckErr(err)
+
+	// The number of deleted files is only known for shared drives
+	if args.String("driveId") == "" {
+		fmt.Println("Emptied trash")
+	} else {
+		fmt.Printf("Emptied trash, deleted %d files\n", count)
+	}
+}
+
+func CopyHandler(ctx cli.Context) {
+	args := ctx.Args()
+	checkParentArg(args)
+	client := newDrive(args)
+	result, err := client.Copy(context.Background(), drive.CopyArgs{
+		Id:        fileIdArg(client, args),
+		Parent:    parentArg(client, args),
+		Name:      args.String("name"),
+		Recursive: args.Bool("recursive"),
+	})
+	util.CheckErr(err)
+	fmt.Printf("Copied '%s' to '%s', new id: %s\n", result.Source.Name, result.Parent.Name, result.File.Id)
+}
+
+func MoveHandler(ctx cli.Context) {
+	args := ctx.Args()
+	checkParentArg(args)
+	client := newDrive(args)
+	result, err := client.Move(context.Background(), drive.MoveArgs{
+		Id:     fileIdArg(client, args),
+		Parent: parentArg(client, args),
+	})
+	util.CheckErr(err)
+	fmt.Printf("Moved '%s' to '%s'\n", result.File.Name, result.Parent.Name)
+}
+
+func RenameHandler(ctx cli.Context) {
+	args := ctx.Args()
+	client := newDrive(args)
+	result, err := client.Rename(context.Background(), drive.RenameArgs{
+		Id:   fileIdArg(client, args),
+		Name: args.String("name"),
+	})
+	util.CheckErr(err)
+	fmt.Printf("Renamed '%s' to '%s'\n", result.OldName, result.File.Name)
+}
+
+func SetMetaHandler(ctx cli.Context) {
+	args := ctx.Args()
+	client := newDrive(args)
+	f, err := client.SetMeta(context.Background(), drive.SetMetaArgs{
+		Id:               fileIdArg(client, args),
+		Description:      args.String("description"),
+		ClearDescription: args.Bool("clearDescription"),
+		Starred:          optionalBool(args, "starred"),
+		ReadOnly:         optionalBool(args, "readOnly"),
+		ReadOnlyReason:   args.String("readOnlyReason"),
+		AppProperties:    keyValues(args, "appProperty"),
+		Properties:       keyValues(args, "property"),
+		Modified:         modifiedTime(args),
+	})
+	util.CheckErr(err)
+	fmt.Printf("Updated metadata of '%s'\n", f.Name)
+}
+
+func ListSyncHandler(ctx cli.Context) {
+	args := ctx.Args()
+	files, err := newDrive(args).ListSync(context.Background())
+	util.CheckErr(err)
+	printSyncDirectories(os.Stdout, files, args.Bool("skipHeader"))
 }
 
 func ListRecursiveSyncHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).ListRecursiveSync(drive.ListRecursiveSyncArgs{
-		Out:         os.Stdout,
-		RootId:      args.String("fileId"),
-		SkipHeader:  args.Bool("skipHeader"),
-		PathWidth:   args.Int64("pathWidth"),
-		SizeInBytes: args.Bool("sizeInBytes"),
-		SortOrder:   args.String("sortOrder"),
+	output := outputFormat(args)
+	client := newDrive(args)
+	files, err := client.ListRecursiveSync(context.Background(), drive.ListRecursiveSyncArgs{
+		RootId:    fileIdArg(client, args),
+		SortOrder: args.String("sortOrder"),
+		AbsPath:   output != "",
+	})
+	util.CheckErr(err)
+
+	err = printSyncDirContent(printSyncDirContentArgs{
+		out:         os.Stdout,
+		files:       files,
+		skipHeader:  args.Bool("skipHeader"),
+		pathWidth:   int(args.Int64("pathWidth")),
+		sizeInBytes: args.Bool("sizeInBytes"),
+		output:      output,
 	})
 	util.CheckErr(err)
 }
 
+func CheckHandler(ctx cli.Context) {
+	args := ctx.Args()
+	client := newDrive(args)
+	diffs, err := client.Check(context.Background(), drive.CheckArgs{
+		Path:   args.String("path"),
+		RootId: fileIdArg(client, args),
+	})
+	util.CheckErr(err)
+
+	err = printCheckDiffs(printCheckDiffsArgs{
+		out:         os.Stdout,
+		diffs:       diffs,
+		skipHeader:  args.Bool("skipHeader"),
+		sizeInBytes: args.Bool("sizeInBytes"),
+		output:      outputFormat(args),
+	})
+	util.CheckErr(err)
+
+	if len(diffs) > 0 {
+		util.ExitF("Found %d differences between '%s' and %s", len(diffs), args.String("path"), args.String("fileId"))
+	}
+}
+
 func DeleteRevisionHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).DeleteRevision(drive.DeleteRevisionArgs{
-		Out:        os.Stdout,
-		FileId:     args.String("fileId"),
+	client := newDrive(args)
+	err := client.DeleteRevision(context.Background(), drive.DeleteRevisionArgs{
+		FileId:     fileIdArg(client, args),
 		RevisionId: args.String("revId"),
 	})
 	util.CheckErr(err)
+	fmt.Printf("Deleted revision '%s'\n", args.String("revId"))
 }
 
-func AboutHandler(ctx cli.Context) {
+func ListDrivesHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).About(drive.AboutArgs{
-		Out:         os.Stdout,
-		SizeInBytes: args.Bool("sizeInBytes"),
+	drives, err := newDrive(args).ListDrives(context.Background())
+	util.CheckErr(err)
+
+	err = printDriveList(printDriveListArgs{
+		out:        os.Stdout,
+		drives:     drives,
+		skipHeader: args.Bool("skipHeader"),
+		output:     outputFormat(args),
 	})
 	util.CheckErr(err)
 }
 
+func AboutHandler(ctx cli.Context) {
+	args := ctx.Args()
+	about, err := newDrive(args).About(context.Background())
+	util.CheckErr(err)
+	printAbout(os.Stdout, about, args.Bool("sizeInBytes"))
+}
+
 func AboutImportHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).AboutImport(drive.AboutImportArgs{
-		Out: os.Stdout,
-	})
+	formats, err := newDrive(args).AboutImport(context.Background())
 	util.CheckErr(err)
+	printAboutFormats(os.Stdout, formats)
 }
 
 func AboutExportHandler(ctx cli.Context) {
 	args := ctx.Args()
-	err := newDrive(args).AboutExport(drive.AboutExportArgs{
-		Out: os.Stdout,
-	})
+	formats, err := newDrive(args).AboutExport(context.Background())
 	util.CheckErr(err)
+	printAboutFormats(os.Stdout, formats)
 }
 
 func getOauthClient(args cli.Arguments) (*http.Client, error) {
@@ -352,18 +682,25 @@ func getOauthClient(args cli.Arguments) (*http.Client, error) {
 		util.ExitF("Access token not needed when refresh token is provided")
 	}
 
+	clientId, clientSecret := oauthCredentials(args)
+
 	if args.String("refreshToken") != "" {
-		return auth.NewRefreshTokenClient(ClientId, ClientSecret, args.String("refreshToken")), nil
+		return auth.NewRefreshTokenClient(clientId, clientSecret, args.String("refreshToken")), nil
 	}
 
 	if args.String("accessToken") != "" {
-		return auth.NewAccessTokenClient(ClientId, ClientSecret, args.String("accessToken")), nil
+		return auth.NewAccessTokenClient(clientId, clientSecret, args.String("accessToken")), nil
 	}
 
 	configDir := getConfigDir(args)
 
-	if args.String("serviceAccount") != "" {
-		serviceAccountPath := util.ConfigFilePath(configDir, args.String("serviceAccount"))
+	serviceAccount := args.String("serviceAccount")
+	if _, p := activeProfile(args); serviceAccount == "" && p != nil {
+		serviceAccount = p.ServiceAccount
+	}
+
+	if serviceAccount != "" {
+		serviceAccountPath := util.ConfigFilePath(configDir, serviceAccount)
 		serviceAccountClient, err := auth.NewServiceAccountClient(serviceAccountPath)
 		if err != nil {
 			return nil, err
@@ -371,8 +708,7 @@ func getOauthClient(args cli.Arguments) (*http.Client, error) {
 		return serviceAccountClient, nil
 	}
 
-	tokenPath := util.ConfigFilePath(configDir, constants.TokenFilename)
-	return auth.NewFileSourceClient(ClientId, ClientSecret, tokenPath, authCodePrompt)
+	return auth.NewFileSourceClient(clientId, clientSecret, tokenPath(args), auth.LoopbackAuth(os.Stderr, 0))
 }
 
 func getConfigDir(args cli.Arguments) string {
@@ -383,6 +719,28 @@ func getConfigDir(args cli.Arguments) string {
 	return args.String("configDir")
 }
 
+// Files that belong to an account, like the token, are kept in the directory of
+// the active profile. The config dir is used when no profile is active
+func accountDir(args cli.Arguments) string {
+	if name, p := activeProfile(args); p != nil {
+		return profile.Dir(getConfigDir(args), name)
+	}
+	return getConfigDir(args)
+}
+
+func tokenPath(args cli.Arguments) string {
+	return util.ConfigFilePath(accountDir(args), constants.TokenFilename)
+}
+
+// Upload sessions belong to the account that created them
+func uploadStatePath(args cli.Arguments) string {
+	return util.ConfigFilePath(accountDir(args), constants.UploadStateFileName)
+}
+
+func syncStateDir(args cli.Arguments) string {
+	return util.ConfigFilePath(getConfigDir(args), constants.SyncStateDirName)
+}
+
 func newDrive(args cli.Arguments) *drive.Drive {
 	oauth, err := getOauthClient(args)
 	if err != nil {
@@ -394,80 +752,124 @@ func newDrive(args cli.Arguments) *drive.Drive {
 		util.ExitF("Failed getting drive: %s", err.Error())
 	}
 
-	return client
-}
+	client.SetDriveId(args.String("driveId"))
 
-func authCodePrompt(url string) func() string {
-	return func() string {
-		authFile := util.GetAuthFileNamePath()
+	client.SetRetryPolicy(drive.RetryPolicy{
+		Retries:    int(args.Int64("retries")),
+		MaxBackoff: durationInSeconds(args.Int64("maxBackoff")),
+	})
 
-		f, err := os.Create(authFile)
+	setCipher(client, args)
 
+	if value, ok := args["bwLimit"].(string); ok && value != "" {
+		limit, err := drive.ParseBwLimit(value)
 		if err != nil {
-			util.ExitF(err.Error())
+			util.ExitF("Failed to parse bandwidth limit: %s", err)
 		}
+		client.SetBwLimit(limit)
+	}
 
-		defer f.Close()
+	setFilter(client, args)
 
-		s1 := "Authentication needed"
-		s2 := "Go to the following url in your browser:"
-		s3 := url
-		s4 := "Enter verification code here, right after the collon:"
+	return client
+}
 
-		authMsg := fmt.Sprintf("%s\n%s\n%s\n\n%s", s1, s2, s3, s4)
+// Recursive transfers and sync are limited to the files included by the filter flags,
+// the flags are only available for commands that transfer directories
+func setFilter(client *drive.Drive, args cli.Arguments) {
+	include, _ := args["include"].([]string)
+	exclude, _ := args["exclude"].([]string)
+	mimeTypes, _ := args["mimeType"].([]string)
+	filterFrom, _ := args["filterFrom"].(string)
+	minSize, _ := args["minSize"].(string)
+	maxSize, _ := args["maxSize"].(string)
+	maxAge, _ := args["maxAge"].(string)
 
-		f.WriteString(authMsg)
+	if len(include) == 0 && len(exclude) == 0 && len(mimeTypes) == 0 && filterFrom == "" && minSize == "" && maxSize == "" && maxAge == "" {
+		return
+	}
 
-		log.Printf("Check %s for authentication instructions\n\n", authFile)
+	filter, err := drive.NewFilter(drive.FilterArgs{
+		Include:    include,
+		Exclude:    exclude,
+		FilterFrom: filterFrom,
+		MinSize:    minSize,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MimeTypes:  mimeTypes,
+	})
+	if err != nil {
+		util.ExitF("Failed to parse filter: %s", err)
+	}
 
-		// creates a new file watcher
-		watcher, err := fsnotify.NewWatcher()
+	client.SetFilter(filter)
+}
 
-		if err != nil {
-			util.ExitF(err.Error())
-		}
+// Uploads are encrypted and downloads decrypted when a key file or passphrase is given,
+// the flags are only available for commands that upload or download file content
+func setCipher(client *drive.Drive, args cli.Arguments) {
+	keyFile, _ := args["keyFile"].(string)
+	passphrase, _ := args["passphrase"].(string)
+	encryptNames, _ := args["encryptNames"].(bool)
 
-		defer watcher.Close()
-
-		done := make(chan string, 1)
-
-		go func() {
-			for {
-				select {
-				case event := <-watcher.Events:
-					if event.Name == authFile && event.Op.String() == "WRITE" {
-						ff, _ := os.Open(authFile)
-						fileScanner := bufio.NewScanner(ff)
-
-						fileScanner.Split(bufio.ScanLines)
-
-						for fileScanner.Scan() {
-							if strings.Contains(fileScanner.Text(), s4) {
-								code := strings.Split(fileScanner.Text(), s4)[1]
-								done <- code
-							}
-						}
-					}
-				case err, ok := <-watcher.Errors:
-					if !ok {
-						return
-					}
-
-					log.Println("ERROR", err)
-				}
-			}
-		}()
-
-		if err := watcher.Add(authFile); err != nil {
-			util.ExitF(err.Error())
+	if keyFile != "" && passphrase != "" {
+		util.ExitF("Only one of --key-file and --passphrase can be given")
+	}
+
+	var cipher *crypt.Cipher
+	var err error
+
+	if keyFile != "" {
+		cipher, err = crypt.NewKeyFileCipher(keyFile)
+	} else if passphrase != "" {
+		cipher, err = passphraseCipher(args, passphrase)
+	} else {
+		if encryptNames {
+			util.ExitF("--encrypt-names requires --key-file or --passphrase")
 		}
+		return
+	}
+
+	if err != nil {
+		util.ExitF("Failed to load encryption key: %s", err)
+	}
 
-		code := <-done
+	client.SetCipher(cipher, encryptNames)
+}
 
-		close(done)
+// The salt of the passphrase is kept in the config dir so that names are encrypted the same way every time
+func passphraseCipher(args cli.Arguments, passphrase string) (*crypt.Cipher, error) {
+	salt, err := crypt.LoadSalt(util.ConfigFilePath(getConfigDir(args), constants.SaltFileName))
+	if err != nil {
+		return nil, err
+	}
+	return crypt.NewPassphraseCipher(passphrase, salt)
+}
 
-		return code
+// Returns the file id argument, a drive path is resolved to the id of the file
+func fileIdArg(client *drive.Drive, args cli.Arguments) string {
+	return resolveId(client, args.String("fileId"))
+}
+
+// Returns the parent id argument, a drive path is resolved to the id of the directory
+func parentArg(client *drive.Drive, args cli.Arguments) string {
+	return resolveId(client, args.String("parent"))
+}
+
+func parentArgs(client *drive.Drive, args cli.Arguments) []string {
+	var ids []string
+	for _, parent := range args.StringSlice("parent") {
+		ids = append(ids, resolveId(client, parent))
+	}
+	return ids
+}
+
+func resolveId(client *drive.Drive, idOrPath string) string {
+	id, err := client.ResolveId(context.Background(), idOrPath)
+	if err != nil {
+		util.ExitF("Failed to resolve '%s': %s", idOrPath, err)
 	}
+	return id
 }
 
 func progressWriter(discard bool) io.Writer {
@@ -477,6 +879,14 @@ func progressWriter(discard bool) io.Writer {
 	return os.Stderr
 }
 
+// Asks the user to confirm on stdin, anything but yes is taken as no
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 func durationInSeconds(seconds int64) time.Duration {
 	return time.Second * time.Duration(seconds)
 }
@@ -505,6 +915,73 @@ func conflictResolution(args cli.Arguments) constants.ConflictResolution {
 	return constants.NoResolution
 }
 
+// Files in a shared drive are owned by the drive and not the user,
+// so the owner condition is dropped from the default query
+func listQuery(args cli.Arguments) string {
+	query := args.String("query")
+	if args.String("driveId") != "" && query == constants.DefaultQuery {
+		return constants.DefaultSharedDriveQuery
+	}
+	return query
+}
+
+func outputFormat(args cli.Arguments) string {
+	output := args.String("output")
+
+	switch output {
+	case "", constants.OutputJson, constants.OutputJsonl, constants.OutputCsv:
+		return output
+	}
+
+	util.ExitF("Invalid output format '%s', must be one of %s, %s or %s", output, constants.OutputJson, constants.OutputJsonl, constants.OutputCsv)
+	return ""
+}
+
+// Returns nil if the flag is not given, so that unset flags leave the value unchanged
+func optionalBool(args cli.Arguments, name string) *bool {
+	switch args.String(name) {
+	case "":
+		return nil
+	case "true":
+		value := true
+		return &value
+	case "false":
+		value := false
+		return &value
+	}
+
+	util.ExitF("Invalid value '%s' for %s, must be true or false", args.String(name), name)
+	return nil
+}
+
+// Parses key=value pairs, an empty value means that the key should be removed
+func keyValues(args cli.Arguments, name string) map[string]string {
+	values := map[string]string{}
+
+	for _, kv := range args.StringSlice(name) {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			util.ExitF("Invalid %s '%s', must be on the form key=value", name, kv)
+		}
+		values[parts[0]] = parts[1]
+	}
+
+	return values
+}
+
+func modifiedTime(args cli.Arguments) time.Time {
+	value := args.String("modified")
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		util.ExitF("Invalid modified time '%s', must be a RFC 3339 timestamp, i.e. 2006-01-02T15:04:05Z", value)
+	}
+	return t
+}
+
 func checkUploadArgs(args cli.Arguments) {
 	if args.Bool("recursive") && args.Bool("delete") {
 		util.ExitF("--delete is not allowed for recursive uploads")
@@ -515,6 +992,12 @@ func checkUploadArgs(args cli.Arguments) {
 	}
 }
 
+func checkParentArg(args cli.Arguments) {
+	if args.String("parent") == "" {
+		util.ExitF("--parent is required")
+	}
+}
+
 func checkDownloadArgs(args cli.Arguments) {
 	if args.Bool("recursive") && args.Bool("delete") {
 		util.ExitF("--delete is not allowed for recursive downloads")
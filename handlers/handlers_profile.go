@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grandeto/gdrive/cli"
+	"github.com/grandeto/gdrive/profile"
+	"github.com/grandeto/gdrive/util"
+)
+
+func ProfileAddHandler(ctx cli.Context) {
+	args := ctx.Args()
+	name := args.String("name")
+
+	options := keyValues(args, "option")
+	for key, value := range options {
+		checkOption(ctx.Handlers(), key, value)
+	}
+
+	profiles := loadProfiles(args)
+	err := profiles.Add(name, &profile.Profile{
+		ClientId:       args.String("clientId"),
+		ClientSecret:   args.String("clientSecret"),
+		ServiceAccount: args.String("serviceAccount"),
+		Options:        options,
+	})
+	util.CheckErr(err)
+
+	if args.Bool("default") || len(profiles.Profiles) == 1 {
+		util.CheckErr(profiles.SetDefault(name))
+	}
+
+	util.CheckErr(profiles.Save())
+	fmt.Printf("Added profile '%s'\n", name)
+}
+
+func ProfileListHandler(ctx cli.Context) {
+	args := ctx.Args()
+	profiles := loadProfiles(args)
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 0, 3, ' ', 0)
+
+	if !args.Bool("skipHeader") {
+		fmt.Fprintln(w, "Name\tDefault\tAuth\tOptions")
+	}
+
+	for _, name := range profiles.Names() {
+		p := profiles.Profiles[name]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, formatDefault(profiles.Default == name), profileAuth(p), formatOptions(p.Options))
+	}
+
+	w.Flush()
+}
+
+func ProfileRemoveHandler(ctx cli.Context) {
+	args := ctx.Args()
+	name := args.String("name")
+
+	profiles := loadProfiles(args)
+	util.CheckErr(profiles.Remove(name))
+	util.CheckErr(profiles.Save())
+
+	// Remove the token of the profile
+	if err := os.RemoveAll(profile.Dir(getConfigDir(args), name)); err != nil {
+		util.ExitF("Failed to remove profile directory: %s", err)
+	}
+
+	fmt.Printf("Removed profile '%s'\n", name)
+}
+
+func ProfileDefaultHandler(ctx cli.Context) {
+	args := ctx.Args()
+	name := args.String("name")
+
+	profiles := loadProfiles(args)
+	util.CheckErr(profiles.SetDefault(name))
+	util.CheckErr(profiles.Save())
+
+	fmt.Printf("Default profile is now '%s'\n", name)
+}
+
+// Returns the name and profile given by --profile, the GDRIVE_PROFILE
+// environment variable or the default profile, in that order.
+// Nil is returned if no profile is used
+func activeProfile(args cli.Arguments) (string, *profile.Profile) {
+	name, _ := args["profile"].(string)
+	if name == "" {
+		name = os.Getenv("GDRIVE_PROFILE")
+	}
+
+	profiles := loadProfiles(args)
+	if name == "" {
+		name = profiles.Default
+	}
+
+	if name == "" {
+		return "", nil
+	}
+
+	p, err := profiles.Get(name)
+	util.CheckErr(err)
+	return name, p
+}
+
+func loadProfiles(args cli.Arguments) *profile.Profiles {
+	profiles, err := profile.Load(getConfigDir(args))
+	util.CheckErr(err)
+	return profiles
+}
+
+// Returns the oauth client id and secret of the active profile,
+// or the credentials from the environment if the profile has none
+func oauthCredentials(args cli.Arguments) (string, string) {
+	_, p := activeProfile(args)
+	if p != nil && p.ClientId != "" {
+		return p.ClientId, p.ClientSecret
+	}
+	return ClientId, ClientSecret
+}
+
+func profileAuth(p *profile.Profile) string {
+	if p.ServiceAccount != "" {
+		return "service account"
+	}
+	return "oauth"
+}
+
+func formatDefault(isDefault bool) string {
+	if isDefault {
+		return "*"
+	}
+	return ""
+}
+
+func formatOptions(options map[string]string) string {
+	var values []string
+	for key, value := range options {
+		values = append(values, key+"="+value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
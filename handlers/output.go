@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grandeto/gdrive/constants"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"google.golang.org/api/drive/v3"
+)
+
+// Structured representation of an item printed by one of the printers
+// when a machine readable output format is requested
+type record interface {
+	csvRecord() []string
+}
+
+// Writes records in the given output format, the header is used as the first line of csv output
+func printRecords(out io.Writer, format string, header []string, records []record) error {
+	switch format {
+	case constants.OutputJson:
+		// Ensure that an empty list is encoded as [] and not null
+		if records == nil {
+			records = []record{}
+		}
+		return printJson(out, records)
+
+	case constants.OutputJsonl:
+		enc := json.NewEncoder(out)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case constants.OutputCsv:
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, r := range records {
+			w.Write(r.csvRecord())
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	return fmt.Errorf("Unsupported output format '%s'", format)
+}
+
+func printJson(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type fileRecord struct {
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Path        string   `json:"path,omitempty"`
+	Type        string   `json:"type"`
+	MimeType    string   `json:"mimeType"`
+	Size        int64    `json:"size"`
+	Md5         string   `json:"md5,omitempty"`
+	Created     string   `json:"created,omitempty"`
+	Modified    string   `json:"modified,omitempty"`
+	Parents     []string `json:"parents"`
+	Description string   `json:"description,omitempty"`
+	Shared      bool     `json:"shared"`
+	ViewUrl     string   `json:"viewUrl,omitempty"`
+	DownloadUrl string   `json:"downloadUrl,omitempty"`
+}
+
+var fileRecordHeader = []string{"id", "name", "path", "type", "mimeType", "size", "md5", "created", "modified", "parents", "description", "shared", "viewUrl", "downloadUrl"}
+
+func newFileRecord(f *drive.File, path string) *fileRecord {
+	parents := f.Parents
+	if parents == nil {
+		parents = []string{}
+	}
+
+	return &fileRecord{
+		Id:          f.Id,
+		Name:        f.Name,
+		Path:        path,
+		Type:        gdrive.FileType(f),
+		MimeType:    f.MimeType,
+		Size:        f.Size,
+		Md5:         f.Md5Checksum,
+		Created:     formatRFC3339(f.CreatedTime),
+		Modified:    formatRFC3339(f.ModifiedTime),
+		Parents:     parents,
+		Description: f.Description,
+		Shared:      f.Shared,
+		ViewUrl:     f.WebViewLink,
+		DownloadUrl: f.WebContentLink,
+	}
+}
+
+func (self *fileRecord) csvRecord() []string {
+	return []string{
+		self.Id,
+		self.Name,
+		self.Path,
+		self.Type,
+		self.MimeType,
+		strconv.FormatInt(self.Size, 10),
+		self.Md5,
+		self.Created,
+		self.Modified,
+		strings.Join(self.Parents, ","),
+		self.Description,
+		strconv.FormatBool(self.Shared),
+		self.ViewUrl,
+		self.DownloadUrl,
+	}
+}
+
+type changeRecord struct {
+	FileId string `json:"fileId"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Time   string `json:"time"`
+}
+
+var changeRecordHeader = []string{"fileId", "name", "action", "time"}
+
+func (self *changeRecord) csvRecord() []string {
+	return []string{self.FileId, self.Name, self.Action, self.Time}
+}
+
+type pageTokenRecord struct {
+	PageToken string `json:"pageToken"`
+}
+
+var pageTokenRecordHeader = []string{"pageToken"}
+
+func (self *pageTokenRecord) csvRecord() []string {
+	return []string{self.PageToken}
+}
+
+type revisionRecord struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	Md5         string `json:"md5,omitempty"`
+	Modified    string `json:"modified"`
+	KeepForever bool   `json:"keepForever"`
+}
+
+var revisionRecordHeader = []string{"id", "name", "size", "md5", "modified", "keepForever"}
+
+func (self *revisionRecord) csvRecord() []string {
+	return []string{
+		self.Id,
+		self.Name,
+		strconv.FormatInt(self.Size, 10),
+		self.Md5,
+		self.Modified,
+		strconv.FormatBool(self.KeepForever),
+	}
+}
+
+type driveRecord struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Created string `json:"created"`
+}
+
+var driveRecordHeader = []string{"id", "name", "created"}
+
+func (self *driveRecord) csvRecord() []string {
+	return []string{self.Id, self.Name, self.Created}
+}
+
+type syncFileRecord struct {
+	Id       string `json:"id"`
+	Path     string `json:"path"`
+	AbsPath  string `json:"absPath"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Md5      string `json:"md5,omitempty"`
+	Modified string `json:"modified"`
+}
+
+var syncFileRecordHeader = []string{"id", "path", "absPath", "type", "size", "md5", "modified"}
+
+func (self *syncFileRecord) csvRecord() []string {
+	return []string{
+		self.Id,
+		self.Path,
+		self.AbsPath,
+		self.Type,
+		strconv.FormatInt(self.Size, 10),
+		self.Md5,
+		self.Modified,
+	}
+}
+
+type checkRecord struct {
+	Status     string `json:"status"`
+	Path       string `json:"path"`
+	AbsPath    string `json:"absPath,omitempty"`
+	Id         string `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	LocalSize  int64  `json:"localSize"`
+	RemoteSize int64  `json:"remoteSize"`
+	Md5        string `json:"md5,omitempty"`
+}
+
+var checkRecordHeader = []string{"status", "path", "absPath", "id", "type", "localSize", "remoteSize", "md5"}
+
+func (self *checkRecord) csvRecord() []string {
+	return []string{
+		self.Status,
+		self.Path,
+		self.AbsPath,
+		self.Id,
+		self.Type,
+		strconv.FormatInt(self.LocalSize, 10),
+		strconv.FormatInt(self.RemoteSize, 10),
+		self.Md5,
+	}
+}
+
+// Converts a timestamp returned by drive to a RFC3339 timestamp in UTC
+func formatRFC3339(iso string) string {
+	t, err := time.Parse(time.RFC3339, iso)
+	if err != nil {
+		return iso
+	}
+	return t.UTC().Format(time.RFC3339)
+}
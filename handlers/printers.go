@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grandeto/gdrive/constants"
+	gdrive "github.com/grandeto/gdrive/drive"
+	"github.com/grandeto/gdrive/util"
+	"google.golang.org/api/drive/v3"
+)
+
+type kv struct {
+	key   string
+	value string
+}
+
+type printFileListArgs struct {
+	out         io.Writer
+	files       []*gdrive.File
+	nameWidth   int
+	skipHeader  bool
+	sizeInBytes bool
+	absPath     bool
+	output      string
+}
+
+func printFileList(args printFileListArgs) error {
+	if args.output != "" {
+		var records []record
+		for _, f := range args.files {
+			records = append(records, newFileRecord(f.File, f.Path))
+		}
+		return printRecords(args.out, args.output, fileRecordHeader, records)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Id\tName\tType\tSize\tCreated")
+	}
+
+	for _, f := range args.files {
+		// Show the absolute path instead of the name
+		name := f.Name
+		if args.absPath {
+			name = strings.TrimPrefix(f.Path, "/")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			f.Id,
+			util.TruncateString(name, args.nameWidth),
+			gdrive.FileType(f.File),
+			util.FormatSize(f.Size, args.sizeInBytes),
+			util.FormatDatetime(f.CreatedTime),
+		)
+	}
+
+	return w.Flush()
+}
+
+type printFileInfoArgs struct {
+	out         io.Writer
+	file        *gdrive.File
+	sizeInBytes bool
+	output      string
+}
+
+func printFileInfo(args printFileInfoArgs) error {
+	f := args.file
+
+	if args.output != "" {
+		r := newFileRecord(f.File, f.Path)
+
+		// A single file is printed as an object rather than a list
+		if args.output == constants.OutputJson {
+			return printJson(args.out, r)
+		}
+		return printRecords(args.out, args.output, fileRecordHeader, []record{r})
+	}
+
+	items := []kv{
+		kv{"Id", f.Id},
+		kv{"Name", f.Name},
+		kv{"Path", strings.TrimPrefix(f.Path, "/")},
+		kv{"Description", f.Description},
+		kv{"Mime", f.MimeType},
+		kv{"Size", util.FormatSize(f.Size, args.sizeInBytes)},
+		kv{"Created", util.FormatDatetime(f.CreatedTime)},
+		kv{"Modified", util.FormatDatetime(f.ModifiedTime)},
+		kv{"Md5sum", f.Md5Checksum},
+		kv{"Shared", formatBool(f.Shared)},
+		kv{"Parents", formatList(f.Parents)},
+		kv{"ViewUrl", f.WebViewLink},
+		kv{"DownloadUrl", f.WebContentLink},
+	}
+
+	for _, item := range items {
+		if item.value != "" {
+			fmt.Fprintf(args.out, "%s: %s\n", item.key, item.value)
+		}
+	}
+
+	return nil
+}
+
+func printPageToken(out io.Writer, pageToken string, output string) error {
+	if output == "" {
+		fmt.Fprintf(out, "Page token: %s\n", pageToken)
+		return nil
+	}
+
+	r := &pageTokenRecord{PageToken: pageToken}
+	if output == constants.OutputJson {
+		return printJson(out, r)
+	}
+	return printRecords(out, output, pageTokenRecordHeader, []record{r})
+}
+
+type printChangesArgs struct {
+	out        io.Writer
+	changeList *drive.ChangeList
+	nameWidth  int
+	skipHeader bool
+	output     string
+}
+
+func printChanges(args printChangesArgs) error {
+	if args.output != "" {
+		return printChangeRecords(args)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Id\tName\tAction\tTime")
+	}
+
+	for _, c := range args.changeList.Changes {
+		name, action := changeNameAndAction(c)
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			c.FileId,
+			util.TruncateString(name, args.nameWidth),
+			action,
+			util.FormatDatetime(c.Time),
+		)
+	}
+
+	if len(args.changeList.Changes) > 0 {
+		w.Flush()
+		pageToken, hasMore := nextChangesPageToken(args.changeList)
+		fmt.Fprintf(args.out, "\nToken: %s, more: %t\n", pageToken, hasMore)
+	} else {
+		fmt.Fprintln(args.out, "No changes")
+	}
+
+	return nil
+}
+
+// Json output wraps the changes in an object together with the next page token,
+// jsonl and csv output only contains the change records
+func printChangeRecords(args printChangesArgs) error {
+	records := []record{}
+	for _, c := range args.changeList.Changes {
+		name, action := changeNameAndAction(c)
+		records = append(records, &changeRecord{
+			FileId: c.FileId,
+			Name:   name,
+			Action: action,
+			Time:   formatRFC3339(c.Time),
+		})
+	}
+
+	if args.output != constants.OutputJson {
+		return printRecords(args.out, args.output, changeRecordHeader, records)
+	}
+
+	pageToken, hasMore := nextChangesPageToken(args.changeList)
+	return printJson(args.out, struct {
+		Changes   []record `json:"changes"`
+		PageToken string   `json:"pageToken"`
+		More      bool     `json:"more"`
+	}{records, pageToken, hasMore})
+}
+
+func changeNameAndAction(c *drive.Change) (string, string) {
+	if c.Removed {
+		return "", "remove"
+	}
+	return c.File.Name, "update"
+}
+
+func nextChangesPageToken(cl *drive.ChangeList) (string, bool) {
+	if cl.NextPageToken != "" {
+		return cl.NextPageToken, true
+	}
+
+	return cl.NewStartPageToken, false
+}
+
+type printDriveListArgs struct {
+	out        io.Writer
+	drives     []*drive.Drive
+	skipHeader bool
+	output     string
+}
+
+func printDriveList(args printDriveListArgs) error {
+	if args.output != "" {
+		var records []record
+		for _, d := range args.drives {
+			records = append(records, &driveRecord{
+				Id:      d.Id,
+				Name:    d.Name,
+				Created: formatRFC3339(d.CreatedTime),
+			})
+		}
+		return printRecords(args.out, args.output, driveRecordHeader, records)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Id\tName\tCreated")
+	}
+
+	for _, d := range args.drives {
+		fmt.Fprintf(w, "%s\t%s\t%s\n",
+			d.Id,
+			d.Name,
+			util.FormatDatetime(d.CreatedTime),
+		)
+	}
+
+	return w.Flush()
+}
+
+type printRevisionListArgs struct {
+	out         io.Writer
+	revisions   []*drive.Revision
+	nameWidth   int
+	skipHeader  bool
+	sizeInBytes bool
+	output      string
+}
+
+func printRevisionList(args printRevisionListArgs) error {
+	if args.output != "" {
+		var records []record
+		for _, rev := range args.revisions {
+			records = append(records, &revisionRecord{
+				Id:          rev.Id,
+				Name:        rev.OriginalFilename,
+				Size:        rev.Size,
+				Md5:         rev.Md5Checksum,
+				Modified:    formatRFC3339(rev.ModifiedTime),
+				KeepForever: rev.KeepForever,
+			})
+		}
+		return printRecords(args.out, args.output, revisionRecordHeader, records)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Id\tName\tSize\tModified\tKeepForever")
+	}
+
+	for _, rev := range args.revisions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			rev.Id,
+			util.TruncateString(rev.OriginalFilename, args.nameWidth),
+			util.FormatSize(rev.Size, args.sizeInBytes),
+			util.FormatDatetime(rev.ModifiedTime),
+			formatBool(rev.KeepForever),
+		)
+	}
+
+	return w.Flush()
+}
+
+func printPermissions(out io.Writer, permissions []*drive.Permission) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "Id\tType\tRole\tEmail\tDomain\tDiscoverable")
+
+	for _, p := range permissions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Id,
+			p.Type,
+			p.Role,
+			p.EmailAddress,
+			p.Domain,
+			formatBool(p.AllowFileDiscovery),
+		)
+	}
+
+	w.Flush()
+}
+
+func printAbout(out io.Writer, about *drive.About, sizeInBytes bool) {
+	user := about.User
+	quota := about.StorageQuota
+
+	fmt.Fprintf(out, "User: %s, %s\n", user.DisplayName, user.EmailAddress)
+	fmt.Fprintf(out, "Used: %s\n", util.FormatSize(quota.Usage, sizeInBytes))
+	fmt.Fprintf(out, "Free: %s\n", util.FormatSize(quota.Limit-quota.Usage, sizeInBytes))
+	fmt.Fprintf(out, "Total: %s\n", util.FormatSize(quota.Limit, sizeInBytes))
+	fmt.Fprintf(out, "Max upload size: %s\n", util.FormatSize(about.MaxUploadSize, sizeInBytes))
+}
+
+func printAboutFormats(out io.Writer, formats map[string][]string) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "From\tTo")
+
+	for from, toFormats := range formats {
+		fmt.Fprintf(w, "%s\t%s\n", from, formatList(toFormats))
+	}
+
+	w.Flush()
+}
+
+func printSyncDirectories(out io.Writer, files []*drive.File, skipHeader bool) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 3, ' ', 0)
+
+	if !skipHeader {
+		fmt.Fprintln(w, "Id\tName\tCreated")
+	}
+
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\n",
+			f.Id,
+			f.Name,
+			util.FormatDatetime(f.CreatedTime),
+		)
+	}
+
+	w.Flush()
+}
+
+// Returns a function that prints the progress of a sync
+func printSyncEvent(out io.Writer) func(gdrive.SyncEvent) {
+	return func(e gdrive.SyncEvent) {
+		fmt.Fprintln(out, formatSyncEvent(e))
+	}
+}
+
+func formatSyncEvent(e gdrive.SyncEvent) string {
+	// Files that are part of a group are numbered
+	prefix := ""
+	if e.Index > 0 {
+		prefix = fmt.Sprintf("[%04d/%04d] ", e.Index, e.Count)
+	}
+
+	switch e.Kind {
+	case gdrive.SyncStarted:
+		return "Starting sync..."
+	case gdrive.SyncCollecting:
+		return "Collecting file information..."
+	case gdrive.SyncCollected:
+		return fmt.Sprintf("Found %d local files and %d remote files", e.LocalFiles, e.RemoteFiles)
+	case gdrive.SyncMissingLocalDirs:
+		return fmt.Sprintf("\n%d local directories are missing", e.Count)
+	case gdrive.SyncMissingRemoteDirs:
+		return fmt.Sprintf("\n%d remote directories are missing", e.Count)
+	case gdrive.SyncMissingLocalFiles:
+		return fmt.Sprintf("\n%d local files are missing", e.Count)
+	case gdrive.SyncMissingRemoteFiles:
+		return fmt.Sprintf("\n%d remote files are missing", e.Count)
+	case gdrive.SyncChangedLocalFiles:
+		return fmt.Sprintf("\n%d local files has changed", e.Count)
+	case gdrive.SyncChangedRemoteFiles:
+		return fmt.Sprintf("\n%d remote files has changed", e.Count)
+	case gdrive.SyncExtraneousLocalFiles:
+		return fmt.Sprintf("\n%d local files are extraneous", e.Count)
+	case gdrive.SyncExtraneousRemoteFiles:
+		return fmt.Sprintf("\n%d remote files are extraneous", e.Count)
+	case gdrive.SyncCreatingDir:
+		return fmt.Sprintf("%sCreating directory %s", prefix, e.Path)
+	case gdrive.SyncUploading:
+		return fmt.Sprintf("%sUploading %s -> %s", prefix, e.Path, e.Target)
+	case gdrive.SyncUpdating:
+		return fmt.Sprintf("%sUpdating %s -> %s", prefix, e.Path, e.Target)
+	case gdrive.SyncDownloading:
+		return fmt.Sprintf("%sDownloading %s -> %s", prefix, e.Path, e.Target)
+	case gdrive.SyncSkipping:
+		return fmt.Sprintf("%sSkipping %s (%s)", prefix, e.Path, e.Reason)
+	case gdrive.SyncKeeping:
+		return fmt.Sprintf("%sKeeping %s (%s)", prefix, e.Path, e.Reason)
+	case gdrive.SyncDeleting:
+		return fmt.Sprintf("%sDeleting %s", prefix, e.Path)
+	case gdrive.SyncTrashing:
+		return fmt.Sprintf("%sTrashing %s", prefix, e.Path)
+	case gdrive.SyncWatching:
+		return fmt.Sprintf("Watching %s and %s for changes, press ctrl+c to stop", e.Path, e.Target)
+	case gdrive.SyncStopping:
+		return "Stopping..."
+	case gdrive.SyncFinished:
+		return fmt.Sprintf("Sync finished in %s", e.Duration)
+	case gdrive.SyncFailed:
+		return fmt.Sprintf("Sync failed: %s", e.Err)
+	case gdrive.SyncWatchError:
+		return e.Err.Error()
+	case gdrive.SyncAdopting:
+		return fmt.Sprintf("Adopting %s with %d files", e.Path, e.Count)
+	case gdrive.SyncTagging:
+		return fmt.Sprintf("%sTagging %s", prefix, e.Path)
+	}
+
+	return fmt.Sprintf("%s%s", prefix, e.Path)
+}
+
+func printSyncConflicts(out io.Writer, conflicts []gdrive.SyncConflict) {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "Path\tSize Local\tSize Remote\tModified Local\tModified Remote")
+
+	for _, c := range conflicts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			util.TruncateString(c.Path, 60),
+			util.FormatSize(c.LocalSize, false),
+			util.FormatSize(c.RemoteSize, false),
+			c.LocalModified.Local().Format("Jan _2 2006 15:04:05.000"),
+			c.RemoteModified.Local().Format("Jan _2 2006 15:04:05.000"),
+		)
+	}
+
+	w.Flush()
+}
+
+type printSyncDirContentArgs struct {
+	out         io.Writer
+	files       []*gdrive.SyncFile
+	skipHeader  bool
+	pathWidth   int
+	sizeInBytes bool
+	output      string
+}
+
+func printSyncDirContent(args printSyncDirContentArgs) error {
+	if args.output != "" {
+		var records []record
+		for _, f := range args.files {
+			records = append(records, &syncFileRecord{
+				Id:       f.Id,
+				Path:     f.RelPath,
+				AbsPath:  f.Path,
+				Type:     gdrive.FileType(f.File),
+				Size:     f.Size,
+				Md5:      f.Md5Checksum,
+				Modified: formatRFC3339(f.ModifiedTime),
+			})
+		}
+		return printRecords(args.out, args.output, syncFileRecordHeader, records)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Id\tPath\tType\tSize\tModified")
+	}
+
+	for _, f := range args.files {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			f.Id,
+			util.TruncateString(f.RelPath, args.pathWidth),
+			gdrive.FileType(f.File),
+			util.FormatSize(f.Size, args.sizeInBytes),
+			util.FormatDatetime(f.ModifiedTime),
+		)
+	}
+
+	return w.Flush()
+}
+
+type printCheckDiffsArgs struct {
+	out         io.Writer
+	diffs       []*gdrive.CheckDiff
+	skipHeader  bool
+	sizeInBytes bool
+	output      string
+}
+
+func printCheckDiffs(args printCheckDiffsArgs) error {
+	if args.output != "" {
+		var records []record
+		for _, d := range args.diffs {
+			records = append(records, &checkRecord{
+				Status:     d.Status,
+				Path:       d.Path,
+				AbsPath:    d.AbsPath,
+				Id:         d.Id,
+				Type:       d.Type,
+				LocalSize:  d.LocalSize,
+				RemoteSize: d.RemoteSize,
+				Md5:        d.Md5,
+			})
+		}
+		return printRecords(args.out, args.output, checkRecordHeader, records)
+	}
+
+	if len(args.diffs) == 0 {
+		fmt.Fprintf(args.out, "No differences found\n")
+		return nil
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(args.out, 0, 0, 3, ' ', 0)
+
+	if !args.skipHeader {
+		fmt.Fprintln(w, "Status\tPath\tId\tLocal size\tRemote size")
+	}
+
+	for _, d := range args.diffs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			d.Status,
+			d.Path,
+			d.Id,
+			util.FormatSize(d.LocalSize, args.sizeInBytes),
+			util.FormatSize(d.RemoteSize, args.sizeInBytes),
+		)
+	}
+
+	return w.Flush()
+}
+
+func formatList(a []string) string {
+	return strings.Join(a, ", ")
+}
+
+func formatBool(b bool) string {
+	return strings.Title(strconv.FormatBool(b))
+}
@@ -34,9 +34,41 @@ func LoadGlobalFlags() []cli.Flag {
 			Patterns:    []string{"--service-account"},
 			Description: "Oauth service account filename, used for server to server communication without user interaction (filename path is relative to config dir)",
 		},
+		cli.StringFlag{
+			Name:        "output",
+			Patterns:    []string{"--output"},
+			Description: fmt.Sprintf("Output format of listings: %s/%s/%s, default is a table", constants.OutputJson, constants.OutputJsonl, constants.OutputCsv),
+		},
+		cli.StringFlag{
+			Name:        "driveId",
+			Patterns:    []string{"--drive"},
+			Description: "Id of shared drive to use, default is your own drive. See 'drives list'",
+		},
+		cli.StringFlag{
+			Name:        "profile",
+			Patterns:    []string{"--profile"},
+			Description: "Name of profile to use, default is the default profile. See 'profile list'",
+		},
+		cli.IntFlag{
+			Name:         "retries",
+			Patterns:     []string{"--retries"},
+			Description:  fmt.Sprintf("Number of times a failed request is retried, default: %d", constants.MaxErrorRetries),
+			DefaultValue: constants.MaxErrorRetries,
+		},
+		cli.IntFlag{
+			Name:         "maxBackoff",
+			Patterns:     []string{"--max-backoff"},
+			Description:  fmt.Sprintf("Max seconds to wait between retries, default: %d", constants.DefaultMaxBackoff),
+			DefaultValue: constants.DefaultMaxBackoff,
+		},
 	}
 }
 
+// Flag defaults are taken from the config file, the active profile and the environment
+func LoadDefaults() cli.DefaultsFunc {
+	return handlers.FlagDefaults
+}
+
 func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 	return []*cli.Handler{
 		&cli.Handler{
@@ -138,12 +170,68 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Write file content to stdout",
 						OmitValue:   true,
 					},
+					cli.BoolFlag{
+						Name:        "md5File",
+						Patterns:    []string{"--md5-file"},
+						Description: "Write the md5 checksum of each downloaded file to <file>.md5",
+						OmitValue:   true,
+					},
 					cli.IntFlag{
 						Name:         "timeout",
 						Patterns:     []string{"--timeout"},
 						Description:  fmt.Sprintf("Set timeout in seconds, use 0 for no timeout. Timeout is reached when no data is transferred in set amount of seconds, default: %d", constants.DefaultTimeout),
 						DefaultValue: constants.DefaultTimeout,
 					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Decrypt encrypted files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Decrypt encrypted files with a key derived from the given passphrase",
+					},
 				),
 			},
 		},
@@ -177,12 +265,68 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Patterns:    []string{"--path"},
 						Description: "Download path",
 					},
+					cli.BoolFlag{
+						Name:        "md5File",
+						Patterns:    []string{"--md5-file"},
+						Description: "Write the md5 checksum of each downloaded file to <file>.md5",
+						OmitValue:   true,
+					},
 					cli.BoolFlag{
 						Name:        "noProgress",
 						Patterns:    []string{"--no-progress"},
 						Description: "Hide progress",
 						OmitValue:   true,
 					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Decrypt encrypted files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Decrypt encrypted files with a key derived from the given passphrase",
+					},
 				),
 			},
 		},
@@ -249,6 +393,62 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description:  fmt.Sprintf("Set chunk size in bytes, default: %d", constants.DefaultUploadChunkSize),
 						DefaultValue: constants.DefaultUploadChunkSize,
 					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Encrypt file with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Encrypt file with a key derived from the given passphrase",
+					},
+					cli.BoolFlag{
+						Name:        "encryptNames",
+						Patterns:    []string{"--encrypt-names"},
+						Description: "Encrypt the names of uploaded files and directories",
+						OmitValue:   true,
+					},
 				),
 			},
 		},
@@ -298,6 +498,27 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Hide progress",
 						OmitValue:   true,
 					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Encrypt file with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Encrypt file with a key derived from the given passphrase",
+					},
+					cli.BoolFlag{
+						Name:        "encryptNames",
+						Patterns:    []string{"--encrypt-names"},
+						Description: "Encrypt the name of the uploaded file",
+						OmitValue:   true,
+					},
 				),
 			},
 		},
@@ -346,6 +567,27 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description:  fmt.Sprintf("Set chunk size in bytes, default: %d", constants.DefaultUploadChunkSize),
 						DefaultValue: constants.DefaultUploadChunkSize,
 					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Encrypt file with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Encrypt file with a key derived from the given passphrase",
+					},
+					cli.BoolFlag{
+						Name:        "encryptNames",
+						Patterns:    []string{"--encrypt-names"},
+						Description: "Encrypt the name of the uploaded file",
+						OmitValue:   true,
+					},
 				),
 			},
 		},
@@ -458,6 +700,175 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Delete directory and all it's content",
 						OmitValue:   true,
 					},
+					cli.BoolFlag{
+						Name:        "permanent",
+						Patterns:    []string{"--permanent"},
+						Description: "Delete permanently instead of moving to trash",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] trash list [options]",
+			Description: "List files in trash",
+			Callback:    handlers.ListTrashHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.IntFlag{
+						Name:         "maxFiles",
+						Patterns:     []string{"-m", "--max"},
+						Description:  fmt.Sprintf("Max files to list, default: %d", constants.DefaultMaxFiles),
+						DefaultValue: constants.DefaultMaxFiles,
+					},
+					cli.StringFlag{
+						Name:        "sortOrder",
+						Patterns:    []string{"--order"},
+						Description: "Sort order. See https://godoc.org/google.golang.org/api/drive/v3#FilesListCall.OrderBy",
+					},
+					cli.IntFlag{
+						Name:         "nameWidth",
+						Patterns:     []string{"--name-width"},
+						Description:  fmt.Sprintf("Width of name column, default: %d, minimum: 9, use 0 for full width", constants.DefaultNameWidth),
+						DefaultValue: constants.DefaultNameWidth,
+					},
+					cli.BoolFlag{
+						Name:        "skipHeader",
+						Patterns:    []string{"--no-header"},
+						Description: "Dont print the header",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "sizeInBytes",
+						Patterns:    []string{"--bytes"},
+						Description: "Size in bytes",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] trash restore <fileId>",
+			Description: "Restore file or directory from trash",
+			Callback:    handlers.RestoreTrashHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] trash empty [options]",
+			Description: "Permanently delete all files in trash",
+			Callback:    handlers.EmptyTrashHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "yes",
+						Patterns:    []string{"-y", "--yes"},
+						Description: "Don't ask for confirmation",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] copy [options] <fileId>",
+			Description: "Copy file or directory",
+			Callback:    handlers.CopyHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.StringFlag{
+						Name:        "parent",
+						Patterns:    []string{"-p", "--parent"},
+						Description: "Id of directory to copy to",
+					},
+					cli.StringFlag{
+						Name:        "name",
+						Patterns:    []string{"--name"},
+						Description: "Name of the copy, default is the name of the source",
+					},
+					cli.BoolFlag{
+						Name:        "recursive",
+						Patterns:    []string{"-r", "--recursive"},
+						Description: "Copy directory and all it's content",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] move [options] <fileId>",
+			Description: "Move file or directory",
+			Callback:    handlers.MoveHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.StringFlag{
+						Name:        "parent",
+						Patterns:    []string{"-p", "--parent"},
+						Description: "Id of directory to move to",
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] rename <fileId> <name>",
+			Description: "Rename file or directory",
+			Callback:    handlers.RenameHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] meta set [options] <fileId>",
+			Description: "Set file metadata without uploading content",
+			Callback:    handlers.SetMetaHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.StringFlag{
+						Name:        "description",
+						Patterns:    []string{"--description"},
+						Description: "File description",
+					},
+					cli.BoolFlag{
+						Name:        "clearDescription",
+						Patterns:    []string{"--clear-description"},
+						Description: "Remove the file description",
+						OmitValue:   true,
+					},
+					cli.StringFlag{
+						Name:        "starred",
+						Patterns:    []string{"--starred"},
+						Description: "Star or unstar file: true/false",
+					},
+					cli.StringFlag{
+						Name:        "readOnly",
+						Patterns:    []string{"--readonly"},
+						Description: "Restrict or unrestrict file content: true/false",
+					},
+					cli.StringFlag{
+						Name:        "readOnlyReason",
+						Patterns:    []string{"--readonly-reason"},
+						Description: "Reason for the content restriction, only allowed with --readonly true",
+					},
+					cli.StringSliceFlag{
+						Name:        "appProperty",
+						Patterns:    []string{"--app-property"},
+						Description: "Set app property key=value, an empty value removes the key, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "property",
+						Patterns:    []string{"--property"},
+						Description: "Set property key=value, an empty value removes the key, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "modified",
+						Patterns:    []string{"--modified"},
+						Description: "Modification time, RFC 3339 timestamp, i.e. 2006-01-02T15:04:05Z",
+					},
 				),
 			},
 		},
@@ -541,6 +952,12 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Delete extraneous local files",
 						OmitValue:   true,
 					},
+					cli.BoolFlag{
+						Name:        "mirror",
+						Patterns:    []string{"--mirror"},
+						Description: "Sync any directory without tagging the files, files are matched by path",
+						OmitValue:   true,
+					},
 					cli.BoolFlag{
 						Name:        "dryRun",
 						Patterns:    []string{"--dry-run"},
@@ -559,6 +976,62 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description:  fmt.Sprintf("Set timeout in seconds, use 0 for no timeout. Timeout is reached when no data is transferred in set amount of seconds, default: %d", constants.DefaultTimeout),
 						DefaultValue: constants.DefaultTimeout,
 					},
+					cli.IntFlag{
+						Name:         "parallel",
+						Patterns:     []string{"--parallel"},
+						Description:  fmt.Sprintf("Number of files to transfer in parallel, default: %d", constants.DefaultParallel),
+						DefaultValue: constants.DefaultParallel,
+					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Decrypt encrypted files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Decrypt encrypted files with a key derived from the given passphrase",
+					},
 				),
 			},
 		},
@@ -593,6 +1066,18 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Delete extraneous remote files",
 						OmitValue:   true,
 					},
+					cli.BoolFlag{
+						Name:        "trash",
+						Patterns:    []string{"--trash"},
+						Description: "Move deleted remote files to trash instead of deleting them permanently",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "mirror",
+						Patterns:    []string{"--mirror"},
+						Description: "Sync any directory without tagging the files, files are matched by path",
+						OmitValue:   true,
+					},
 					cli.BoolFlag{
 						Name:        "dryRun",
 						Patterns:    []string{"--dry-run"},
@@ -617,6 +1102,236 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description:  fmt.Sprintf("Set chunk size in bytes, default: %d", constants.DefaultUploadChunkSize),
 						DefaultValue: constants.DefaultUploadChunkSize,
 					},
+					cli.IntFlag{
+						Name:         "parallel",
+						Patterns:     []string{"--parallel"},
+						Description:  fmt.Sprintf("Number of files to transfer in parallel, default: %d", constants.DefaultParallel),
+						DefaultValue: constants.DefaultParallel,
+					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Encrypt uploaded files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Encrypt uploaded files with a key derived from the given passphrase",
+					},
+					cli.BoolFlag{
+						Name:        "encryptNames",
+						Patterns:    []string{"--encrypt-names"},
+						Description: "Encrypt the names of uploaded files and directories",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] sync adopt [options] <fileId>",
+			Description: "Turn existing drive directory into a syncable directory",
+			Callback:    handlers.AdoptSyncHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "dryRun",
+						Patterns:    []string{"--dry-run"},
+						Description: "Show what would have been tagged",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] sync watch [options] <path> <fileId>",
+			Description: "Keep local directory and drive directory in sync until stopped",
+			Callback:    handlers.WatchSyncHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "keepRemote",
+						Patterns:    []string{"--keep-remote"},
+						Description: "Keep remote file when a conflict is encountered",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "keepLocal",
+						Patterns:    []string{"--keep-local"},
+						Description: "Keep local file when a conflict is encountered",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "keepLargest",
+						Patterns:    []string{"--keep-largest"},
+						Description: "Keep largest file when a conflict is encountered",
+						OmitValue:   true,
+					},
+					cli.IntFlag{
+						Name:         "interval",
+						Patterns:     []string{"--interval"},
+						Description:  fmt.Sprintf("Seconds between checks for remote changes, default: %d", constants.DefaultWatchInterval),
+						DefaultValue: constants.DefaultWatchInterval,
+					},
+					cli.BoolFlag{
+						Name:        "trash",
+						Patterns:    []string{"--trash"},
+						Description: "Move deleted remote files to trash instead of deleting them permanently",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "noProgress",
+						Patterns:    []string{"--no-progress"},
+						Description: "Hide progress",
+						OmitValue:   true,
+					},
+					cli.IntFlag{
+						Name:         "timeout",
+						Patterns:     []string{"--timeout"},
+						Description:  fmt.Sprintf("Set timeout in seconds, use 0 for no timeout. Timeout is reached when no data is transferred in set amount of seconds, default: %d", constants.DefaultTimeout),
+						DefaultValue: constants.DefaultTimeout,
+					},
+					cli.IntFlag{
+						Name:         "chunksize",
+						Patterns:     []string{"--chunksize"},
+						Description:  fmt.Sprintf("Set chunk size in bytes, default: %d", constants.DefaultUploadChunkSize),
+						DefaultValue: constants.DefaultUploadChunkSize,
+					},
+					cli.IntFlag{
+						Name:         "parallel",
+						Patterns:     []string{"--parallel"},
+						Description:  fmt.Sprintf("Number of files to transfer in parallel, default: %d", constants.DefaultParallel),
+						DefaultValue: constants.DefaultParallel,
+					},
+					cli.StringSliceFlag{
+						Name:        "include",
+						Patterns:    []string{"--include"},
+						Description: "Only transfer files matching the pattern, can be specified multiple times",
+					},
+					cli.StringSliceFlag{
+						Name:        "exclude",
+						Patterns:    []string{"--exclude"},
+						Description: "Skip files matching the pattern, can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "filterFrom",
+						Patterns:    []string{"--filter-from"},
+						Description: "Read include (+ <pattern>) and exclude (- <pattern>) rules from file",
+					},
+					cli.StringFlag{
+						Name:        "minSize",
+						Patterns:    []string{"--min-size"},
+						Description: "Skip files smaller than the given size, i.e. 100K",
+					},
+					cli.StringFlag{
+						Name:        "maxSize",
+						Patterns:    []string{"--max-size"},
+						Description: "Skip files larger than the given size, i.e. 1G",
+					},
+					cli.StringFlag{
+						Name:        "maxAge",
+						Patterns:    []string{"--max-age"},
+						Description: "Skip files modified longer ago than the given age, i.e. 7d",
+					},
+					cli.StringSliceFlag{
+						Name:        "mimeType",
+						Patterns:    []string{"--mime-type"},
+						Description: "Only transfer files with the given mime type, i.e. 'image/*', can be specified multiple times",
+					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Encrypt uploaded files and decrypt downloaded files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Encrypt uploaded files and decrypt downloaded files with a key derived from the given passphrase",
+					},
+					cli.BoolFlag{
+						Name:        "encryptNames",
+						Patterns:    []string{"--encrypt-names"},
+						Description: "Encrypt the names of uploaded files and directories",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] check [options] <path> <fileId>",
+			Description: "Compare local directory with drive directory",
+			Callback:    handlers.CheckHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "skipHeader",
+						Patterns:    []string{"--no-header"},
+						Description: "Dont print the header",
+						OmitValue:   true,
+					},
+					cli.BoolFlag{
+						Name:        "sizeInBytes",
+						Patterns:    []string{"--bytes"},
+						Description: "Size in bytes",
+						OmitValue:   true,
+					},
+					cli.StringFlag{
+						Name:        "keyFile",
+						Patterns:    []string{"--key-file"},
+						Description: "Compare encrypted files with a key derived from the given file",
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						Patterns:    []string{"--passphrase"},
+						Description: "Compare encrypted files with a key derived from the given passphrase",
+					},
 				),
 			},
 		},
@@ -724,6 +1439,11 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description:  fmt.Sprintf("Set timeout in seconds, use 0 for no timeout. Timeout is reached when no data is transferred in set amount of seconds, default: %d", constants.DefaultTimeout),
 						DefaultValue: constants.DefaultTimeout,
 					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
 				),
 			},
 		},
@@ -758,6 +1478,11 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Patterns:    []string{"--mime"},
 						Description: "Mime type of imported file",
 					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
 				),
 			},
 		},
@@ -785,6 +1510,27 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 						Description: "Print available mime types for given file",
 						OmitValue:   true,
 					},
+					cli.StringFlag{
+						Name:        "bwLimit",
+						Patterns:    []string{"--bwlimit"},
+						Description: "Limit bandwidth in bytes per second, i.e. 10M, or a schedule of limits, i.e. '08:00,2M 19:00,off'. Parallel transfers share the limit",
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] drives list [options]",
+			Description: "List shared drives",
+			Callback:    handlers.ListDrivesHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "skipHeader",
+						Patterns:    []string{"--no-header"},
+						Description: "Dont print the header",
+						OmitValue:   true,
+					},
 				),
 			},
 		},
@@ -820,6 +1566,132 @@ func LoadHandlers(globalFlags []cli.Flag) []*cli.Handler {
 				cli.NewFlagGroup("global", globalFlags...),
 			},
 		},
+		&cli.Handler{
+			Pattern:     "[global] auth login [options]",
+			Description: "Authenticate and save token",
+			Callback:    handlers.LoginHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.IntFlag{
+						Name:        "port",
+						Patterns:    []string{"--port"},
+						Description: "Port of the local server receiving the browser redirect, default is any free port",
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] auth logout",
+			Description: "Revoke and remove saved token",
+			Callback:    handlers.LogoutHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] auth status",
+			Description: "Show authentication status",
+			Callback:    handlers.AuthStatusHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] profile add [options] <name>",
+			Description: "Add profile",
+			Callback:    handlers.ProfileAddHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.StringFlag{
+						Name:        "clientId",
+						Patterns:    []string{"--client-id"},
+						Description: "Oauth client id, default is CLIENT_ID from the environment",
+					},
+					cli.StringFlag{
+						Name:        "clientSecret",
+						Patterns:    []string{"--client-secret"},
+						Description: "Oauth client secret, default is CLIENT_SECRET from the environment",
+					},
+					cli.StringSliceFlag{
+						Name:        "option",
+						Patterns:    []string{"--option"},
+						Description: "Default option key=value, key is a long flag name without dashes, i.e. timeout=60, can be specified multiple times",
+					},
+					cli.BoolFlag{
+						Name:        "default",
+						Patterns:    []string{"--default"},
+						Description: "Make this the default profile",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] profile list [options]",
+			Description: "List profiles",
+			Callback:    handlers.ProfileListHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "skipHeader",
+						Patterns:    []string{"--no-header"},
+						Description: "Dont print the header",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] profile remove <name>",
+			Description: "Remove profile and its token",
+			Callback:    handlers.ProfileRemoveHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] profile default <name>",
+			Description: "Set default profile",
+			Callback:    handlers.ProfileDefaultHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] config list [options]",
+			Description: "List default options from config file",
+			Callback:    handlers.ConfigListHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+				cli.NewFlagGroup("options",
+					cli.BoolFlag{
+						Name:        "skipHeader",
+						Patterns:    []string{"--no-header"},
+						Description: "Dont print the header",
+						OmitValue:   true,
+					},
+				),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] config get <key>",
+			Description: "Print default option from config file",
+			Callback:    handlers.ConfigGetHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
+		&cli.Handler{
+			Pattern:     "[global] config set <key> <value>",
+			Description: "Set default option in config file, an empty value removes the option",
+			Callback:    handlers.ConfigSetHandler,
+			FlagGroups: cli.FlagGroups{
+				cli.NewFlagGroup("global", globalFlags...),
+			},
+		},
 		&cli.Handler{
 			Pattern:     "version",
 			Description: "Print application version",
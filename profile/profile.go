@@ -0,0 +1,129 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/grandeto/gdrive/constants"
+	"github.com/grandeto/gdrive/util"
+)
+
+// A named account with its own token, credentials and default options
+type Profile struct {
+	ClientId       string `json:"clientId,omitempty"`
+	ClientSecret   string `json:"clientSecret,omitempty"`
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Default values of flags, keyed by the long flag name without dashes, i.e. "timeout"
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Profile names are used as directory names
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type Profiles struct {
+	path     string
+	Default  string              `json:"default,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// Loads the profiles in the config dir, no profiles are returned if the file does not exist
+func Load(configDir string) (*Profiles, error) {
+	profiles := &Profiles{
+		path:     util.ConfigFilePath(configDir, constants.ProfilesFileName),
+		Profiles: map[string]*Profile{},
+	}
+
+	f, err := os.Open(profiles.path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read profiles: %s", err)
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(profiles); err != nil {
+		return nil, fmt.Errorf("Failed to read profiles: %s", err)
+	}
+
+	if profiles.Profiles == nil {
+		profiles.Profiles = map[string]*Profile{}
+	}
+
+	return profiles, nil
+}
+
+func (self *Profiles) Save() error {
+	if err := os.MkdirAll(filepath.Dir(self.path), 0700); err != nil {
+		return fmt.Errorf("Failed to create config dir: %s", err)
+	}
+
+	if err := util.WritePrivateJson(self.path, self); err != nil {
+		return fmt.Errorf("Failed to save profiles: %s", err)
+	}
+
+	return nil
+}
+
+func (self *Profiles) Get(name string) (*Profile, error) {
+	p, ok := self.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Profile '%s' does not exist, see 'profile list'", name)
+	}
+	return p, nil
+}
+
+func (self *Profiles) Add(name string, p *Profile) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("Invalid profile name '%s', only letters, digits, '-' and '_' are allowed", name)
+	}
+
+	if _, ok := self.Profiles[name]; ok {
+		return fmt.Errorf("Profile '%s' already exists", name)
+	}
+
+	self.Profiles[name] = p
+	return nil
+}
+
+func (self *Profiles) Remove(name string) error {
+	if _, err := self.Get(name); err != nil {
+		return err
+	}
+
+	delete(self.Profiles, name)
+
+	if self.Default == name {
+		self.Default = ""
+	}
+
+	return nil
+}
+
+func (self *Profiles) SetDefault(name string) error {
+	if _, err := self.Get(name); err != nil {
+		return err
+	}
+
+	self.Default = name
+	return nil
+}
+
+// Returns the profile names in alphabetical order
+func (self *Profiles) Names() []string {
+	var names []string
+	for name := range self.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the directory holding the token of the profile
+func Dir(configDir, name string) string {
+	return filepath.Join(configDir, constants.ProfilesDirName, name)
+}
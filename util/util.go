@@ -20,10 +20,6 @@ func ConfigFilePath(basePath, name string) string {
 	return filepath.Join(basePath, name)
 }
 
-func GetAuthFileNamePath() string {
-	return filepath.Join(Homedir(), constants.AuthFileName)
-}
-
 func Homedir() string {
 	if runtime.GOOS == "windows" {
 		return os.Getenv("APPDATA")
@@ -78,8 +74,21 @@ func CheckErr(err error) {
 }
 
 func WriteJson(path string, data interface{}) error {
+	return writeJson(path, data, 0666)
+}
+
+// Writes json that only the owner can read, used for files holding credentials
+func WritePrivateJson(path string, data interface{}) error {
+	return writeJson(path, data, 0600)
+}
+
+func writeJson(path string, data interface{}, perm os.FileMode) error {
 	tmpFile := path + ".tmp"
-	f, err := os.Create(tmpFile)
+
+	// Remove any leftover tmp file so that it is created with the given permissions
+	os.Remove(tmpFile)
+
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return err
 	}